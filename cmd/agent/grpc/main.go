@@ -2,35 +2,21 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gitgernit/go-calculator/internal/app"
 	appconfig "github.com/gitgernit/go-calculator/internal/config"
-	"github.com/gitgernit/go-calculator/internal/domain/agent"
-	grpcagent "github.com/gitgernit/go-calculator/internal/transport/grpc/agent"
-	"strconv"
 )
 
 func main() {
-	config, err := appconfig.New()
-	if err != nil {
-		panic(err)
-	}
+	config := appconfig.FromCommandLine()
 
-	poller, err := grpcagent.NewGRPCPoller(config.OrchestratorHost, strconv.Itoa(config.OrchestratorGRPCPort))
-	if err != nil {
-		panic(err)
-	}
-	defer poller.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	interactor := agent.Interactor{
-		Poller: poller,
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	err = interactor.StartPolling(ctx, config.ComputingPower)
-	if err != nil {
+	if err := app.RunGRPCAgent(ctx, config); err != nil {
 		panic(err)
 	}
-
-	select {}
 }
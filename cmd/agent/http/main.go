@@ -2,30 +2,21 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gitgernit/go-calculator/internal/app"
 	appconfig "github.com/gitgernit/go-calculator/internal/config"
-	"github.com/gitgernit/go-calculator/internal/domain/agent"
-	httpagent "github.com/gitgernit/go-calculator/internal/transport/http/agent"
 )
 
 func main() {
-	config, err := appconfig.New()
-
-	if err != nil {
-		panic(err)
-	}
-
-	poller := httpagent.ExpressionPoller{
-		Config: *config,
-	}
-	interactor := agent.Interactor{
-		Poller: &poller,
-	}
+	config := appconfig.FromCommandLine()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	err = interactor.StartPolling(ctx, config.ComputingPower)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err != nil {
-		cancel()
+	if err := app.RunHTTPAgent(ctx, config); err != nil {
 		panic(err)
 	}
 }
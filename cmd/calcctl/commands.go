@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gitgernit/go-calculator/pkg/client"
+	"github.com/google/uuid"
+	"golang.org/x/term"
+)
+
+func (a *app) register(ctx context.Context, args []string) error {
+	login, password, err := a.credentials(args)
+	if err != nil {
+		return err
+	}
+
+	if err := a.client.Register(ctx, login, password); err != nil {
+		return err
+	}
+
+	return a.authorize(ctx, login, password)
+}
+
+func (a *app) login(ctx context.Context, args []string) error {
+	login, password, err := a.credentials(args)
+	if err != nil {
+		return err
+	}
+
+	return a.authorize(ctx, login, password)
+}
+
+// credentials takes the login and password from the arguments, asking for
+// the password if it isn't given.
+func (a *app) credentials(args []string) (login, password string, err error) {
+	switch len(args) {
+	case 1:
+		fmt.Fprint(a.out, "password: ")
+		password, err = a.readPassword()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return args[0], password, nil
+
+	case 2:
+		return args[0], args[1], nil
+
+	default:
+		return "", "", errUsage
+	}
+}
+
+// readPassword reads a line of input, without echoing it if it's typed in
+// a terminal.
+func (a *app) readPassword() (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(a.out)
+		return string(password), err
+	}
+
+	password, err := a.in.ReadString('\n')
+	if err != nil && password == "" {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+// authorize logs in and stores the token along with the server it's valid
+// for.
+func (a *app) authorize(ctx context.Context, login, password string) error {
+	token, err := a.client.Login(ctx, login, password)
+	if err != nil {
+		return err
+	}
+
+	a.config.Server = a.client.BaseURL
+	a.config.Login = login
+	a.config.Token = token
+	if err := a.config.save(a.configPath); err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+
+	fmt.Fprintf(a.out, "logged in as %s\n", login)
+	return nil
+}
+
+func (a *app) logout(ctx context.Context, args []string) error {
+	a.client.SetToken("")
+	a.config.Login = ""
+	a.config.Token = ""
+
+	return a.config.save(a.configPath)
+}
+
+func (a *app) calc(ctx context.Context, args []string) error {
+	fs := newFlagSet("calc")
+	wait := fs.Bool("wait", false, "wait for the result, printing steps as they're solved")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check on the expression while waiting")
+	priority := fs.String("priority", "", `"low", "normal" or "high"`)
+	deadline := fs.String("deadline", "", "RFC 3339 time or duration from now to solve the expression by")
+	noSimulate := fs.Bool("no-simulate", false, "solve steps right away, without simulated latency")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+
+	options := client.SubmitOptions{Priority: *priority, NoSimulate: *noSimulate}
+	if *deadline != "" {
+		t, err := parseDeadline(*deadline)
+		if err != nil {
+			return err
+		}
+		options.Deadline = &t
+	}
+
+	id, err := a.client.Submit(ctx, strings.Join(positional, " "), options)
+	if err != nil {
+		return err
+	}
+	a.lastID = id
+
+	if !*wait {
+		if a.json {
+			return a.printJSON(map[string]uuid.UUID{"id": id})
+		}
+		fmt.Fprintln(a.out, id)
+		return nil
+	}
+
+	return a.wait(ctx, id, *interval)
+}
+
+// parseDeadline parses an RFC 3339 time or a duration from now.
+func parseDeadline(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q, expected an RFC 3339 time or a duration", value)
+	}
+
+	return t, nil
+}
+
+// wait checks on the expression every interval until it finishes, printing
+// each step once it's solved.
+func (a *app) wait(ctx context.Context, id uuid.UUID, interval time.Duration) error {
+	printed := 0
+
+	for {
+		// The expression is fetched before its steps, so every step is
+		// printed once it's finished.
+		expr, err := a.client.Get(ctx, id)
+		if err != nil {
+			return a.waitError(ctx, id, err)
+		}
+
+		steps, err := a.client.Steps(ctx, id)
+		if err != nil {
+			return a.waitError(ctx, id, err)
+		}
+
+		for _, step := range steps[min(printed, len(steps)):] {
+			a.printStep(step)
+		}
+		printed = max(printed, len(steps))
+
+		if expr.Finished() {
+			return a.printExpression(expr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return a.waitError(ctx, id, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (a *app) waitError(ctx context.Context, id uuid.UUID, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("stopped waiting, %s is still being solved", id)
+	}
+
+	return err
+}
+
+func (a *app) get(ctx context.Context, args []string) error {
+	fs := newFlagSet("get")
+	withSteps := fs.Bool("steps", false, "list the steps solved as well")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+
+	id, err := a.parseID(positional[0])
+	if err != nil {
+		return err
+	}
+
+	expr, err := a.client.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !*withSteps {
+		return a.printExpression(expr)
+	}
+
+	steps, err := a.client.Steps(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		return a.printJSON(struct {
+			Expression *client.Expression `json:"expression"`
+			Steps      []client.Step      `json:"steps"`
+		}{expr, steps})
+	}
+
+	for _, step := range steps {
+		a.printStep(step)
+	}
+	return a.printExpression(expr)
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	fs := newFlagSet("list")
+	var options client.ListOptions
+	fs.StringVar(&options.Status, "status", "", `"accepted", "done", "expired", "canceled" or "failed"`)
+	fs.StringVar(&options.Search, "q", "", "only expressions using the given operand or operator")
+	fs.StringVar(&options.Sort, "sort", "", "created_at or priority, prefixed with - for descending order")
+	fs.IntVar(&options.Limit, "limit", 0, "page size")
+	fs.StringVar(&options.Cursor, "cursor", "", "next_cursor of the previous page")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errUsage
+	}
+
+	page, err := a.client.List(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		return a.printJSON(page)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tRESULT\tPRIORITY\tCREATED\tEXPRESSION")
+	for _, expr := range page.Expressions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			expr.ID, expr.Status, formatResult(&expr), expr.Priority,
+			expr.CreatedAt.Local().Format(time.DateTime), expr.Expression)
+	}
+	w.Flush()
+
+	if page.NextCursor != "" {
+		fmt.Fprintf(a.out, "more: list -cursor %s\n", page.NextCursor)
+	}
+
+	return nil
+}
+
+func (a *app) cancel(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	id, err := a.parseID(args[0])
+	if err != nil {
+		return err
+	}
+
+	expr, err := a.client.Cancel(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return a.printExpression(expr)
+}
+
+func (a *app) usage(ctx context.Context, args []string) error {
+	usage, err := a.client.Usage(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		return a.printJSON(usage)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "pending\t%d of %d\n", usage.Pending, usage.MaxPending)
+	fmt.Fprintf(w, "requests per second\t%v, burst of %d\n", usage.RequestsPerSecond, usage.Burst)
+	fmt.Fprintf(w, "tokens available\t%.1f\n", usage.TokensAvailable)
+	fmt.Fprintf(w, "max expression length\t%d\n", usage.MaxExpressionLength)
+	fmt.Fprintf(w, "max expression operators\t%d\n", usage.MaxExpressionOperators)
+
+	return w.Flush()
+}
+
+func (a *app) printExpression(expr *client.Expression) error {
+	if a.json {
+		return a.printJSON(expr)
+	}
+
+	status := expr.Status
+	if expr.Status == client.StatusFailed {
+		status += ": " + expr.Error
+	}
+
+	fmt.Fprintf(a.out, "%s = %s (%s)\n", expr.Expression, formatResult(expr), status)
+	return nil
+}
+
+func (a *app) printStep(step client.Step) {
+	if a.json {
+		a.printJSON(step)
+		return
+	}
+
+	fmt.Fprintf(a.out, "  step %d: %s %s %s = %v by %s in %s\n",
+		step.Number, step.Arg1, step.Operation, step.Arg2, step.Result,
+		step.AgentID, step.FinishedAt.Sub(step.StartedAt).Round(time.Millisecond))
+}
+
+// formatResult shows the result of done expressions only, the others not
+// having one.
+func formatResult(expr *client.Expression) string {
+	if expr.Status != client.StatusDone {
+		return "?"
+	}
+
+	return fmt.Sprintf("%v", expr.Result)
+}
+
+func (a *app) printJSON(v any) error {
+	encoder := json.NewEncoder(a.out)
+	if f, ok := a.out.(*os.File); ok && isTerminal(f) {
+		encoder.SetIndent("", "  ")
+	}
+
+	return encoder.Encode(v)
+}
+
+// isTerminal reports whether f is a character device, which output
+// redirected to files and pipes isn't.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// config is persisted between runs, so the token of the last login is
+// reused.
+type config struct {
+	Server string `json:"server,omitempty"`
+	Login  string `json:"login,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// defaultConfigDir is where the config and the REPL history are kept,
+// unless CALCCTL_CONFIG points elsewhere.
+func defaultConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".calcctl"
+	}
+
+	return filepath.Join(dir, "calcctl")
+}
+
+// loadConfig reads the config at path, a missing file standing for an
+// empty config.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// save writes the config to path, readable by the user only as it holds
+// the token.
+func (c *config) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
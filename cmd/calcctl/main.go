@@ -0,0 +1,222 @@
+// Command calcctl is a command-line client of the orchestrator.
+//
+//	calcctl [-server URL] [-config FILE] [-json] <command> [arguments]
+//
+// Without a command, it starts an interactive shell.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gitgernit/go-calculator/pkg/client"
+	"github.com/google/uuid"
+)
+
+// app is the state shared by the commands of a run or a shell session.
+type app struct {
+	client     *client.Client
+	config     *config
+	configPath string
+	json       bool
+
+	in  *bufio.Reader
+	out io.Writer
+	// lastID is the id of the last submitted expression, which commands
+	// taking an id accept as "last".
+	lastID uuid.UUID
+}
+
+type command struct {
+	usage   string
+	summary string
+	run     func(a *app, ctx context.Context, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"register": {"register <login> [password]", "create a user and log in as it", (*app).register},
+		"login":    {"login <login> [password]", "log in, storing the token in the config", (*app).login},
+		"logout":   {"logout", "forget the stored token", (*app).logout},
+		"calc":     {"calc [-wait] [-priority p] [-deadline t] [-no-simulate] <expression>", "submit an expression", (*app).calc},
+		"get":      {"get [-steps] <id|last>", "show an expression", (*app).get},
+		"list":     {"list [-status s] [-q text] [-sort field] [-limit n] [-cursor c]", "list expressions, most recent first", (*app).list},
+		"cancel":   {"cancel <id|last>", "stop solving an expression", (*app).cancel},
+		"usage":    {"usage", "show the usage and limits of the user", (*app).usage},
+		"repl":     {"repl", "start an interactive shell", (*app).repl},
+		"help":     {"help", "list the commands", (*app).help},
+	}
+}
+
+func main() {
+	server := flag.String("server", os.Getenv("CALCCTL_SERVER"), "orchestrator URL, "+defaultServer+" unless stored in the config")
+	configPath := flag.String("config", os.Getenv("CALCCTL_CONFIG"), "config file, "+filepath.Join(defaultConfigDir(), "config.json")+" by default")
+	jsonOutput := flag.Bool("json", false, "print responses as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: calcctl [flags] <command> [arguments]\n\nflags:\n")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		printCommands(flag.CommandLine.Output())
+	}
+	flag.Parse()
+
+	a, err := newApp(*server, *configPath, *jsonOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "calcctl: %v\n", err)
+		os.Exit(1)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"repl"}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if args[0] == "repl" {
+		// The shell handles interrupts itself, cancelling the command
+		// being run.
+		stop()
+		ctx = context.Background()
+	}
+
+	if err := a.run(ctx, args); err != nil {
+		fmt.Fprintf(os.Stderr, "calcctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func newApp(server, configPath string, jsonOutput bool) (*app, error) {
+	if configPath == "" {
+		configPath = filepath.Join(defaultConfigDir(), "config.json")
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	switch {
+	case server != "":
+	case cfg.Server != "":
+		server = cfg.Server
+	default:
+		server = defaultServer
+	}
+
+	c := client.New(server)
+	c.SetToken(cfg.Token)
+
+	return &app{
+		client:     c,
+		config:     cfg,
+		configPath: configPath,
+		json:       jsonOutput,
+		in:         bufio.NewReader(os.Stdin),
+		out:        os.Stdout,
+	}, nil
+}
+
+var errUsage = errors.New("invalid usage")
+
+// run runs the command named by the first argument.
+func (a *app) run(ctx context.Context, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see calcctl help", args[0])
+	}
+
+	err := cmd.run(a, ctx, args[1:])
+	if errors.Is(err, errUsage) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	return err
+}
+
+func (a *app) help(ctx context.Context, args []string) error {
+	printCommands(a.out)
+	return nil
+}
+
+func printCommands(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-70s %s\n", commands[name].usage, commands[name].summary)
+	}
+}
+
+// parseFlags parses the flags of a command, which may come before or after
+// its positional arguments, returning the latter. Arguments after "--" are
+// never taken for flags, so expressions starting with "-" may follow it.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return append(positional, rest...), nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// parseID parses the id of an expression, "last" standing for the one
+// submitted last.
+func (a *app) parseID(value string) (uuid.UUID, error) {
+	if strings.EqualFold(value, "last") {
+		if a.lastID == uuid.Nil {
+			return uuid.Nil, errors.New("no expression has been submitted yet")
+		}
+		return a.lastID, nil
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid id %q", value)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxHistory bounds the lines of history kept.
+const maxHistory = 1000
+
+const replHelp = `Type a command, or an expression to solve it and wait for the result.
+  history    list the lines entered
+  !!, !n     run the last line or line n of the history again
+  exit       leave the shell
+`
+
+// repl runs the lines read from the input as commands until it ends. Lines
+// which aren't commands are solved as expressions. An interrupt cancels
+// the command being run rather than the shell.
+func (a *app) repl(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	history := newHistory(filepath.Join(filepath.Dir(a.configPath), "history"))
+
+	var mutex sync.Mutex
+	var cancel context.CancelFunc
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	go func() {
+		for range interrupts {
+			mutex.Lock()
+			if cancel != nil {
+				cancel()
+			} else {
+				fmt.Fprint(a.out, "\n(type exit to leave)\ncalc> ")
+			}
+			mutex.Unlock()
+		}
+	}()
+
+	if a.config.Login != "" {
+		fmt.Fprintf(a.out, "logged in as %s at %s, type help for the commands\n", a.config.Login, a.client.BaseURL)
+	} else {
+		fmt.Fprintf(a.out, "connected to %s, log in or register to start, type help for the commands\n", a.client.BaseURL)
+	}
+
+	for {
+		fmt.Fprint(a.out, "calc> ")
+
+		line, err := a.in.ReadString('\n')
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return err
+			}
+			if line == "" {
+				fmt.Fprintln(a.out)
+				return nil
+			}
+		}
+
+		line, err = history.expand(strings.TrimSpace(line))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		words, err := splitWords(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		// Passwords given as arguments aren't worth keeping around.
+		if !(len(words) > 2 && (words[0] == "login" || words[0] == "register")) {
+			history.add(line)
+		}
+
+		switch words[0] {
+		case "exit", "quit":
+			return nil
+
+		case "history":
+			history.print(a.out)
+			continue
+
+		case "help":
+			fmt.Fprint(a.out, replHelp)
+			printCommands(a.out)
+			continue
+
+		case "repl":
+			continue
+		}
+
+		if _, ok := commands[words[0]]; !ok {
+			words = []string{"calc", "-wait", "--", line}
+		}
+
+		mutex.Lock()
+		commandCtx, cancelCommand := context.WithCancel(ctx)
+		cancel = cancelCommand
+		mutex.Unlock()
+
+		err = a.run(commandCtx, words)
+
+		mutex.Lock()
+		cancel = nil
+		mutex.Unlock()
+		cancelCommand()
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// splitWords splits a line into words separated by spaces, keeping quoted
+// text together.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// history holds the lines entered in the shell, appending them to a file
+// so they're kept across sessions.
+type history struct {
+	path  string
+	lines []string
+}
+
+func newHistory(path string) *history {
+	h := &history{path: path}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	h.lines = h.lines[max(0, len(h.lines)-maxHistory):]
+
+	return h
+}
+
+func (h *history) add(line string) {
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+
+	// The history is a convenience, so failing to store it isn't worth
+	// interrupting the session for.
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintln(file, line)
+}
+
+// expand replaces "!!" and "!n" with the last and the n-th line of the
+// history.
+func (h *history) expand(line string) (string, error) {
+	if !strings.HasPrefix(line, "!") || line == "!" {
+		return line, nil
+	}
+
+	if line == "!!" {
+		if len(h.lines) == 0 {
+			return "", errors.New("history is empty")
+		}
+		return h.lines[len(h.lines)-1], nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(h.lines) {
+		return "", fmt.Errorf("no line %s in history", line[1:])
+	}
+
+	return h.lines[n-1], nil
+}
+
+func (h *history) print(w io.Writer) {
+	for i, line := range h.lines {
+		fmt.Fprintf(w, "%5d  %s\n", i+1, line)
+	}
+}
@@ -0,0 +1,89 @@
+// Command calculator runs the parts of the calculator service.
+//
+//	calculator orchestrator [config flags]
+//	calculator agent http|grpc [config flags]
+//	calculator all-in-one [config flags]
+//
+// all-in-one runs the orchestrator along with agent workers in the same
+// process, for local development and small deployments. Config flags are
+// listed with -help after the command.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gitgernit/go-calculator/internal/app"
+	appconfig "github.com/gitgernit/go-calculator/internal/config"
+)
+
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, config *appconfig.Config) error
+}
+
+var commands = []struct {
+	args []string
+	command
+}{
+	{[]string{"orchestrator"}, command{"orchestrator", "run the orchestrator", app.RunOrchestrator}},
+	{[]string{"agent", "http"}, command{"agent http", "run an agent polling the orchestrator over HTTP", app.RunHTTPAgent}},
+	{[]string{"agent", "grpc"}, command{"agent grpc", "run an agent streaming steps from the orchestrator over gRPC", app.RunGRPCAgent}},
+	{[]string{"all-in-one"}, command{"all-in-one", "run the orchestrator with embedded agent workers", app.RunAllInOne}},
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: calculator <command> [config flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.usage, c.summary)
+	}
+}
+
+// findCommand returns the command named by the first arguments, along with
+// the arguments left.
+func findCommand(args []string) (command, []string, bool) {
+	for _, c := range commands {
+		if len(args) < len(c.args) {
+			continue
+		}
+
+		matches := true
+		for i, arg := range c.args {
+			matches = matches && args[i] == arg
+		}
+		if matches {
+			return c.command, args[len(c.args):], true
+		}
+	}
+
+	return command{}, nil, false
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 1 && (args[0] == "help" || args[0] == "-help" || args[0] == "-h") {
+		printUsage(os.Stdout)
+		return
+	}
+
+	cmd, args, ok := findCommand(args)
+	if !ok {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+
+	config := appconfig.FromArgs(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, config); err != nil {
+		fmt.Fprintf(os.Stderr, "calculator: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	appconfig "github.com/gitgernit/go-calculator/internal/config"
+	"github.com/gitgernit/go-calculator/internal/domain/agent"
+	"github.com/gitgernit/go-calculator/internal/infra/certs"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	grpcagent "github.com/gitgernit/go-calculator/internal/transport/grpc/agent"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
+	httpagent "github.com/gitgernit/go-calculator/internal/transport/http/agent"
+)
+
+// setup sets up logging and tracing for the service, returning the function
+// shutting tracing down.
+func setup(ctx context.Context, config *appconfig.Config, service string) (func(context.Context) error, error) {
+	if err := logging.Setup(config.LogLevel, config.LogFormat); err != nil {
+		return nil, err
+	}
+
+	return tracing.Setup(ctx, config.Tracing(service))
+}
+
+// agentID returns the id of the agent, the default one if it isn't
+// configured.
+func agentID(config *appconfig.Config) string {
+	if config.AgentID == "" {
+		return agent.DefaultID()
+	}
+
+	return config.AgentID
+}
+
+// connectedPoller is a poller connected to the orchestrator over the
+// network.
+type connectedPoller interface {
+	agent.ExpressionPoller
+	CheckConnection(ctx context.Context) error
+}
+
+// newPoller creates the poller of an agent, connecting with tlsConfig and
+// advertising the operators.
+type newPoller func(config *appconfig.Config, operators []string, tlsConfig *tls.Config) (connectedPoller, error)
+
+// runAgent solves steps received through the poller until ctx is done,
+// serving its health and metrics meanwhile.
+func runAgent(ctx context.Context, config *appconfig.Config, newPoller newPoller) error {
+	shutdownTracing, err := setup(ctx, config, "agent")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	config.AgentID = agentID(config)
+	slog.SetDefault(slog.Default().With("agent_id", config.AgentID))
+
+	evaluators := agent.NewDefaultRegistry()
+
+	agentTLS, err := certs.Load(ctx, config.AgentTLS())
+	if err != nil {
+		return err
+	}
+
+	poller, err := newPoller(config, evaluators.Operators(), agentTLS.ClientConfig(config.OrchestratorHost))
+	if err != nil {
+		return err
+	}
+	if closer, ok := poller.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	checker := health.NewChecker()
+	checker.Register("orchestrator", poller.CheckConnection)
+
+	for _, server := range transporthttp.NewAgentServers(*config, checker) {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("server stopped", "addr", server.Addr, "error", err)
+			}
+		}()
+		defer server.Close()
+	}
+
+	interactor := agent.Interactor{
+		Poller:     poller,
+		Evaluators: evaluators,
+	}
+
+	return interactor.StartPolling(ctx, config.ComputingPower)
+}
+
+// RunHTTPAgent runs an agent polling the orchestrator over HTTP until ctx
+// is done.
+func RunHTTPAgent(ctx context.Context, config *appconfig.Config) error {
+	return runAgent(ctx, config, func(config *appconfig.Config, operators []string, tlsConfig *tls.Config) (connectedPoller, error) {
+		return &httpagent.ExpressionPoller{
+			Config:    *config,
+			Operators: operators,
+			TLS:       tlsConfig,
+		}, nil
+	})
+}
+
+// RunGRPCAgent runs an agent receiving steps from the orchestrator over a
+// gRPC stream until ctx is done.
+func RunGRPCAgent(ctx context.Context, config *appconfig.Config) error {
+	return runAgent(ctx, config, func(config *appconfig.Config, operators []string, tlsConfig *tls.Config) (connectedPoller, error) {
+		return grpcagent.NewGRPCPoller(
+			config.OrchestratorHost,
+			strconv.Itoa(config.OrchestratorGRPCPort),
+			config.AgentID,
+			config.ComputingPower,
+			operators,
+			tlsConfig,
+		)
+	})
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	appconfig "github.com/gitgernit/go-calculator/internal/config"
+	"github.com/gitgernit/go-calculator/internal/domain/agent"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/transport/memory"
+)
+
+// RunAllInOne runs the orchestrator along with COMPUTING_POWER agent
+// workers in the same process, which receive steps straight from the
+// orchestrator instead of over the network. It runs until ctx is done or
+// the orchestrator fails, then waits for the workers to finish their steps.
+func RunAllInOne(ctx context.Context, config *appconfig.Config) error {
+	shutdownTracing, err := setup(ctx, config, "calculator")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	o, err := NewOrchestrator(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	id := agentID(config)
+	evaluators := agent.NewDefaultRegistry()
+
+	poller := memory.NewPoller(o.Interactor, id, evaluators.Operators())
+	defer poller.Close()
+
+	workers := agent.Interactor{
+		Poller:     poller,
+		Evaluators: evaluators,
+	}
+
+	polling := make(chan error, 1)
+	go func() {
+		polling <- workers.StartPolling(logging.WithAgentID(ctx, id), config.ComputingPower)
+	}()
+	slog.InfoContext(ctx, "running embedded agent", "agent_id", id, "workers", config.ComputingPower)
+
+	err = o.Serve(ctx)
+
+	cancel()
+	if pollingErr := <-polling; err == nil {
+		err = pollingErr
+	}
+
+	return err
+}
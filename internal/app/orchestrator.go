@@ -0,0 +1,182 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	appconfig "github.com/gitgernit/go-calculator/internal/config"
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	"github.com/gitgernit/go-calculator/internal/infra/certs"
+	"github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	grpccalculator "github.com/gitgernit/go-calculator/internal/transport/grpc/calculator"
+	grpcorchestrator "github.com/gitgernit/go-calculator/internal/transport/grpc/orchestrator"
+	httporchestrator "github.com/gitgernit/go-calculator/internal/transport/http/orchestrator"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Orchestrator is an orchestrator ready to serve its HTTP and gRPC APIs.
+type Orchestrator struct {
+	Interactor *orchestrator.Interactor
+
+	config        *appconfig.Config
+	users         *auth.UserInteractor
+	limiter       *quota.RateLimiter
+	checker       *health.Checker
+	serverTLS     *certs.Reloader
+	grpcListening *health.Flag
+}
+
+// NewOrchestrator opens the database and sets up the orchestrator, expiring
+// overdue expressions and reloading certificates until ctx is done.
+func NewOrchestrator(ctx context.Context, config *appconfig.Config) (*Orchestrator, error) {
+	if err := gorm.Open(config.Database()); err != nil {
+		return nil, err
+	}
+	gorm.UseLogger(slog.Default())
+
+	if err := gorm.Initialize(); err != nil {
+		return nil, err
+	}
+
+	costs, err := orchestrator.NewCostModel(config.CostModel, config.OperationTimes(), time.Duration(config.TimePerDigitMS)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	var interactor *orchestrator.Interactor
+	if config.SharesQueue() {
+		interactor = orchestrator.NewSharedInteractor(config.Limits(), costs, config.SharedQueue())
+	} else {
+		scheduler, err := orchestrator.NewScheduler(config.Scheduler)
+		if err != nil {
+			return nil, err
+		}
+
+		interactor = orchestrator.NewOrchestratorInteractor(config.Limits(), scheduler, costs)
+		interactor.LeaseSteps(time.Duration(config.StepLeaseMS) * time.Millisecond)
+	}
+	if err := interactor.RestoreSettings(ctx); err != nil {
+		return nil, err
+	}
+	interactor.CacheResults(config.ResultCacheSize)
+	go interactor.StartExpiring(ctx, time.Second)
+
+	serverTLS, err := certs.Load(ctx, config.ServerTLS())
+	if err != nil {
+		return nil, err
+	}
+
+	grpcListening := health.NewFlag(errors.New("gRPC listener is not up"))
+	checker := health.NewChecker()
+	checker.Register("database", gorm.Ping)
+	checker.Register("migrations", gorm.CheckMigrations)
+	checker.Register("grpc", grpcListening.Check)
+
+	users := &auth.UserInteractor{JWTSecretKey: config.JWTSecretKey, Admins: config.Admins()}
+	if err := users.CreateAdmins(config.AdminPassword); err != nil {
+		return nil, err
+	}
+
+	return &Orchestrator{
+		Interactor:    interactor,
+		config:        config,
+		users:         users,
+		limiter:       quota.NewRateLimiter(interactor.Limits),
+		checker:       checker,
+		serverTLS:     serverTLS,
+		grpcListening: grpcListening,
+	}, nil
+}
+
+func (o *Orchestrator) newGRPCServer(ctx context.Context) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainStreamInterceptor(grpcorchestrator.StreamLoggingInterceptor, grpccalculator.StreamAuthInterceptor(o.users)),
+		grpc.UnaryInterceptor(grpccalculator.UnaryAuthInterceptor(o.users)),
+	}
+	if tlsConfig := o.serverTLS.ServerConfig(); tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	grpcServer := grpc.NewServer(options...)
+	grpcorchestrator.RegisterService(grpcServer, o.Interactor)
+	grpccalculator.RegisterService(grpcServer, grpccalculator.NewServer(o.Interactor, o.users, o.limiter))
+
+	o.grpcListening.Set(true)
+	grpcorchestrator.RegisterHealthService(ctx, grpcServer, o.checker, 5*time.Second)
+
+	return grpcServer
+}
+
+// Serve serves the HTTP and gRPC APIs until ctx is done or either of them
+// fails, stopping the other one.
+func (o *Orchestrator) Serve(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", o.config.OrchestratorHost, o.config.OrchestratorGRPCPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	httpServer := httporchestrator.NewHTTPServer(o.Interactor, o.users, o.limiter, o.checker, o.config.OrchestratorHost, strconv.Itoa(o.config.OrchestratorPort))
+	httpServer.TLSConfig = o.serverTLS.ServerConfig()
+
+	serveHTTP := httpServer.ListenAndServe
+	if httpServer.TLSConfig != nil {
+		serveHTTP = func() error { return httpServer.ListenAndServeTLS("", "") }
+	}
+
+	grpcServer := o.newGRPCServer(ctx)
+
+	errs := make(chan error, 2)
+	go func() {
+		if err := serveHTTP(); err != nil && err != http.ErrServerClosed {
+			errs <- err
+			return
+		}
+		errs <- nil
+	}()
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			errs <- fmt.Errorf("failed to serve: %w", err)
+			return
+		}
+		errs <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	o.grpcListening.Set(false)
+	httpServer.Close()
+	grpcServer.Stop()
+
+	return err
+}
+
+// RunOrchestrator runs the orchestrator until ctx is done or it fails.
+func RunOrchestrator(ctx context.Context, config *appconfig.Config) error {
+	shutdownTracing, err := setup(ctx, config, "orchestrator")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	o, err := NewOrchestrator(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	return o.Serve(ctx)
+}
@@ -1,34 +1,228 @@
 package config
 
 import (
-	"github.com/ilyakaznacheev/cleanenv"
-	"github.com/joho/godotenv"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	"github.com/gitgernit/go-calculator/internal/infra/certs"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	TimeAdditionMS        int    `env:"TIME_ADDITION_MS" env-default:"100"`
-	TimeSubtractionMS     int    `env:"TIME_SUBTRACTION_MS" env-default:"100"`
-	TimeMultiplicationsMS int    `env:"TIME_MULTIPLICATIONS_MS" env-default:"100"`
-	TimeDivisionsMS       int    `env:"TIME_DIVISIONS_MS" env-default:"100"`
-	ComputingPower        int    `env:"COMPUTING_POWER" env-default:"4"`
-	OrchestratorPort      int    `env:"ORCHESTRATOR_PORT" env-default:"8080"`
-	OrchestratorGRPCPort  int    `env:"ORCHESTRATOR_GRPC_PORT" env-defualt:"8081"`
-	OrchestratorHost      string `env:"ORCHESTRATOR_HOST" env-default:"0.0.0.0"`
-	PollingIntervalMS     int    `env:"POLLING_INTERVAL" env-default:"250"`
-	JWTSecretKey          string `env:"JWT_SECRET_KEY" env-default:"supersecret"`
-}
-
-func New() (*Config, error) {
-	if err := godotenv.Load("./configs/.env"); err != nil {
-		return nil, err
+	TimeAdditionMS         int     `env:"TIME_ADDITION_MS" env-default:"100"`
+	TimeSubtractionMS      int     `env:"TIME_SUBTRACTION_MS" env-default:"100"`
+	TimeMultiplicationsMS  int     `env:"TIME_MULTIPLICATIONS_MS" env-default:"100"`
+	TimeDivisionsMS        int     `env:"TIME_DIVISIONS_MS" env-default:"100"`
+	TimePerDigitMS         int     `env:"TIME_PER_DIGIT_MS" env-default:"0"`
+	CostModel              string  `env:"COST_MODEL" env-default:"operator"`
+	ComputingPower         int     `env:"COMPUTING_POWER" env-default:"4"`
+	OrchestratorPort       int     `env:"ORCHESTRATOR_PORT" env-default:"8080"`
+	OrchestratorGRPCPort   int     `env:"ORCHESTRATOR_GRPC_PORT" env-default:"8081"`
+	OrchestratorHost       string  `env:"ORCHESTRATOR_HOST" env-default:"0.0.0.0"`
+	PollingIntervalMS      int     `env:"POLLING_INTERVAL_MS" env-default:"250"`
+	PollingWaitMS          int     `env:"POLLING_WAIT_MS" env-default:"30000"`
+	JWTSecretKey           string  `env:"JWT_SECRET_KEY" env-default:"supersecret"`
+	DatabasePath           string  `env:"DATABASE_PATH" env-default:"calculator.db"`
+	DatabaseURL            string  `env:"DATABASE_URL" env-default:""`
+	Queue                  string  `env:"QUEUE" env-default:"memory"`
+	NodeID                 string  `env:"NODE_ID" env-default:""`
+	LeaseTTLMS             int     `env:"LEASE_TTL_MS" env-default:"10000"`
+	StepLeaseMS            int     `env:"STEP_LEASE_MS" env-default:"60000"`
+	AdminUsers             string  `env:"ADMIN_USERS" env-default:""`
+	AdminPassword          string  `env:"ADMIN_PASSWORD" env-default:""`
+	RateLimitRPS           float64 `env:"RATE_LIMIT_RPS" env-default:"10"`
+	RateLimitBurst         int     `env:"RATE_LIMIT_BURST" env-default:"20"`
+	MaxPendingExpressions  int     `env:"MAX_PENDING_EXPRESSIONS" env-default:"100"`
+	MaxExpressionLength    int     `env:"MAX_EXPRESSION_LENGTH" env-default:"1024"`
+	MaxExpressionOperators int     `env:"MAX_EXPRESSION_OPERATORS" env-default:"256"`
+	Scheduler              string  `env:"SCHEDULER" env-default:"fair"`
+	ResultCacheSize        int     `env:"RESULT_CACHE_SIZE" env-default:"1000"`
+	LogLevel               string  `env:"LOG_LEVEL" env-default:"info"`
+	LogFormat              string  `env:"LOG_FORMAT" env-default:"json"`
+	AgentID                string  `env:"AGENT_ID" env-default:""`
+	AgentMetricsHost       string  `env:"AGENT_METRICS_HOST" env-default:"0.0.0.0"`
+	AgentMetricsPort       int     `env:"AGENT_METRICS_PORT" env-default:"0"`
+	AgentHealthHost        string  `env:"AGENT_HEALTH_HOST" env-default:"0.0.0.0"`
+	AgentHealthPort        int     `env:"AGENT_HEALTH_PORT" env-default:"0"`
+	TracingExporter        string  `env:"TRACING_EXPORTER" env-default:"none"`
+	TracingEndpoint        string  `env:"TRACING_ENDPOINT" env-default:"localhost:4318"`
+	TracingFile            string  `env:"TRACING_FILE" env-default:""`
+	TLSCertFile            string  `env:"TLS_CERT_FILE" env-default:""`
+	TLSKeyFile             string  `env:"TLS_KEY_FILE" env-default:""`
+	TLSClientCAFile        string  `env:"TLS_CLIENT_CA_FILE" env-default:""`
+	TLSReloadIntervalMS    int     `env:"TLS_RELOAD_INTERVAL_MS" env-default:"10000"`
+	AgentTLSEnabled        bool    `env:"AGENT_TLS" env-default:"false"`
+	AgentTLSCAFile         string  `env:"AGENT_TLS_CA_FILE" env-default:""`
+	AgentTLSCertFile       string  `env:"AGENT_TLS_CERT_FILE" env-default:""`
+	AgentTLSKeyFile        string  `env:"AGENT_TLS_KEY_FILE" env-default:""`
+	AgentTLSServerName     string  `env:"AGENT_TLS_SERVER_NAME" env-default:""`
+
+	// printConfig is set by -print-config.
+	printConfig bool
+}
+
+// OperationTimes are the times the steps of each operator are simulated to
+// take.
+func (c *Config) OperationTimes() map[string]time.Duration {
+	return map[string]time.Duration{
+		"+": time.Duration(c.TimeAdditionMS) * time.Millisecond,
+		"-": time.Duration(c.TimeSubtractionMS) * time.Millisecond,
+		"*": time.Duration(c.TimeMultiplicationsMS) * time.Millisecond,
+		"/": time.Duration(c.TimeDivisionsMS) * time.Millisecond,
+	}
+}
+
+// Admins are the logins of the users allowed to change settings at
+// runtime, separated by commas in ADMIN_USERS.
+func (c *Config) Admins() []string {
+	var admins []string
+	for _, login := range strings.Split(c.AdminUsers, ",") {
+		if login = strings.TrimSpace(login); login != "" {
+			admins = append(admins, login)
+		}
+	}
+
+	return admins
+}
+
+// Database is the PostgreSQL URL given with DATABASE_URL, or the path of
+// the SQLite database otherwise.
+func (c *Config) Database() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+
+	return c.DatabasePath
+}
+
+// SharesQueue reports whether the queue is stored in the database, shared
+// with the other orchestrators running against it.
+func (c *Config) SharesQueue() bool {
+	return c.Queue == "database"
+}
+
+// SharedQueue is the config of the queue shared by the orchestrators
+// running against the database with QUEUE=database. Orchestrators are
+// identified by their host and process unless given NODE_ID.
+func (c *Config) SharedQueue() orchestrator.SharedQueueConfig {
+	node := c.NodeID
+	if node == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "orchestrator"
+		}
+		node = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	return orchestrator.SharedQueueConfig{
+		Node:      node,
+		LeaseTTL:  time.Duration(c.LeaseTTLMS) * time.Millisecond,
+		StepLease: time.Duration(c.StepLeaseMS) * time.Millisecond,
 	}
+}
 
-	cfg := Config{}
-	err := cleanenv.ReadEnv(&cfg)
+func (c *Config) Limits() quota.Limits {
+	return quota.Limits{
+		RequestsPerSecond: c.RateLimitRPS,
+		Burst:             c.RateLimitBurst,
+		MaxPending:        c.MaxPendingExpressions,
+		MaxLength:         c.MaxExpressionLength,
+		MaxOperators:      c.MaxExpressionOperators,
+	}
+}
 
+func (c *Config) Tracing(serviceName string) tracing.Config {
+	return tracing.Config{
+		ServiceName: serviceName,
+		Exporter:    c.TracingExporter,
+		Endpoint:    c.TracingEndpoint,
+		File:        c.TracingFile,
+	}
+}
+
+// ServerTLS is the TLS config of the orchestrator listeners, which serve
+// TLS once given a certificate and require client certificates once given
+// a client CA.
+func (c *Config) ServerTLS() certs.Config {
+	return certs.Config{
+		Enabled:        c.TLSCertFile != "",
+		CertFile:       c.TLSCertFile,
+		KeyFile:        c.TLSKeyFile,
+		CAFile:         c.TLSClientCAFile,
+		ReloadInterval: time.Duration(c.TLSReloadIntervalMS) * time.Millisecond,
+	}
+}
+
+// AgentTLS is the TLS config agents connect to the orchestrator with,
+// enabled by AGENT_TLS or by giving a CA bundle or a client certificate.
+func (c *Config) AgentTLS() certs.Config {
+	return certs.Config{
+		Enabled:        c.AgentTLSEnabled || c.AgentTLSCAFile != "" || c.AgentTLSCertFile != "",
+		CertFile:       c.AgentTLSCertFile,
+		KeyFile:        c.AgentTLSKeyFile,
+		CAFile:         c.AgentTLSCAFile,
+		ServerName:     c.AgentTLSServerName,
+		ReloadInterval: time.Duration(c.TLSReloadIntervalMS) * time.Millisecond,
+	}
+}
+
+// New loads the config from, in increasing order of precedence, the
+// defaults, the config file given with -config or CONFIG_FILE, the .env file
+// given with -env-file, the environment and the command line flags in args.
+// The config is validated once loaded.
+func New(args []string) (*Config, error) {
+	cfg := &Config{}
+
+	flags, err := newFlagSet(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", flags.Arg(0))
+	}
+
+	// Settings which failed to load keep their previous value, so the
+	// others can still be validated and every error reported at once.
+	if err := errors.Join(cfg.load(flags), cfg.Validate()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// FromCommandLine loads the config from the arguments of the process. It
+// exits the process if the config is invalid, or once it has printed the
+// config if asked to with -print-config.
+func FromCommandLine() *Config {
+	return FromArgs(os.Args[1:])
+}
+
+// FromArgs loads the config like FromCommandLine does, from args instead of
+// the arguments of the process.
+func FromArgs(args []string) *Config {
+	cfg, err := New(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s: invalid config:\n%v\n", filepath.Base(os.Args[0]), err)
+		os.Exit(2)
+	}
+
+	if cfg.printConfig {
+		cfg.Print(os.Stdout)
+		os.Exit(0)
+	}
 
-	return &cfg, nil
+	return cfg
 }
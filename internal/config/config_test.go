@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFile writes a file with the content to a temporary directory.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+
+	return path
+}
+
+// noEnvFile makes the arguments skip the default .env file.
+func noEnvFile(t *testing.T, args ...string) []string {
+	return append([]string{"-env-file", writeTestFile(t, ".env", "")}, args...)
+}
+
+func TestNewAppliesDefaults(t *testing.T) {
+	cfg, err := New(noEnvFile(t))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.OrchestratorPort != 8080 || cfg.OrchestratorGRPCPort != 8081 || cfg.PollingIntervalMS != 250 {
+		t.Errorf("got ports %d and %d, polling interval %d, want the defaults",
+			cfg.OrchestratorPort, cfg.OrchestratorGRPCPort, cfg.PollingIntervalMS)
+	}
+}
+
+func TestNewLayersSources(t *testing.T) {
+	configFile := writeTestFile(t, "config.yaml", `
+orchestrator_port: 9000
+orchestrator_grpc_port: 9001
+scheduler: fifo
+rate_limit_rps: 0
+log_level: debug
+`)
+	envFile := writeTestFile(t, ".env", "ORCHESTRATOR_GRPC_PORT=9002\nLOG_LEVEL=warn\n")
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("COMPUTING_POWER", "8")
+
+	cfg, err := New([]string{"-config", configFile, "-env-file", envFile, "-computing-power", "16"})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.OrchestratorPort != 9000 || cfg.Scheduler != "fifo" {
+		t.Errorf("got port %d and scheduler %q, want the ones of the config file", cfg.OrchestratorPort, cfg.Scheduler)
+	}
+	if cfg.RateLimitRPS != 0 {
+		t.Errorf("got rate limit %v, want the 0 of the config file over the default", cfg.RateLimitRPS)
+	}
+	if cfg.OrchestratorGRPCPort != 9002 {
+		t.Errorf("got gRPC port %d, want the one of the .env file", cfg.OrchestratorGRPCPort)
+	}
+	if cfg.LogLevel != "error" {
+		t.Errorf("got log level %q, want the one of the environment", cfg.LogLevel)
+	}
+	if cfg.ComputingPower != 16 {
+		t.Errorf("got computing power %d, want the one of the flag", cfg.ComputingPower)
+	}
+}
+
+func TestNewSkipsDefaultEnvFileWithConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "configs"), 0o700); err != nil {
+		t.Fatalf("failed to create configs: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, DefaultEnvFile), []byte("SCHEDULER=fair\nCOMPUTING_POWER=8\n"), 0o600); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg, err := New(nil)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.ComputingPower != 8 {
+		t.Errorf("got computing power %d, want the one of the default .env file", cfg.ComputingPower)
+	}
+
+	cfg, err = New([]string{"-config", writeTestFile(t, "config.yaml", "scheduler: fifo\n")})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Scheduler != "fifo" || cfg.ComputingPower != 4 {
+		t.Errorf("got scheduler %q and computing power %d, want the config file and defaults over the default .env file", cfg.Scheduler, cfg.ComputingPower)
+	}
+
+	cfg, err = New([]string{"-config", writeTestFile(t, "config.yaml", "scheduler: fifo\n"), "-env-file", DefaultEnvFile})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Scheduler != "fair" {
+		t.Errorf("got scheduler %q, want the one of the .env file given explicitly", cfg.Scheduler)
+	}
+}
+
+func TestNewReadsTOML(t *testing.T) {
+	t.Setenv(ConfigFileVariable, writeTestFile(t, "config.toml", "SCHEDULER = \"fifo\"\nAGENT_TLS = true\n"))
+
+	cfg, err := New(noEnvFile(t))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.Scheduler != "fifo" || !cfg.AgentTLSEnabled {
+		t.Errorf("got scheduler %q and agent TLS %v, want the ones of the config file", cfg.Scheduler, cfg.AgentTLSEnabled)
+	}
+}
+
+func TestNewReportsEveryError(t *testing.T) {
+	configFile := writeTestFile(t, "config.yaml", "orchestrator_prot: 9000\n")
+	t.Setenv("COMPUTING_POWER", "many")
+
+	_, err := New([]string{"-config", configFile, "-env-file", writeTestFile(t, ".env", ""),
+		"-scheduler", "lifo", "-tls-key-file", "key.pem", "-queue", "redis", "-database-url", "mysql://localhost/calculator"})
+	if err == nil {
+		t.Fatal("expected invalid config to be rejected")
+	}
+
+	for _, want := range []string{
+		"unknown setting orchestrator_prot",
+		`COMPUTING_POWER: expected an integer, got "many"`,
+		`SCHEDULER: expected one of [fair fifo], got "lifo"`,
+		"TLS_CERT_FILE: required along with TLS_KEY_FILE",
+		`QUEUE: expected one of [memory database], got "redis"`,
+		`DATABASE_URL: expected a postgres:// URL, got "mysql://localhost/calculator"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %q, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestNewRequiresExplicitEnvFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), ".env")
+
+	if _, err := New([]string{"-env-file", missing}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want the missing .env file to be reported", err)
+	}
+}
+
+func TestPrintedConfigLoadsBack(t *testing.T) {
+	cfg, err := New(noEnvFile(t, "-scheduler", "fifo", "-tls-cert-file", "cert.pem", "-tls-key-file", "key.pem", "-rate-limit-rps", "2.5", "-admin-users", "root", "-admin-password", "hunter2"))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	var printed bytes.Buffer
+	cfg.Print(&printed)
+
+	if strings.Contains(printed.String(), cfg.JWTSecretKey) || strings.Contains(printed.String(), cfg.AdminPassword) {
+		t.Error("expected the JWT secret and the admin password to be left out")
+	}
+
+	loaded, err := New(noEnvFile(t, "-config", writeTestFile(t, "config.yaml", printed.String())))
+	if err != nil {
+		t.Fatalf("failed to load printed config: %v", err)
+	}
+
+	loaded.JWTSecretKey, loaded.AdminPassword = cfg.JWTSecretKey, cfg.AdminPassword
+	if *loaded != *cfg {
+		t.Errorf("got %+v, want %+v", loaded, cfg)
+	}
+}
+
+func TestPrintLeavesDatabasePasswordOut(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"postgres://calculator:hunter2@db:5432/calculator", "postgres://calculator:xxxxx@db:5432/calculator"},
+		{"postgres://db/calculator?password=hunter2&user=calculator", "postgres://db/calculator?password=xxxxx&user=calculator"},
+		{"postgres://calculator@db/calculator", "postgres://calculator@db/calculator"},
+	}
+
+	for _, tt := range tests {
+		cfg, err := New(noEnvFile(t, "-database-url", tt.url))
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+
+		var printed bytes.Buffer
+		cfg.Print(&printed)
+
+		if strings.Contains(printed.String(), "hunter2") {
+			t.Errorf("%s: expected the password to be left out, got\n%s", tt.url, printed.String())
+		}
+		if !strings.Contains(printed.String(), `database_url: "`+tt.want+`"`) {
+			t.Errorf("%s: expected the URL to be printed as %s, got\n%s", tt.url, tt.want, printed.String())
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	for _, test := range []struct {
+		raw, want string
+	}{
+		{"", ""},
+		{"postgres://calculator:hunter2@db/calculator", "postgres://calculator:xxxxx@db/calculator"},
+		{"postgres://calculator:hunter2@db/%zz", "xxxxx"},
+		{"calculator:hunter2@db/calculator", "xxxxx"},
+		{"host=db user=calculator password=hunter2 dbname=calculator", "host=db user=calculator password=xxxxx dbname=calculator"},
+		{"host=db password = 'hunter 2' dbname=calculator", "host=db password = xxxxx dbname=calculator"},
+		{"host=db PASSWORD='it\\'s hunter2'", "host=db PASSWORD=xxxxx"},
+	} {
+		if got := redactURL(test.raw); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.raw, got, test.want)
+		}
+	}
+}
+
+func TestValidationLeavesDatabasePasswordOut(t *testing.T) {
+	for _, url := range []string{"host=db password=hunter2", "mysql://calculator:hunter2@db/calculator", "postgres//calculator:hunter2@db"} {
+		_, err := New(noEnvFile(t, "-database-url", url))
+		if err == nil {
+			t.Fatalf("%s: expected the URL to be rejected", url)
+		}
+		if strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("%s: expected the password to be left out, got %v", url, err)
+		}
+	}
+}
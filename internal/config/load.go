@@ -0,0 +1,309 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvFile is loaded if it exists, unless another file is given with
+// -env-file or a config file is given, whose values it would override.
+const DefaultEnvFile = "./configs/.env"
+
+// ConfigFileVariable names the config file if it isn't given with -config.
+const ConfigFileVariable = "CONFIG_FILE"
+
+// secrets aren't printed by Print.
+var secrets = map[string]bool{"JWT_SECRET_KEY": true, "ADMIN_PASSWORD": true}
+
+// credentialURLs are printed by Print with their password left out.
+var credentialURLs = map[string]bool{"DATABASE_URL": true}
+
+var tagKey = regexp.MustCompile(`([^\s:"]+):"`)
+
+// setting is a field of Config, set by the name of its environment
+// variable.
+type setting struct {
+	name         string
+	defaultValue string
+	value        reflect.Value
+}
+
+// settings lists the fields of the config. Every field must carry an env
+// and an env-default tag and no other, so a typo'd tag isn't silently
+// ignored.
+func settings(cfg *Config) ([]setting, error) {
+	v := reflect.ValueOf(cfg).Elem()
+
+	var result []setting
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		for _, match := range tagKey.FindAllStringSubmatch(string(field.Tag), -1) {
+			if match[1] != "env" && match[1] != "env-default" {
+				return nil, fmt.Errorf("field %s has unknown tag %s", field.Name, match[1])
+			}
+		}
+
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			return nil, fmt.Errorf("field %s has no env tag", field.Name)
+		}
+		defaultValue, ok := field.Tag.Lookup("env-default")
+		if !ok {
+			return nil, fmt.Errorf("field %s has no env-default tag", field.Name)
+		}
+
+		result = append(result, setting{name: name, defaultValue: defaultValue, value: v.Field(i)})
+	}
+
+	return result, nil
+}
+
+// flagName is the command line flag of the setting, e.g. -orchestrator-port
+// for ORCHESTRATOR_PORT.
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.name), "_", "-")
+}
+
+func (s setting) set(value string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: expected an integer, got %q", s.name, value)
+		}
+		s.value.SetInt(int64(n))
+
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("%s: expected a number, got %q", s.name, value)
+		}
+		s.value.SetFloat(n)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: expected true or false, got %q", s.name, value)
+		}
+		s.value.SetBool(b)
+
+	default:
+		return fmt.Errorf("%s: unsupported type %s", s.name, s.value.Type())
+	}
+
+	return nil
+}
+
+func (s setting) String() string {
+	if s.value.Kind() == reflect.String {
+		return strconv.Quote(s.value.String())
+	}
+
+	return fmt.Sprint(s.value.Interface())
+}
+
+func newFlagSet(cfg *Config) (*flag.FlagSet, error) {
+	settings, err := settings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	flags.String("config", "", "YAML or TOML config file, $"+ConfigFileVariable+" if empty, overridden by an -env-file, the environment and flags")
+	flags.String("env-file", DefaultEnvFile, ".env file, ignored if it doesn't exist or a config file is given unless given explicitly")
+	flags.BoolVar(&cfg.printConfig, "print-config", false, "print the config as a YAML config file and exit")
+
+	for _, s := range settings {
+		flags.String(s.flagName(), s.defaultValue, "sets $"+s.name)
+	}
+
+	return flags, nil
+}
+
+// readConfigFile reads the settings of a YAML or TOML config file, keyed by
+// the names of their environment variables in lower or upper case.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value.(type) {
+		case nil:
+			values[key] = ""
+		case map[string]any, []any:
+			return nil, fmt.Errorf("%s: expected a value", key)
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+
+	return values, nil
+}
+
+// load sets the config from every source in increasing order of
+// precedence, returning the errors of all of them.
+func (c *Config) load(flags *flag.FlagSet) error {
+	settings, err := settings(c)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]setting, len(settings))
+	byFlag := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byName[s.name] = s
+		byFlag[s.flagName()] = s
+	}
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var errs []error
+	apply := func(source string, values map[string]string) {
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			value := values[key]
+			s, ok := byName[strings.ToUpper(key)]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting %s", source, key))
+				continue
+			}
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", source, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if err := s.set(s.defaultValue); err != nil {
+			errs = append(errs, fmt.Errorf("default: %w", err))
+		}
+	}
+
+	configFile := flags.Lookup("config").Value.String()
+	if configFile == "" {
+		configFile = os.Getenv(ConfigFileVariable)
+	}
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		apply(configFile, values)
+	}
+
+	// The default .env file would silently override the config file.
+	if configFile == "" || explicit["env-file"] {
+		envFile := flags.Lookup("env-file").Value.String()
+		values, err := godotenv.Read(envFile)
+		switch {
+		case err == nil:
+			apply(envFile, values)
+		case !errors.Is(err, fs.ErrNotExist) || explicit["env-file"]:
+			return fmt.Errorf("failed to read env file: %w", err)
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.name); ok {
+			if err := s.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("environment: %w", err))
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if s, ok := byFlag[f.Name]; ok {
+			if err := s.set(f.Value.String()); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+			}
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Print writes the config as a YAML config file, leaving secrets out.
+func (c *Config) Print(w io.Writer) {
+	settings, _ := settings(c)
+
+	for _, s := range settings {
+		value := s.String()
+		switch {
+		case secrets[s.name]:
+			value = `"<redacted>"`
+		case credentialURLs[s.name]:
+			value = strconv.Quote(redactURL(s.value.String()))
+		}
+
+		fmt.Fprintf(w, "%s: %s\n", strings.ToLower(s.name), value)
+	}
+}
+
+// dsnPassword matches the password of a key/value connection string, e.g.
+// password=secret or password='a secret'.
+var dsnPassword = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactURL replaces the password of the URL, given either in its userinfo
+// or as the password parameter, with xxxxx. Key/value connection strings
+// have their password replaced, and anything else which isn't a URL is
+// replaced entirely.
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		if !strings.Contains(raw, "://") && strings.Contains(raw, "=") {
+			return dsnPassword.ReplaceAllString(raw, "${1}xxxxx")
+		}
+		return "xxxxx"
+	}
+
+	query := u.Query()
+	if query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+)
+
+// Names accepted by COST_MODEL, SCHEDULER and QUEUE, matching the ones the
+// orchestrator knows.
+var (
+	costModels = []string{orchestrator.OperatorCostModelName, orchestrator.OperandSizeCostModelName, orchestrator.ZeroCostModelName}
+	schedulers = []string{orchestrator.FairSchedulerName, orchestrator.FIFOSchedulerName}
+	queues     = []string{"memory", "database"}
+	exporters  = []string{tracing.NoneExporter, tracing.OTLPExporter, tracing.FileExporter}
+)
+
+// Validate reports every invalid setting of the config.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, name, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+	port := func(name string, value int, optional bool) {
+		check(value >= 1 && value <= 65535 || optional && value == 0, name,
+			"expected a port between 1 and 65535, got %d", value)
+	}
+	nonNegative := func(name string, value float64) {
+		check(value >= 0, name, "must not be negative, got %v", value)
+	}
+	oneOf := func(name, value string, allowed []string) {
+		check(slices.Contains(allowed, value), name, "expected one of %v, got %q", allowed, value)
+	}
+	pair := func(certName, cert, keyName, key string) {
+		check(cert == "" || key != "", keyName, "required along with %s", certName)
+		check(key == "" || cert != "", certName, "required along with %s", keyName)
+	}
+
+	port("ORCHESTRATOR_PORT", c.OrchestratorPort, false)
+	port("ORCHESTRATOR_GRPC_PORT", c.OrchestratorGRPCPort, false)
+	port("AGENT_METRICS_PORT", c.AgentMetricsPort, true)
+	port("AGENT_HEALTH_PORT", c.AgentHealthPort, true)
+	check(c.OrchestratorPort != c.OrchestratorGRPCPort, "ORCHESTRATOR_GRPC_PORT", "must differ from ORCHESTRATOR_PORT")
+	check(c.OrchestratorHost != "", "ORCHESTRATOR_HOST", "must not be empty")
+
+	nonNegative("TIME_ADDITION_MS", float64(c.TimeAdditionMS))
+	nonNegative("TIME_SUBTRACTION_MS", float64(c.TimeSubtractionMS))
+	nonNegative("TIME_MULTIPLICATIONS_MS", float64(c.TimeMultiplicationsMS))
+	nonNegative("TIME_DIVISIONS_MS", float64(c.TimeDivisionsMS))
+	nonNegative("TIME_PER_DIGIT_MS", float64(c.TimePerDigitMS))
+	oneOf("COST_MODEL", c.CostModel, costModels)
+
+	check(c.ComputingPower >= 1, "COMPUTING_POWER", "must be at least 1, got %d", c.ComputingPower)
+	nonNegative("POLLING_INTERVAL_MS", float64(c.PollingIntervalMS))
+	nonNegative("POLLING_WAIT_MS", float64(c.PollingWaitMS))
+
+	check(c.JWTSecretKey != "", "JWT_SECRET_KEY", "must not be empty")
+	check(c.DatabasePath != "", "DATABASE_PATH", "must not be empty")
+	check(c.DatabaseURL == "" || db.IsPostgresURL(c.DatabaseURL), "DATABASE_URL", "expected a postgres:// URL, got %q", redactURL(c.DatabaseURL))
+	oneOf("QUEUE", c.Queue, queues)
+	renewal := orchestrator.LeaseRenewalInterval.Milliseconds()
+	check(int64(c.LeaseTTLMS) > renewal, "LEASE_TTL_MS", "must be above %d, the interval leases are renewed at, got %d", renewal, c.LeaseTTLMS)
+	check(c.StepLeaseMS >= 1, "STEP_LEASE_MS", "must be at least 1, got %d", c.StepLeaseMS)
+	check(c.AdminUsers == "" || c.AdminPassword != "", "ADMIN_PASSWORD", "must not be empty with ADMIN_USERS")
+
+	nonNegative("RATE_LIMIT_RPS", c.RateLimitRPS)
+	nonNegative("RATE_LIMIT_BURST", float64(c.RateLimitBurst))
+	nonNegative("MAX_PENDING_EXPRESSIONS", float64(c.MaxPendingExpressions))
+	nonNegative("MAX_EXPRESSION_LENGTH", float64(c.MaxExpressionLength))
+	nonNegative("MAX_EXPRESSION_OPERATORS", float64(c.MaxExpressionOperators))
+	oneOf("SCHEDULER", c.Scheduler, schedulers)
+	nonNegative("RESULT_CACHE_SIZE", float64(c.ResultCacheSize))
+
+	if _, err := logging.New(io.Discard, c.LogLevel, "json"); err != nil {
+		check(false, "LOG_LEVEL", "expected debug, info, warn or error, got %q", c.LogLevel)
+	}
+	if _, err := logging.New(io.Discard, "info", c.LogFormat); err != nil {
+		check(false, "LOG_FORMAT", "expected json or text, got %q", c.LogFormat)
+	}
+
+	oneOf("TRACING_EXPORTER", c.TracingExporter, exporters)
+	check(c.TracingExporter != tracing.OTLPExporter || c.TracingEndpoint != "", "TRACING_ENDPOINT", "required by the otlp exporter")
+
+	pair("TLS_CERT_FILE", c.TLSCertFile, "TLS_KEY_FILE", c.TLSKeyFile)
+	check(c.TLSClientCAFile == "" || c.TLSCertFile != "", "TLS_CERT_FILE", "required along with TLS_CLIENT_CA_FILE")
+	pair("AGENT_TLS_CERT_FILE", c.AgentTLSCertFile, "AGENT_TLS_KEY_FILE", c.AgentTLSKeyFile)
+	nonNegative("TLS_RELOAD_INTERVAL_MS", float64(c.TLSReloadIntervalMS))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"log/slog"
+	"sync"
+)
+
+// Result is the result of a step, along with the trace context it was
+// solved in.
+type Result struct {
+	Task  *Task
+	Value calculator.Token
+	// Error is why the step couldn't be solved, Value being empty if it's
+	// set.
+	Error string
+	// TraceContext is the serialized trace context of solving the step.
+	TraceContext map[string]string
+}
+
+// BatchPoller is an ExpressionPoller which also receives steps and submits
+// their results many at a time.
+type BatchPoller interface {
+	ExpressionPoller
+	// GetNextTasks blocks until steps are available, returning at most
+	// limit of them. It returns nil only once context is done.
+	GetNextTasks(context context.Context, limit int) []*Task
+	// SubmitResults submits the results, returning the error of each of
+	// them, nil for the ones which have been accepted.
+	SubmitResults(context context.Context, results []Result) []error
+}
+
+// solveBatches fetches as many steps at once as there are idle workers and
+// solves each of them on a worker of its own. Results are submitted together
+// with the ones solved while the previous batch of results was being
+// submitted.
+func (i *Interactor) solveBatches(ctx context.Context, poller BatchPoller, pool *pool) {
+	results := make(chan Result, pool.workers())
+
+	submitted := make(chan struct{})
+	go func() {
+		i.submitResults(ctx, poller, results)
+		close(submitted)
+	}()
+
+	wg := sync.WaitGroup{}
+	defer func() {
+		wg.Wait()
+		close(results)
+		<-submitted
+	}()
+
+	for {
+		idle := pool.acquire(ctx)
+		if idle == 0 {
+			return
+		}
+
+		batch := poller.GetNextTasks(ctx, idle)
+		pool.release(idle - len(batch))
+
+		// Steps fetched before the pool shrank are solved all the same.
+		for _, task := range batch {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer pool.release(1)
+
+				if result, ok := i.execute(ctx, task); ok {
+					results <- result
+				}
+			}()
+		}
+	}
+}
+
+// execute solves the step, returning its result, or the error failing its
+// expression, unless it failed otherwise.
+func (i *Interactor) execute(ctx context.Context, task *Task) (Result, bool) {
+	taskCtx := task.Context(ctx)
+	slog.DebugContext(taskCtx, "solving step",
+		"arg1", task.Arg1.Value,
+		"arg2", task.Arg2.Value,
+		"operation", task.Operation.Value,
+	)
+
+	busyWorkers.Inc()
+	defer busyWorkers.Dec()
+
+	taskCtx, span := startExecuteSpan(taskCtx, task)
+	defer span.End()
+
+	value, err := i.calculate(taskCtx, task)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(taskCtx, "failed to solve step", "error", err)
+		taskErrors.Inc(task.Operation.Value)
+
+		if !failsExpression(err) {
+			return Result{}, false
+		}
+
+		return Result{
+			Task:         task,
+			Error:        err.Error(),
+			TraceContext: tracing.Inject(taskCtx),
+		}, true
+	}
+
+	return Result{
+		Task:         task,
+		Value:        formatResult(value),
+		TraceContext: tracing.Inject(taskCtx),
+	}, true
+}
+
+// submitResults submits the results until the channel is closed, taking
+// every result which is ready at once.
+func (i *Interactor) submitResults(ctx context.Context, poller BatchPoller, results <-chan Result) {
+	for result := range results {
+		batch := []Result{result}
+		for len(results) > 0 {
+			batch = append(batch, <-results)
+		}
+
+		errs := poller.SubmitResults(ctx, batch)
+
+		for n, result := range batch {
+			taskCtx := result.Task.Context(ctx)
+
+			if err := errs[n]; err != nil {
+				slog.ErrorContext(taskCtx, "failed to submit result", "error", err)
+				taskErrors.Inc(result.Task.Operation.Value)
+				continue
+			}
+
+			if result.Error != "" {
+				slog.DebugContext(taskCtx, "step failure submitted")
+				continue
+			}
+
+			tasksSolved.Inc(result.Task.Operation.Value)
+			slog.DebugContext(taskCtx, "step solved", "result", result.Value.Value)
+		}
+	}
+}
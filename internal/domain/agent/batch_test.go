@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/google/uuid"
+)
+
+// batchPoller hands out queued steps in batches and records the results
+// submitted, failures being recorded as their error.
+type batchPoller struct {
+	tasks    []*Task
+	limits   []int
+	results  map[uuid.UUID]string
+	solved   chan struct{}
+	expected int
+	mutex    sync.Mutex
+}
+
+func (p *batchPoller) GetNextTask(ctx context.Context) *Task {
+	panic("steps must be fetched in batches")
+}
+
+func (p *batchPoller) SolveTask(ctx context.Context, id uuid.UUID, result calculator.Token) error {
+	panic("results must be submitted in batches")
+}
+
+func (p *batchPoller) FailTask(ctx context.Context, id uuid.UUID, reason string) error {
+	panic("failures must be submitted in batches")
+}
+
+func (p *batchPoller) GetNextTasks(ctx context.Context, limit int) []*Task {
+	p.mutex.Lock()
+	p.limits = append(p.limits, limit)
+
+	n := min(limit, len(p.tasks))
+	batch := p.tasks[:n]
+	p.tasks = p.tasks[n:]
+	p.mutex.Unlock()
+
+	if len(batch) > 0 {
+		return batch
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (p *batchPoller) SubmitResults(ctx context.Context, results []Result) []error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, result := range results {
+		p.results[result.Task.ID] = result.Value.Value
+		if result.Error != "" {
+			p.results[result.Task.ID] = result.Error
+		}
+	}
+
+	if len(p.results) == p.expected {
+		close(p.solved)
+	}
+
+	return make([]error, len(results))
+}
+
+func TestInteractorSolvesBatches(t *testing.T) {
+	poller := &batchPoller{
+		results: make(map[uuid.UUID]string),
+		solved:  make(chan struct{}),
+	}
+
+	want := make(map[uuid.UUID]string)
+	for n := range 10 {
+		task := &Task{
+			ID:        uuid.New(),
+			Arg1:      calculator.Token{Value: "2"},
+			Arg2:      calculator.Token{Value: "3"},
+			Operation: calculator.Token{Value: []string{"+", "-", "*", "/"}[n%4]},
+			StepID:    uuid.NewString(),
+		}
+		poller.tasks = append(poller.tasks, task)
+		want[task.ID] = map[string]string{"+": "5", "-": "-1", "*": "6", "/": "0.6666666666666666"}[task.Operation.Value]
+	}
+	poller.expected = len(want)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	interactor := Interactor{Poller: poller}
+	go func() {
+		interactor.StartPolling(ctx, 3)
+		close(stopped)
+	}()
+
+	select {
+	case <-poller.solved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("steps weren't solved in time")
+	}
+
+	cancel()
+	<-stopped
+
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	for id, result := range want {
+		if poller.results[id] != result {
+			t.Errorf("step of %s: got result %q, want %q", id, poller.results[id], result)
+		}
+	}
+
+	for _, limit := range poller.limits {
+		if limit < 1 || limit > 3 {
+			t.Errorf("got batch of up to %d steps requested, want between 1 and the 3 workers", limit)
+		}
+	}
+}
+
+func TestInteractorSubmitsFailedSteps(t *testing.T) {
+	division := &Task{
+		ID:        uuid.New(),
+		Arg1:      calculator.Token{Value: "1"},
+		Arg2:      calculator.Token{Value: "0"},
+		Operation: calculator.Token{Value: "/"},
+		StepID:    uuid.NewString(),
+	}
+	overflow := &Task{
+		ID:        uuid.New(),
+		Arg1:      calculator.Token{Value: "1e308"},
+		Arg2:      calculator.Token{Value: "10"},
+		Operation: calculator.Token{Value: "*"},
+		StepID:    uuid.NewString(),
+	}
+	poller := &batchPoller{
+		tasks:    []*Task{division, overflow},
+		results:  make(map[uuid.UUID]string),
+		solved:   make(chan struct{}),
+		expected: 2,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	interactor := Interactor{Poller: poller}
+	go func() {
+		interactor.StartPolling(ctx, 2)
+		close(stopped)
+	}()
+
+	select {
+	case <-poller.solved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failures weren't submitted in time")
+	}
+
+	cancel()
+	<-stopped
+
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	if got := poller.results[division.ID]; got != ErrDivisionByZero.Error() {
+		t.Errorf("got %q submitted, want %q", got, ErrDivisionByZero.Error())
+	}
+	if got := poller.results[overflow.ID]; !strings.HasPrefix(got, ErrNotFinite.Error()) {
+		t.Errorf("got %q submitted for an overflow, want %q", got, ErrNotFinite.Error())
+	}
+}
+
+func TestInteractorResizesWithoutDroppingSteps(t *testing.T) {
+	poller := &batchPoller{
+		results: make(map[uuid.UUID]string),
+		solved:  make(chan struct{}),
+	}
+	for range 6 {
+		poller.tasks = append(poller.tasks, &Task{
+			ID:        uuid.New(),
+			Arg1:      calculator.Token{Value: "1"},
+			Arg2:      calculator.Token{Value: "2"},
+			Operation: calculator.Token{Value: "wait"},
+			StepID:    uuid.NewString(),
+		})
+	}
+	poller.expected = len(poller.tasks)
+
+	// Steps are held until the gate opens, keeping their workers busy.
+	started := make(chan struct{}, len(poller.tasks))
+	gate := make(chan struct{})
+	evaluators := NewRegistry()
+	evaluators.Register("wait", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		started <- struct{}{}
+		<-gate
+		return arg1 + arg2, nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	interactor := Interactor{Poller: poller, Evaluators: evaluators}
+	go func() {
+		interactor.StartPolling(ctx, 4)
+		close(stopped)
+	}()
+
+	for range 4 {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("workers didn't start solving in time")
+		}
+	}
+
+	if err := interactor.Resize(1); err != nil {
+		t.Fatalf("failed to resize: %v", err)
+	}
+	if got := interactor.Workers(); got != 1 {
+		t.Errorf("got %d workers, want 1", got)
+	}
+
+	poller.mutex.Lock()
+	resizedAt := len(poller.limits)
+	poller.mutex.Unlock()
+
+	close(gate)
+
+	select {
+	case <-poller.solved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("steps weren't solved in time")
+	}
+
+	cancel()
+	<-stopped
+
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	for _, task := range poller.tasks {
+		t.Errorf("step of %s was never fetched", task.ID)
+	}
+	for id, result := range poller.results {
+		if result != "3" {
+			t.Errorf("step of %s: got result %q, want 3", id, result)
+		}
+	}
+
+	for _, limit := range poller.limits[resizedAt:] {
+		if limit != 1 {
+			t.Errorf("got batch of up to %d steps requested after resizing, want 1", limit)
+		}
+	}
+
+	if err := interactor.Resize(2); !errors.Is(err, ErrNotPolling) {
+		t.Errorf("got %v resizing after polling stopped, want ErrNotPolling", err)
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+var ErrUnsupportedOperator = errors.New("unsupported operator")
+var ErrDivisionByZero = errors.New("zero division error")
+var ErrNotFinite = errors.New("result is not a finite number")
+
+// Evaluator solves the steps of a single operator.
+type Evaluator interface {
+	Evaluate(arg1, arg2 float64) (float64, error)
+}
+
+// EvaluatorFunc adapts a function to an Evaluator.
+type EvaluatorFunc func(arg1, arg2 float64) (float64, error)
+
+func (f EvaluatorFunc) Evaluate(arg1, arg2 float64) (float64, error) {
+	return f(arg1, arg2)
+}
+
+// Registry holds the evaluators of the operators an agent supports, keyed
+// by operator. It's safe for concurrent use.
+type Registry struct {
+	evaluators map[string]Evaluator
+	mutex      sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		evaluators: make(map[string]Evaluator),
+	}
+}
+
+// NewDefaultRegistry returns a registry of the built-in operators.
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+
+	registry.Register("+", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		return arg1 + arg2, nil
+	}))
+	registry.Register("-", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		return arg1 - arg2, nil
+	}))
+	registry.Register("*", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		return arg1 * arg2, nil
+	}))
+	registry.Register("/", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		if arg2 == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return arg1 / arg2, nil
+	}))
+
+	return registry
+}
+
+// Register makes the evaluator solve the steps of the operator, replacing
+// the one registered before.
+func (r *Registry) Register(operator string, evaluator Evaluator) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.evaluators[operator] = evaluator
+}
+
+// Evaluate solves a step of the operator. Results which overflow or
+// aren't a number are reported as ErrNotFinite, as they can't be sent.
+func (r *Registry) Evaluate(operator string, arg1, arg2 float64) (float64, error) {
+	r.mutex.RLock()
+	evaluator, ok := r.evaluators[operator]
+	r.mutex.RUnlock()
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedOperator, operator)
+	}
+
+	result, err := evaluator.Evaluate(arg1, arg2)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return 0, fmt.Errorf("%w: %v %s %v", ErrNotFinite, arg1, operator, arg2)
+	}
+
+	return result, nil
+}
+
+// Operators returns the operators having an evaluator, sorted, to be
+// advertised to the orchestrator.
+func (r *Registry) Operators() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	operators := make([]string, 0, len(r.evaluators))
+	for operator := range r.evaluators {
+		operators = append(operators, operator)
+	}
+	slices.Sort(operators)
+
+	return operators
+}
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	registry := NewDefaultRegistry()
+
+	for _, test := range []struct {
+		operator string
+		want     float64
+	}{
+		{"+", 8},
+		{"-", 4},
+		{"*", 12},
+		{"/", 3},
+	} {
+		got, err := registry.Evaluate(test.operator, 6, 2)
+		if err != nil {
+			t.Errorf("6 %s 2: unexpected error: %v", test.operator, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("6 %s 2: got %v, want %v", test.operator, got, test.want)
+		}
+	}
+
+	if _, err := registry.Evaluate("/", 1, 0); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("division by zero: got %v, want %v", err, ErrDivisionByZero)
+	}
+
+	for _, args := range [][2]float64{{1e308, 10}, {math.Inf(1), 0}, {math.NaN(), 1}} {
+		if _, err := registry.Evaluate("*", args[0], args[1]); !errors.Is(err, ErrNotFinite) {
+			t.Errorf("%v * %v: got %v, want %v", args[0], args[1], err, ErrNotFinite)
+		}
+	}
+
+	if _, err := registry.Evaluate("^", 2, 3); !errors.Is(err, ErrUnsupportedOperator) {
+		t.Errorf("unknown operator: got %v, want %v", err, ErrUnsupportedOperator)
+	}
+}
+
+func TestRegistryRegistersOperators(t *testing.T) {
+	registry := NewDefaultRegistry()
+	registry.Register("^", EvaluatorFunc(func(arg1, arg2 float64) (float64, error) {
+		return math.Pow(arg1, arg2), nil
+	}))
+
+	if got, err := registry.Evaluate("^", 2, 3); err != nil || got != 8 {
+		t.Errorf("2 ^ 3: got %v, %v, want 8", got, err)
+	}
+
+	want := []string{"*", "+", "-", "/", "^"}
+	if got := registry.Operators(); !slices.Equal(got, want) {
+		t.Errorf("got operators %v, want %v", got, want)
+	}
+}
@@ -2,19 +2,66 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"os"
 	"sync"
 	"time"
 )
 
-var CalculatorInteractor = calculator.NewCalculatorInteractor()
+var tracer = tracing.Tracer("github.com/gitgernit/go-calculator/internal/domain/agent")
+
+var (
+	ErrInvalidWorkers = errors.New("amount of workers must be at least 1")
+	ErrNotPolling     = errors.New("agent isn't polling")
+	ErrAlreadyPolling = errors.New("agent is already polling")
+)
+
+// DefaultID identifies an agent by its host and process, for agents which
+// aren't given an id explicitly.
+func DefaultID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "agent"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
 
 type Interactor struct {
 	Poller ExpressionPoller
-	mutex  sync.RWMutex
+	// Evaluators solve the steps, the built-in operators are supported if
+	// it's nil.
+	Evaluators *Registry
+
+	// pool is set while polling.
+	pool *pool
+	// defaultWorkers is the amount of workers polling started with.
+	defaultWorkers int
+	mutex          sync.RWMutex
+}
+
+var defaultRegistry = NewDefaultRegistry()
+
+func (i *Interactor) evaluators() *Registry {
+	if i.Evaluators == nil {
+		return defaultRegistry
+	}
+
+	return i.Evaluators
+}
+
+// Operators returns the operators the agent supports.
+func (i *Interactor) Operators() []string {
+	return i.evaluators().Operators()
 }
 
 type Task struct {
@@ -23,26 +70,114 @@ type Task struct {
 	Arg2            calculator.Token `json:"arg2"`
 	Operation       calculator.Token `json:"operation"`
 	OperationTimeMS int              `json:"operation_time"`
+	// Simulate asks the agent to take OperationTimeMS to solve the step.
+	Simulate  bool   `json:"simulate"`
+	RequestID string `json:"request_id"`
+	StepID    string `json:"step_id"`
+	// TraceContext is the serialized trace context of the step.
+	TraceContext map[string]string `json:"trace_context"`
 }
 
+// Context returns ctx annotated with the correlation ids and the trace
+// context of the task.
+func (t *Task) Context(ctx context.Context) context.Context {
+	ctx = tracing.Extract(ctx, t.TraceContext)
+
+	if t.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, t.RequestID)
+	}
+	if t.StepID != "" {
+		ctx = logging.WithStepID(ctx, t.StepID)
+	}
+
+	return logging.WithExpressionID(ctx, t.ID.String())
+}
+
+// ExpressionPoller is the transport agents receive steps and submit their
+// results through. Implementations deal with transient failures of the
+// orchestrator themselves.
 type ExpressionPoller interface {
+	// GetNextTask blocks until a step is available, returning nil only
+	// once context is done.
 	GetNextTask(context context.Context) *Task
-	SolveTask(id uuid.UUID, result calculator.Token) error
+	// SolveTask submits the result of a step, failing if the result can't
+	// be delivered or has been rejected by the orchestrator.
+	SolveTask(context context.Context, id uuid.UUID, result calculator.Token) error
+	// FailTask tells the orchestrator the step couldn't be solved for the
+	// given reason, failing its expression. It fails like SolveTask does.
+	FailTask(context context.Context, id uuid.UUID, reason string) error
 }
 
+// ResizablePoller is an ExpressionPoller through which the orchestrator
+// asks agents to change the amount of workers they run.
+type ResizablePoller interface {
+	ExpressionPoller
+	// Workers receives the amount of workers the orchestrator asks for,
+	// 0 meaning the amount the agent started with.
+	Workers() <-chan int
+	// SetWorkers is called once the amount of workers has changed, for the
+	// poller to announce it.
+	SetWorkers(workers int)
+}
+
+// StartPolling solves steps on the given amount of workers until ctx is
+// done, then waits for the busy workers to finish their steps. Steps are
+// fetched and submitted in batches if the poller supports it. The amount of
+// workers may be changed with Resize meanwhile, and is changed as the
+// orchestrator asks if the poller is a ResizablePoller.
 func (i *Interactor) StartPolling(context context.Context, workers int) error {
+	if workers < 1 {
+		return ErrInvalidWorkers
+	}
+
+	pool := newPool(workers)
+
+	i.mutex.Lock()
+	if i.pool != nil {
+		i.mutex.Unlock()
+		return ErrAlreadyPolling
+	}
+	i.pool = pool
+	i.defaultWorkers = workers
+	i.mutex.Unlock()
+
+	defer func() {
+		i.mutex.Lock()
+		i.pool = nil
+		i.mutex.Unlock()
+	}()
+
+	workerCount.Set(float64(workers))
+
+	if poller, ok := i.Poller.(ResizablePoller); ok {
+		go i.followOrchestrator(context, poller)
+	}
+
+	if poller, ok := i.Poller.(BatchPoller); ok {
+		i.solveBatches(context, poller, pool)
+		return nil
+	}
+
 	wg := sync.WaitGroup{}
 
-	for _ = range workers {
-		wg.Add(1)
+	for {
+		idle := pool.acquire(context)
+		if idle == 0 {
+			break
+		}
 
-		go func() {
-			err := i.SolveTasks(context)
-			if err != nil {
-				slog.Error("error while solving expression: %v", err)
-			}
-			wg.Done()
-		}()
+		for range idle {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer pool.release(1)
+
+				if task := i.Poller.GetNextTask(context); task != nil {
+					i.solveTask(context, task)
+				}
+			}()
+		}
 	}
 
 	wg.Wait()
@@ -50,30 +185,170 @@ func (i *Interactor) StartPolling(context context.Context, workers int) error {
 	return nil
 }
 
-func (i *Interactor) SolveTasks(context context.Context) error {
+// Resize changes the amount of workers while polling. Workers beyond the
+// new amount stop once done with their step, so no step is dropped.
+func (i *Interactor) Resize(workers int) error {
+	if workers < 1 {
+		return ErrInvalidWorkers
+	}
+
+	i.mutex.RLock()
+	pool := i.pool
+	i.mutex.RUnlock()
+
+	if pool == nil {
+		return ErrNotPolling
+	}
+
+	previous := pool.workers()
+	if !pool.resize(workers) {
+		return nil
+	}
+
+	workerCount.Set(float64(workers))
+	if poller, ok := i.Poller.(ResizablePoller); ok {
+		poller.SetWorkers(workers)
+	}
+
+	slog.Info("workers resized", "previous", previous, "workers", workers)
+
+	return nil
+}
+
+// Workers returns the amount of workers, 0 unless polling.
+func (i *Interactor) Workers() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	if i.pool == nil {
+		return 0
+	}
+
+	return i.pool.workers()
+}
+
+// followOrchestrator resizes the pool to the amount of workers the
+// orchestrator asks for until ctx is done. Agents go back to the amount
+// they started with when asked for none.
+func (i *Interactor) followOrchestrator(ctx context.Context, poller ResizablePoller) {
 	for {
 		select {
-		case <-context.Done():
-			return context.Err()
+		case <-ctx.Done():
+			return
 
-		default:
-			task := i.Poller.GetNextTask(context)
+		case workers := <-poller.Workers():
+			if workers == 0 {
+				i.mutex.RLock()
+				workers = i.defaultWorkers
+				i.mutex.RUnlock()
+			}
 
-			if task == nil {
-				return fmt.Errorf("invalid task received")
+			if err := i.Resize(workers); err != nil {
+				slog.WarnContext(ctx, "failed to resize workers", "workers", workers, "error", err)
 			}
+		}
+	}
+}
+
+func startExecuteSpan(ctx context.Context, task *Task) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "agent.execute", trace.WithAttributes(
+		attribute.String("expression.id", task.ID.String()),
+		attribute.String("step.id", task.StepID),
+		attribute.String("step.operation", task.Operation.Value),
+	))
+}
+
+// calculate solves the step with the evaluator of its operator, taking as
+// long as the operation is set to if the step asks for simulated latency.
+func (i *Interactor) calculate(ctx context.Context, task *Task) (float64, error) {
+	if task.Simulate {
+		_, sleep := tracer.Start(ctx, "agent.simulated_latency")
+		time.Sleep(time.Duration(task.OperationTimeMS) * time.Millisecond)
+		sleep.End()
+	}
+
+	arg1, arg2, err := task.Arg1.BinaryOperation(task.Arg2)
+	if err != nil {
+		return 0, err
+	}
+
+	return i.evaluators().Evaluate(task.Operation.Value, arg1, arg2)
+}
+
+func (i *Interactor) solve(ctx context.Context, task *Task) (float64, error) {
+	ctx, span := startExecuteSpan(ctx, task)
+	defer span.End()
 
-			time.Sleep(time.Duration(task.OperationTimeMS) * time.Millisecond)
+	result, err := i.calculate(ctx, task)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "failed to solve step", "error", err)
 
-			result, err := CalculatorInteractor.CalculateTokenized([]calculator.Token{task.Arg1, task.Arg2, task.Operation})
-			if err != nil {
-				return err
+		if failsExpression(err) {
+			if err := i.Poller.FailTask(ctx, task.ID, err.Error()); err != nil {
+				slog.ErrorContext(ctx, "failed to submit failure", "error", err)
 			}
+		}
+
+		return 0, err
+	}
+
+	err = i.Poller.SolveTask(ctx, task.ID, formatResult(result))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "failed to submit result", "error", err)
+		return 0, err
+	}
+
+	return result, nil
+}
 
-			err = i.Poller.SolveTask(task.ID, calculator.Token{Value: fmt.Sprintf("%v", result)})
-			if err != nil {
-				return err
+// failsExpression reports whether the error of solving a step is due to
+// the step itself, so the expression fails rather than waits for a result
+// which never comes. Steps of operators the agent doesn't support may be
+// solved by other agents.
+func failsExpression(err error) bool {
+	return !errors.Is(err, ErrUnsupportedOperator)
+}
+
+func formatResult(result float64) calculator.Token {
+	return calculator.Token{Value: fmt.Sprintf("%v", result)}
+}
+
+// SolveTasks solves steps until ctx is done. Steps which fail to be solved
+// or submitted are logged and skipped.
+func (i *Interactor) SolveTasks(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		default:
+			if task := i.Poller.GetNextTask(ctx); task != nil {
+				i.solveTask(ctx, task)
 			}
 		}
 	}
 }
+
+// solveTask solves the step and submits its result.
+func (i *Interactor) solveTask(ctx context.Context, task *Task) {
+	taskCtx := task.Context(ctx)
+	slog.DebugContext(taskCtx, "solving step",
+		"arg1", task.Arg1.Value,
+		"arg2", task.Arg2.Value,
+		"operation", task.Operation.Value,
+	)
+
+	busyWorkers.Inc()
+	result, err := i.solve(taskCtx, task)
+	busyWorkers.Dec()
+
+	if err != nil {
+		taskErrors.Inc(task.Operation.Value)
+		return
+	}
+
+	tasksSolved.Inc(task.Operation.Value)
+	slog.DebugContext(taskCtx, "step solved", "result", result)
+}
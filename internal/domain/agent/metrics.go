@@ -0,0 +1,25 @@
+package agent
+
+import "github.com/gitgernit/go-calculator/internal/infra/metrics"
+
+var tasksSolved = metrics.NewCounter(
+	"agent_tasks_solved_total",
+	"Steps solved and submitted to the orchestrator.",
+	"operation",
+)
+
+var taskErrors = metrics.NewCounter(
+	"agent_task_errors_total",
+	"Steps which failed to be solved or submitted.",
+	"operation",
+)
+
+var busyWorkers = metrics.NewGauge(
+	"agent_busy_workers",
+	"Workers currently solving a step.",
+)
+
+var workerCount = metrics.NewGauge(
+	"agent_workers",
+	"Workers the agent runs, busy or not.",
+)
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// pool counts the busy workers of an agent against the amount it runs,
+// which may change while workers are busy. Shrinking the pool never stops
+// a busy worker, the pool just takes no more work until enough of them
+// are done.
+type pool struct {
+	size int
+	busy int
+	// changed is closed and replaced whenever the size changes or a
+	// worker becomes idle.
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func newPool(size int) *pool {
+	return &pool{
+		size:    size,
+		changed: make(chan struct{}),
+	}
+}
+
+func (p *pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// resize changes the amount of workers, reporting whether it changed.
+func (p *pool) resize(size int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.size == size {
+		return false
+	}
+
+	p.size = size
+	p.notify()
+
+	return true
+}
+
+func (p *pool) workers() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.size
+}
+
+// acquire waits until any worker is idle and takes every idle one,
+// returning how many it took. It returns 0 once ctx is done.
+func (p *pool) acquire(ctx context.Context) int {
+	for ctx.Err() == nil {
+		p.mutex.Lock()
+		if idle := p.size - p.busy; idle > 0 {
+			p.busy += idle
+			p.mutex.Unlock()
+			return idle
+		}
+		changed := p.changed
+		p.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+	}
+
+	return 0
+}
+
+// release makes n workers idle again.
+func (p *pool) release(n int) {
+	if n == 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.busy -= n
+	p.notify()
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"errors"
+	"log/slog"
+	"slices"
 	"time"
 
 	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
@@ -9,14 +11,65 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrUserExists = errors.New("user already exists")
+var ErrUserNotFound = errors.New("user not found")
+var ErrInvalidPassword = errors.New("invalid password")
+var ErrInvalidToken = errors.New("invalid token")
+
 type UserInteractor struct {
 	JWTSecretKey string
+	// Admins are the logins of the users allowed to change settings at
+	// runtime.
+	Admins []string
 }
 
+// IsAdmin reports whether the user is an admin, i.e. is one of Admins and
+// its account was created by CreateAdmins.
+func (i *UserInteractor) IsAdmin(login string) bool {
+	if !slices.Contains(i.Admins, login) {
+		return false
+	}
+
+	var user db.User
+	err := db.Db.Where("login = ?", login).First(&user).Error
+	return err == nil && user.Admin
+}
+
+// Create registers a user. The logins of admins are taken by their
+// accounts, so they can't be registered.
 func (i *UserInteractor) Create(login, password string) error {
+	if slices.Contains(i.Admins, login) {
+		return ErrUserExists
+	}
+
+	return create(login, password, false)
+}
+
+// CreateAdmins creates the accounts of the admins which don't exist yet,
+// with the password. Accounts registered by users under the login of an
+// admin aren't made admins.
+func (i *UserInteractor) CreateAdmins(password string) error {
+	for _, login := range i.Admins {
+		var existing db.User
+		if err := db.Db.Where("login = ?", login).First(&existing).Error; err == nil {
+			if !existing.Admin {
+				slog.Warn("account of admin was registered by a user, it isn't an admin", "login", login)
+			}
+			continue
+		}
+
+		if err := create(login, password, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func create(login, password string, admin bool) error {
 	var existing db.User
 	if err := db.Db.Where("login = ?", login).First(&existing).Error; err == nil {
-		return errors.New("user already exists")
+		return ErrUserExists
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -27,6 +80,7 @@ func (i *UserInteractor) Create(login, password string) error {
 	user := db.User{
 		Login:    login,
 		Password: string(hashedPassword),
+		Admin:    admin,
 	}
 
 	if err := db.Db.Create(&user).Error; err != nil {
@@ -39,12 +93,12 @@ func (i *UserInteractor) Create(login, password string) error {
 func (i *UserInteractor) Authorize(login, password string) (string, error) {
 	var user db.User
 	if err := db.Db.Where("login = ?", login).First(&user).Error; err != nil {
-		return "", errors.New("user not found")
+		return "", ErrUserNotFound
 	}
 
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return "", errors.New("invalid password")
+		return "", ErrInvalidPassword
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -69,17 +123,17 @@ func (i *UserInteractor) CheckToken(tokenString string) (string, error) {
 	})
 
 	if err != nil || !token.Valid {
-		return "", errors.New("invalid token")
+		return "", ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", errors.New("invalid claims")
+		return "", ErrInvalidToken
 	}
 
 	login, ok := claims["login"].(string)
 	if !ok {
-		return "", errors.New("invalid login claim")
+		return "", ErrInvalidToken
 	}
 
 	return login, nil
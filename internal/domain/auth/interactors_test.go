@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDatabase(t *testing.T) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+}
+
+func TestAdminsCantBeRegistered(t *testing.T) {
+	setupTestDatabase(t)
+
+	// mallory registered before being listed as an admin.
+	if err := (&UserInteractor{}).Create("mallory", "secret"); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	users := &UserInteractor{JWTSecretKey: "test", Admins: []string{"root", "mallory"}}
+
+	if err := users.Create("root", "guess"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("registering an admin: got %v, want %v", err, ErrUserExists)
+	}
+	if users.IsAdmin("root") {
+		t.Error("expected an admin without an account not to be one")
+	}
+
+	if err := users.CreateAdmins("secret"); err != nil {
+		t.Fatalf("failed to create admins: %v", err)
+	}
+
+	if !users.IsAdmin("root") {
+		t.Error("expected root to be an admin once its account is created")
+	}
+	if _, err := users.Authorize("root", "secret"); err != nil {
+		t.Errorf("failed to log in as root: %v", err)
+	}
+	if users.IsAdmin("mallory") {
+		t.Error("expected an account registered by a user not to be made an admin")
+	}
+
+	if err := users.CreateAdmins("changed"); err != nil {
+		t.Fatalf("failed to create admins again: %v", err)
+	}
+	if _, err := users.Authorize("root", "secret"); err != nil {
+		t.Errorf("expected the existing account to keep its password, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"slices"
 	"strconv"
+	"strings"
 )
 
 type Interactor struct{}
@@ -98,7 +99,6 @@ func (i *Interactor) validateTokenizedInfixParentheses(infix []Token) error {
 func (i *Interactor) validateTokenizedInfix(infix []Token) error {
 	binary := []string{"+", "-", "*", "/"}
 	special := []string{"(", ")"}
-	digits := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
 
 	err := i.validateTokenizedInfixParentheses(infix)
 
@@ -109,7 +109,7 @@ func (i *Interactor) validateTokenizedInfix(infix []Token) error {
 	for index := range len(infix) {
 		value := infix[index].Value
 
-		if !slices.Contains(digits, value) && !slices.Contains(binary, value) && !slices.Contains(special, value) {
+		if !isNumber(value) && !slices.Contains(binary, value) && !slices.Contains(special, value) {
 			return fmt.Errorf("unknown symbol passed")
 		}
 
@@ -154,6 +154,20 @@ func (i *Interactor) validateTokenizedInfix(infix []Token) error {
 	return nil
 }
 
+func isNumber(value string) bool {
+	if len(value) == 0 || strings.Count(value, ".") > 1 || strings.Trim(value, ".") == "" {
+		return false
+	}
+
+	for _, char := range value {
+		if char != '.' && (char < '0' || char > '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (i *Interactor) TokenizedInfixToPolish(infix []Token) []Token {
 	priorities := map[string]int{
 		"(": 0, ")": 0,
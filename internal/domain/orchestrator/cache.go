@@ -0,0 +1,273 @@
+package orchestrator
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+)
+
+// expressionKey identifies the expression by its canonical RPN, see
+// canonicalRPN. It returns an empty key for RPN which isn't valid.
+func expressionKey(rpn []calculator.Token) string {
+	canonical := canonicalRPN(rpn)
+	if canonical == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalRPN returns the RPN of the expression, the same for expressions
+// which only differ in the way numbers are written or in the order of the
+// operands of "+" and "*". It returns an empty string for RPN which isn't
+// valid.
+func canonicalRPN(rpn []calculator.Token) string {
+	var stack []string
+
+	for _, token := range rpn {
+		if !isOperator(token.Value) {
+			number, err := strconv.ParseFloat(token.Value, 64)
+			if err != nil {
+				return ""
+			}
+
+			stack = append(stack, strconv.FormatFloat(number, 'g', -1, 64))
+			continue
+		}
+
+		if len(stack) < 2 {
+			return ""
+		}
+
+		arg1, arg2 := stack[len(stack)-2], stack[len(stack)-1]
+		stack = stack[:len(stack)-2]
+
+		if isCommutative(token.Value) && arg2 < arg1 {
+			arg1, arg2 = arg2, arg1
+		}
+
+		stack = append(stack, arg1+" "+arg2+" "+token.Value)
+	}
+
+	if len(stack) != 1 {
+		return ""
+	}
+
+	return stack[0]
+}
+
+func isCommutative(operation string) bool {
+	return operation == "+" || operation == "*"
+}
+
+// sameNumber reports whether the tokens hold the same number, however
+// they're written.
+func sameNumber(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+
+	return errX == nil && errY == nil && math.Float64bits(x) == math.Float64bits(y)
+}
+
+// resultCache holds the results of the latest solved expressions by their
+// canonical key, evicting the least recently used ones beyond its size.
+type resultCache struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	mutex   sync.Mutex
+}
+
+type cachedResult struct {
+	key    string
+	result string
+}
+
+func newResultCache(size int) *resultCache {
+	return &resultCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *resultCache) get(key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return "", false
+	}
+
+	c.order.MoveToFront(element)
+
+	return element.Value.(*cachedResult).result, true
+}
+
+func (c *resultCache) add(key, result string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, found := c.entries[key]; found {
+		element.Value.(*cachedResult).result = result
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cachedResult{key: key, result: result})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*cachedResult)
+		delete(c.entries, oldest.key)
+	}
+}
+
+// CacheResults has the orchestrator answer expressions it has solved
+// lately, up to size of them, right away instead of solving them again.
+// A size of 0 disables the cache.
+func (i *Interactor) CacheResults(size int) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.results = nil
+	if size > 0 {
+		i.results = newResultCache(size)
+	}
+}
+
+// answerFromCache solves the task right away if the result of its
+// expression is cached, reporting whether it is.
+func (i *Interactor) answerFromCache(ctx context.Context, task *Task) bool {
+	if i.results == nil || task.key == "" || len(task.RPN) == 1 {
+		return false
+	}
+
+	result, found := i.results.get(task.key)
+	if !found {
+		return false
+	}
+
+	task.RPN = []calculator.Token{{Value: result}}
+	expressionsReused.Inc("cache")
+	slog.DebugContext(task.Context(ctx), "expression answered from cache")
+
+	return true
+}
+
+// cacheResult caches the result of the solved task.
+func (i *Interactor) cacheResult(task *Task) {
+	if i.results != nil && task.key != "" && len(task.RPN) == 1 {
+		i.results.add(task.key, task.RPN[0].Value)
+	}
+}
+
+// follows reports whether the expression can share the evaluation of the
+// leader instead of being solved on its own, which is the case unless it
+// would be solved sooner on its own: it has a higher priority, or the
+// leader's steps are simulated to take time while its own wouldn't be.
+func follows(leader *Task, expression Expression) bool {
+	return leader.Expression.Priority >= expression.Priority && (!leader.Expression.Simulate || expression.Simulate)
+}
+
+// follow has the task share the evaluation of the expression being solved
+// with the same key, reporting whether there is one it can share.
+func (i *Interactor) follow(task *Task) bool {
+	if task.key == "" {
+		return false
+	}
+
+	leader, found := i.inflight[task.key]
+	if !found || !follows(leader, task.Expression) {
+		return false
+	}
+
+	task.leader = leader
+	leader.followers = append(leader.followers, task)
+	expressionsReused.Inc("in_flight")
+	slog.DebugContext(task.Context(context.Background()), "expression follows another one being solved",
+		"leader_id", leader.Expression.Id.String(),
+	)
+
+	return true
+}
+
+// lead makes the task the one the next expressions with the same key
+// share the evaluation of.
+func (i *Interactor) lead(task *Task) {
+	if task.key != "" {
+		i.inflight[task.key] = task
+	}
+}
+
+// unfollow stops the task from either sharing the evaluation of another
+// one or having others share its own. Followers of a leader which stops
+// are taken over by the first of them, which goes on solving the
+// expression from where the leader got.
+func (i *Interactor) unfollow(task *Task) {
+	if leader := task.leader; leader != nil {
+		leader.followers = slices.DeleteFunc(leader.followers, func(follower *Task) bool {
+			return follower == task
+		})
+		task.leader = nil
+		return
+	}
+
+	if i.inflight[task.key] == task {
+		delete(i.inflight, task.key)
+	}
+
+	if len(task.followers) == 0 {
+		return
+	}
+
+	successor, followers := task.followers[0], task.followers[1:]
+	task.followers = nil
+
+	successor.leader = nil
+	successor.followers = followers
+	successor.RPN = slices.Clone(task.RPN)
+	for _, follower := range followers {
+		follower.leader = successor
+	}
+
+	i.lead(successor)
+	successor.ReadyAt = time.Now()
+	i.push(successor)
+
+	slog.DebugContext(successor.Context(context.Background()), "expression took over the evaluation of another one",
+		"leader_id", task.Expression.Id.String(),
+	)
+}
+
+// finishFollowers finishes the expressions sharing the evaluation of the
+// solved task with its result.
+func (i *Interactor) finishFollowers(ctx context.Context, task *Task) error {
+	followers := task.followers
+	task.followers = nil
+
+	var errs []error
+	for _, follower := range followers {
+		follower.leader = nil
+		follower.RPN = slices.Clone(task.RPN)
+
+		if err := i.finish(ctx, follower); err != nil {
+			errs = append(errs, fmt.Errorf("failed to finish expression %s: %w", follower.Expression.Id, err))
+		}
+		i.notifyChanged(follower.Expression.Id)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/google/uuid"
+)
+
+func TestCanonicalRPN(t *testing.T) {
+	canonical := func(infix string) string {
+		tokens, err := CalculatorInteractor.TokenizeInfix(infix)
+		if err != nil {
+			t.Fatalf("failed to tokenize %s: %v", infix, err)
+		}
+		return canonicalRPN(CalculatorInteractor.TokenizedInfixToPolish(tokens))
+	}
+
+	for _, test := range []struct {
+		a, b string
+		same bool
+	}{
+		{"1+2", "2+1", true},
+		{"2.50*4", "4*2.5", true},
+		{"(1+2)*3", "3*(2+1)", true},
+		{"2*3+1", "1+3*2", true},
+		{"1-2", "2-1", false},
+		{"8/4", "4/8", false},
+		{"1+2+3", "1+(2+3)", false},
+	} {
+		if got := canonical(test.a) == canonical(test.b); got != test.same {
+			t.Errorf("%s and %s: got same %v, want %v", test.a, test.b, got, test.same)
+		}
+	}
+}
+
+func TestInteractorSolvesSamePartsOnce(t *testing.T) {
+	interactor := newTestInteractor(t)
+	ids := addExpressions(t, interactor, "alice", "(1+2)*(2+1)")
+
+	task := interactor.GetNextTask(nil)
+	if err := interactor.SolveTask(context.Background(), task.Expression.Id, 3); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	task = interactor.GetNextTask(nil)
+	if _, _, _, arg1, arg2, operation, _ := task.NextStep(); arg1 != "3" || arg2 != "3" || operation != "*" {
+		t.Fatalf("got step %s %s %s, want 3 * 3", arg1, operation, arg2)
+	}
+	if err := interactor.SolveTask(context.Background(), task.Expression.Id, 9); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if expression := interactor.GetExpression(ids[0]); expression.Status != Done || expression.Result != 9 {
+		t.Errorf("got %s expression with result %v, want done with 9", expression.Status, expression.Result)
+	}
+	if steps, _ := interactor.ListSteps(ids[0]); len(steps) != 2 {
+		t.Errorf("got %d steps, want 2", len(steps))
+	}
+}
+
+func TestInteractorSharesEvaluation(t *testing.T) {
+	interactor := newTestInteractor(t)
+	alice := addExpressions(t, interactor, "alice", "2*3+1")
+	bob := addExpressions(t, interactor, "bob", "1+3*2")
+
+	if total, blocked := interactor.QueueLength(); total != 2 || blocked != 0 {
+		t.Fatalf("got queue length %d with %d blocked, want 2 with 0", total, blocked)
+	}
+
+	changed := interactor.WatchExpression(bob[0])
+
+	var handedOut int
+	for task := interactor.GetNextTask(nil); task != nil; task = interactor.GetNextTask(nil) {
+		handedOut++
+		if task.Expression.Id != alice[0] {
+			t.Fatalf("expected only the first expression to be handed out")
+		}
+
+		result := map[string]float64{"*": 6, "+": 7}
+		_, _, _, _, _, operation, _ := task.NextStep()
+		if err := interactor.SolveTask(context.Background(), task.Expression.Id, result[operation]); err != nil {
+			t.Fatalf("failed to solve step: %v", err)
+		}
+	}
+
+	if handedOut != 2 {
+		t.Errorf("got %d steps handed out, want 2", handedOut)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("expected watchers of the expression sharing the evaluation to be notified")
+	}
+
+	for _, id := range []uuid.UUID{alice[0], bob[0]} {
+		if expression := interactor.GetExpression(id); expression.Status != Done || expression.Result != 7 {
+			t.Errorf("%s: got %s expression with result %v, want done with 7", id, expression.Status, expression.Result)
+		}
+	}
+	if steps, _ := interactor.ListSteps(bob[0]); len(steps) != 0 {
+		t.Errorf("got %d steps of the expression sharing the evaluation, want none", len(steps))
+	}
+	if usage := interactor.Usage("bob"); usage.Pending != 0 {
+		t.Errorf("got %d pending expressions of bob, want 0", usage.Pending)
+	}
+}
+
+func TestInteractorDoesNotShareSlowerEvaluation(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	for _, options := range []ExpressionOptions{
+		{Priority: LowPriority},
+		{Priority: HighPriority},
+	} {
+		tokens, _ := CalculatorInteractor.TokenizeInfix("5*5")
+		if _, err := interactor.AddExpression(context.Background(), "alice", "5*5", tokens, options); err != nil {
+			t.Fatalf("failed to add expression: %v", err)
+		}
+	}
+
+	task := interactor.GetNextTask(nil)
+	if task == nil || task.Expression.Priority != HighPriority {
+		t.Fatal("expected the expression of a higher priority to be solved on its own")
+	}
+}
+
+func TestInteractorHandsEvaluationOver(t *testing.T) {
+	interactor := newTestInteractor(t)
+	alice := addExpressions(t, interactor, "alice", "1+2+3")
+	bob := addExpressions(t, interactor, "bob", "1+2+3")
+
+	task := interactor.GetNextTask(nil)
+	ctx := logging.WithStepID(context.Background(), task.StepID.String())
+	if err := interactor.SolveTask(ctx, alice[0], 3); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if err := interactor.CancelExpression(context.Background(), "alice", alice[0]); err != nil {
+		t.Fatalf("failed to cancel expression: %v", err)
+	}
+
+	task = interactor.GetNextTask(nil)
+	if task == nil || task.Expression.Id != bob[0] {
+		t.Fatal("expected the expression sharing the evaluation to take it over")
+	}
+	if _, _, _, arg1, arg2, operation, _ := task.NextStep(); arg1 != "3" || arg2 != "3" || operation != "+" {
+		t.Fatalf("got step %s %s %s, want 3 + 3", arg1, operation, arg2)
+	}
+	if err := interactor.SolveTask(context.Background(), bob[0], 6); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if expression := interactor.GetExpression(bob[0]); expression.Status != Done || expression.Result != 6 {
+		t.Errorf("got %s expression with result %v, want done with 6", expression.Status, expression.Result)
+	}
+}
+
+func TestInteractorAnswersFromCache(t *testing.T) {
+	interactor := newTestInteractor(t)
+	interactor.CacheResults(1)
+
+	addExpressions(t, interactor, "alice", "2*3")
+	solveAll(t, interactor)
+
+	ids := addExpressions(t, interactor, "bob", "3.0*2")
+	if expression := interactor.GetExpression(ids[0]); expression.Status != Done || expression.Result != 6 {
+		t.Errorf("got %s expression with result %v, want done with 6", expression.Status, expression.Result)
+	}
+	if task := interactor.GetNextTask(nil); task != nil {
+		t.Fatal("expected a cached expression not to be handed out")
+	}
+
+	// The cache holds a single result, the latest one.
+	addExpressions(t, interactor, "alice", "1+1")
+	solveAll(t, interactor)
+
+	addExpressions(t, interactor, "alice", "2*3")
+	if task := interactor.GetNextTask(nil); task == nil {
+		t.Error("expected an evicted expression to be solved again")
+	}
+}
+
+func TestSharedInteractorsShareEvaluation(t *testing.T) {
+	nodes := newTestSharedInteractors(t, time.Minute, "a", "b")
+	a, b := nodes[0], nodes[1]
+
+	alice, err := a.SubmitExpression(context.Background(), "alice", "1+2+3", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+	bob, err := b.SubmitExpression(context.Background(), "bob", "1+2+3", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	task := b.GetNextTask(nil)
+	if task == nil || task.Expression.Id != alice {
+		t.Fatal("expected only the first expression to be handed out")
+	}
+	if other := a.GetNextTask(nil); other != nil {
+		t.Fatal("expected the expression sharing the evaluation not to be handed out")
+	}
+
+	ctx := logging.WithStepID(context.Background(), task.StepID.String())
+	if err := a.SolveTask(ctx, alice, 3); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if err := b.CancelExpression(context.Background(), "alice", alice); err != nil {
+		t.Fatalf("failed to cancel expression: %v", err)
+	}
+
+	task = a.GetNextTask(nil)
+	if task == nil || task.Expression.Id != bob {
+		t.Fatal("expected the expression sharing the evaluation to take it over")
+	}
+	if _, _, _, arg1, arg2, operation, _ := task.NextStep(); arg1 != "3" || arg2 != "3" || operation != "+" {
+		t.Fatalf("got step %s %s %s, want 3 + 3", arg1, operation, arg2)
+	}
+	if err := b.SolveTask(context.Background(), bob, 6); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if expression := b.GetExpression(bob); expression.Status != Done || expression.Result != 6 {
+		t.Errorf("got %s expression with result %v, want done with 6", expression.Status, expression.Result)
+	}
+}
@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"fmt"
+	"time"
+	"unicode"
+)
+
+const (
+	OperatorCostModelName    = "operator"
+	OperandSizeCostModelName = "operand_size"
+	ZeroCostModelName        = "zero"
+)
+
+// CostModel decides how long solving a step is simulated to take.
+// Implementations must be safe for concurrent use.
+type CostModel interface {
+	Cost(operation, arg1, arg2 string) time.Duration
+}
+
+// NewCostModel returns the cost model of the given name. The operator and
+// operand size models take the operator costs, the latter adding perDigit
+// for every digit of the operands.
+func NewCostModel(name string, operators OperatorCost, perDigit time.Duration) (CostModel, error) {
+	switch name {
+	case OperatorCostModelName, "":
+		return operators, nil
+	case OperandSizeCostModelName:
+		return OperandSizeCost{Operators: operators, PerDigit: perDigit}, nil
+	case ZeroCostModelName:
+		return ZeroCost{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cost model: %s", name)
+	}
+}
+
+// ZeroCost makes every step take no time.
+type ZeroCost struct{}
+
+func (ZeroCost) Cost(operation, arg1, arg2 string) time.Duration {
+	return 0
+}
+
+// OperatorCost takes a fixed time per operator, steps of other operators
+// take no time.
+type OperatorCost map[string]time.Duration
+
+func (c OperatorCost) Cost(operation, arg1, arg2 string) time.Duration {
+	return c[operation]
+}
+
+// OperandSizeCost takes the time of the operator plus PerDigit for every
+// digit of the operands, so steps on larger numbers take longer.
+type OperandSizeCost struct {
+	Operators OperatorCost
+	PerDigit  time.Duration
+}
+
+func (c OperandSizeCost) Cost(operation, arg1, arg2 string) time.Duration {
+	return c.Operators.Cost(operation, arg1, arg2) + time.Duration(countDigits(arg1)+countDigits(arg2))*c.PerDigit
+}
+
+func countDigits(number string) int {
+	digits := 0
+	for _, r := range number {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+
+	return digits
+}
@@ -0,0 +1,154 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+)
+
+func TestCostModels(t *testing.T) {
+	operators := OperatorCost{"+": time.Second, "*": 2 * time.Second}
+
+	for _, test := range []struct {
+		model string
+		want  time.Duration
+	}{
+		{OperatorCostModelName, 2 * time.Second},
+		{OperandSizeCostModelName, 2*time.Second + 4*time.Millisecond},
+		{ZeroCostModelName, 0},
+	} {
+		model, err := NewCostModel(test.model, operators, time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: failed to create cost model: %v", test.model, err)
+		}
+
+		if got := model.Cost("*", "12", "-3.5"); got != test.want {
+			t.Errorf("%s: got cost %s, want %s", test.model, got, test.want)
+		}
+	}
+
+	if _, err := NewCostModel("random", operators, 0); err == nil {
+		t.Error("expected unknown cost model to be rejected")
+	}
+}
+
+func TestInteractorSimulatesOnlyWhenAsked(t *testing.T) {
+	setupTestDatabase(t)
+	interactor := NewOrchestratorInteractor(quota.Limits{}, NewFIFOScheduler(), OperatorCost{"+": time.Second})
+
+	for _, simulate := range []bool{true, false} {
+		tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+		_, err := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{Simulate: simulate})
+		if err != nil {
+			t.Fatalf("failed to add expression: %v", err)
+		}
+
+		task := interactor.GetNextTask(nil)
+
+		want := time.Duration(0)
+		if simulate {
+			want = time.Second
+		}
+
+		if got := interactor.StepCost(task); got != want {
+			t.Errorf("simulate %v: got cost %s, want %s", simulate, got, want)
+		}
+
+		if got := interactor.GetExpression(task.Expression.Id); got.Simulate != simulate {
+			t.Errorf("got stored simulate %v, want %v", got.Simulate, simulate)
+		}
+	}
+}
+
+func TestInteractorUpdatesSettings(t *testing.T) {
+	setupTestDatabase(t)
+	interactor := NewOrchestratorInteractor(quota.Limits{}, NewFIFOScheduler(), OperatorCost{"+": time.Second, "*": time.Second})
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+	_, err := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{Simulate: true})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+	task := interactor.GetNextTask(nil)
+
+	_, changed := interactor.AgentWorkers()
+
+	model, times, workers := OperandSizeCostModelName, OperatorCost{"+": 3 * time.Second}, 4
+	perDigit := time.Millisecond
+	settings, err := interactor.UpdateSettings(context.Background(), "admin", SettingsUpdate{
+		CostModel:      &model,
+		OperationTimes: times,
+		TimePerDigit:   &perDigit,
+		AgentWorkers:   &workers,
+	})
+	if err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+
+	if settings.OperationTimes["*"] != time.Second || settings.OperationTimes["+"] != 3*time.Second {
+		t.Errorf("got operation times %v, want + changed and * kept", settings.OperationTimes)
+	}
+	if got := interactor.StepCost(task); got != 3*time.Second+2*time.Millisecond {
+		t.Errorf("got cost %s after the update, want the one of the new model", got)
+	}
+
+	select {
+	case <-changed:
+	default:
+		t.Error("expected the change of agent workers to be signaled")
+	}
+	if got, _ := interactor.AgentWorkers(); got != 4 {
+		t.Errorf("got %d agent workers, want 4", got)
+	}
+
+	negative := -1
+	if _, err := interactor.UpdateSettings(context.Background(), "admin", SettingsUpdate{AgentWorkers: &negative}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("got %v for negative agent workers, want ErrInvalidSettings", err)
+	}
+	unknown := "random"
+	if _, err := interactor.UpdateSettings(context.Background(), "admin", SettingsUpdate{CostModel: &unknown}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("got %v for unknown cost model, want ErrInvalidSettings", err)
+	}
+
+	changes, err := interactor.ListSettingsChanges(10)
+	if err != nil {
+		t.Fatalf("failed to list changes: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes recorded, want only the applied one", len(changes))
+	}
+	if changes[0].Actor != "admin" || changes[0].Before.CostModel != OperatorCostModelName || changes[0].After.AgentWorkers != 4 {
+		t.Errorf("got change %+v, want the one made by admin", changes[0])
+	}
+}
+
+func TestInteractorRestoresSettings(t *testing.T) {
+	setupTestDatabase(t)
+	interactor := NewOrchestratorInteractor(quota.Limits{}, NewFIFOScheduler(), OperatorCost{"+": time.Second})
+
+	times, workers := OperatorCost{"+": 3 * time.Second}, 4
+	if _, err := interactor.UpdateSettings(context.Background(), "admin", SettingsUpdate{OperationTimes: times, AgentWorkers: &workers}); err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+
+	restarted := NewOrchestratorInteractor(quota.Limits{}, NewFIFOScheduler(), OperatorCost{"+": time.Second})
+	if err := restarted.RestoreSettings(context.Background()); err != nil {
+		t.Fatalf("failed to restore settings: %v", err)
+	}
+
+	settings := restarted.Settings()
+	if settings.OperationTimes["+"] != 3*time.Second || settings.AgentWorkers != 4 {
+		t.Errorf("got settings %+v after restarting, want the changed ones", settings)
+	}
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+	if _, err := restarted.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{Simulate: true}); err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+	if got := restarted.StepCost(restarted.GetNextTask(nil)); got != 3*time.Second {
+		t.Errorf("got cost %s after restarting, want the changed one", got)
+	}
+}
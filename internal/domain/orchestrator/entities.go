@@ -1,6 +1,10 @@
 package orchestrator
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/gitgernit/go-calculator/internal/domain/calculator"
 	"github.com/google/uuid"
 )
@@ -10,22 +14,170 @@ type Status int
 const (
 	Accepted Status = iota
 	Done
+	Expired
+	Canceled
+	Failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case Accepted:
+		return "accepted"
+	case Done:
+		return "done"
+	case Expired:
+		return "expired"
+	case Canceled:
+		return "canceled"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type Priority int
+
+const (
+	LowPriority Priority = iota
+	NormalPriority
+	HighPriority
 )
 
+func (p Priority) clamp() Priority {
+	return min(max(p, LowPriority), HighPriority)
+}
+
+func (p Priority) String() string {
+	switch p.clamp() {
+	case LowPriority:
+		return "low"
+	case HighPriority:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority converts a priority name to a Priority. An empty name
+// stands for NormalPriority.
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "low":
+		return LowPriority, nil
+	case "normal", "":
+		return NormalPriority, nil
+	case "high":
+		return HighPriority, nil
+	default:
+		return NormalPriority, fmt.Errorf("unknown priority: %s", name)
+	}
+}
+
+// ParseStatus converts a status name to a Status.
+func ParseStatus(name string) (Status, error) {
+	for _, status := range []Status{Accepted, Done, Expired, Canceled, Failed} {
+		if status.String() == name {
+			return status, nil
+		}
+	}
+
+	return Accepted, fmt.Errorf("unknown status: %s", name)
+}
+
 type Expression struct {
-	Id     uuid.UUID
-	Owner  string
-	Status Status
-	Tokens []calculator.Token
-	Result float64
+	Id       uuid.UUID
+	Owner    string
+	Text     string
+	Status   Status
+	Tokens   []calculator.Token
+	Result   float64
+	Priority Priority
+	Deadline *time.Time
+	// Simulate makes agents take the time the cost model assigns to each
+	// step, instead of solving it right away.
+	Simulate   bool
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+	// Error is why the expression has ended without a result, empty unless
+	// it has.
+	Error string
 }
 
-func NewExpression(owner string, tokens []calculator.Token) Expression {
+// ExpressionOptions are the optional scheduling parameters of a newly
+// submitted expression.
+type ExpressionOptions struct {
+	Priority Priority
+	Deadline *time.Time
+	Simulate bool
+}
+
+func NewExpression(owner, text string, tokens []calculator.Token) Expression {
 	return Expression{
-		Id:     uuid.New(),
-		Owner:  owner,
-		Status: Accepted,
-		Tokens: tokens,
-		Result: 0.0,
+		Id:        uuid.New(),
+		Owner:     owner,
+		Text:      text,
+		Status:    Accepted,
+		Tokens:    tokens,
+		Result:    0.0,
+		Priority:  NormalPriority,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func (e *Expression) Overdue(now time.Time) bool {
+	return e.Deadline != nil && !now.Before(*e.Deadline)
+}
+
+// Step is a single operation of an expression, as solved by an agent.
+type Step struct {
+	Id           uuid.UUID
+	ExpressionId uuid.UUID
+	Number       int
+	Arg1         string
+	Operation    string
+	Arg2         string
+	Result       float64
+	AgentId      string
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+// Operators is the set of operators an agent solves steps of. A nil set
+// stands for every operator.
+type Operators map[string]struct{}
+
+// NewOperators returns the set of the given operators, nil if there are
+// none or they cover every operator, so steps are handed out without
+// looking at their operators.
+func NewOperators(names ...string) Operators {
+	if len(names) == 0 {
+		return nil
 	}
+
+	covered := 0
+	for _, operator := range builtinOperators {
+		if slices.Contains(names, operator) {
+			covered++
+		}
+	}
+	if covered == len(builtinOperators) {
+		return nil
+	}
+
+	operators := make(Operators, len(names))
+	for _, name := range names {
+		operators[name] = struct{}{}
+	}
+
+	return operators
+}
+
+func (o Operators) Supports(operator string) bool {
+	if o == nil {
+		return true
+	}
+
+	_, ok := o[operator]
+	return ok
 }
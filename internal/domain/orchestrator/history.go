@@ -0,0 +1,249 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+
+	// DefaultSort lists the most recently submitted expressions first.
+	DefaultSort = "-created_at"
+)
+
+var ErrInvalidSort = errors.New("invalid sort, expected created_at or priority optionally prefixed with -")
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortColumns maps sort keys accepted by ListExpressions to columns. Only
+// non-null columns can be sorted on, as pages are fetched by comparing
+// against the last row of the previous page.
+var sortColumns = map[string]string{
+	"created_at": "created_at",
+	"priority":   "priority",
+}
+
+// ExpressionQuery narrows down and orders the history returned by
+// ListExpressions. Zero fields don't filter anything.
+type ExpressionQuery struct {
+	Status        *Status
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// Search matches expressions containing the given operand or
+	// operator.
+	Search string
+
+	// Sort is a sort key, descending if prefixed with "-". DefaultSort is
+	// used if empty.
+	Sort string
+
+	// Limit is the maximum page size, DefaultListLimit if 0 and capped at
+	// MaxListLimit.
+	Limit int
+
+	// Cursor is the NextCursor of the previous page, which must have been
+	// fetched with the same sort.
+	Cursor string
+}
+
+type ExpressionPage struct {
+	Expressions []*Expression
+
+	// NextCursor continues the listing, empty on the last page.
+	NextCursor string
+}
+
+// cursor is the position of the last row of a page.
+type cursor struct {
+	Sort      string    `json:"s"`
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	Priority  int       `json:"p,omitempty"`
+}
+
+func newCursor(sort string, e db.Expression) cursor {
+	return cursor{
+		Sort:      sort,
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt.UTC(),
+		Priority:  e.Priority,
+	}
+}
+
+func (c cursor) value(column string) interface{} {
+	if column == "priority" {
+		return c.Priority
+	}
+
+	return c.CreatedAt
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// escapeLike escapes wildcards of a LIKE pattern, using \ as the escape
+// character.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// ListExpressions returns a page of the owner's expressions matching the
+// query.
+func (i *Interactor) ListExpressions(owner string, query ExpressionQuery) (ExpressionPage, error) {
+	sort := query.Sort
+	if sort == "" {
+		sort = DefaultSort
+	}
+
+	column, ok := sortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return ExpressionPage{}, ErrInvalidSort
+	}
+
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+
+	tx := db.Db.Where("owner = ?", owner)
+
+	if query.Status != nil {
+		tx = tx.Where("status = ?", db.Status(*query.Status))
+	}
+
+	if query.CreatedAfter != nil {
+		tx = tx.Where("created_at >= ?", query.CreatedAfter.UTC())
+	}
+
+	if query.CreatedBefore != nil {
+		tx = tx.Where("created_at < ?", query.CreatedBefore.UTC())
+	}
+
+	if query.Search != "" {
+		// Tokens are stored as a JSON array, so a quoted token matches it
+		// exactly instead of any number containing it.
+		token, _ := json.Marshal(query.Search)
+		tx = tx.Where(`tokens LIKE ? ESCAPE '\'`, "%"+escapeLike(string(token))+"%")
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return ExpressionPage{}, err
+		}
+
+		if after.Sort != sort {
+			return ExpressionPage{}, fmt.Errorf("%w: cursor was issued for sort %s", ErrInvalidCursor, after.Sort)
+		}
+
+		value := after.value(column)
+		tx = tx.Where(
+			fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison),
+			value, value, after.ID,
+		)
+	}
+
+	var dbExpressions []db.Expression
+	err := tx.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(limit + 1).
+		Find(&dbExpressions).Error
+	if err != nil {
+		return ExpressionPage{}, err
+	}
+
+	page := ExpressionPage{}
+	if len(dbExpressions) > limit {
+		dbExpressions = dbExpressions[:limit]
+		page.NextCursor = newCursor(sort, dbExpressions[limit-1]).encode()
+	}
+
+	page.Expressions = make([]*Expression, len(dbExpressions))
+	for idx, e := range dbExpressions {
+		page.Expressions[idx] = fromModel(e)
+	}
+
+	return page, nil
+}
+
+// recordStep stores the step of the task an agent has just solved. The
+// agent is identified by the agent id of ctx.
+func recordStep(ctx context.Context, tx *gorm.DB, task *Task, arg1, operation, arg2 string, result float64) error {
+	task.solvedSteps++
+
+	return tx.Create(&db.Step{
+		ID:           task.StepID,
+		ExpressionID: task.Expression.Id,
+		Number:       task.solvedSteps,
+		Arg1:         arg1,
+		Operation:    operation,
+		Arg2:         arg2,
+		Result:       result,
+		AgentID:      logging.AgentID(ctx),
+		StartedAt:    task.AssignedAt.UTC(),
+		FinishedAt:   time.Now().UTC(),
+	}).Error
+}
+
+// ListSteps returns the steps solved so far of the expression, in the
+// order they were solved.
+func (i *Interactor) ListSteps(id uuid.UUID) ([]Step, error) {
+	var dbSteps []db.Step
+	err := db.Db.Where("expression_id = ?", id).Order("number").Find(&dbSteps).Error
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]Step, len(dbSteps))
+	for idx, s := range dbSteps {
+		steps[idx] = Step{
+			Id:           s.ID,
+			ExpressionId: s.ExpressionID,
+			Number:       s.Number,
+			Arg1:         s.Arg1,
+			Operation:    s.Operation,
+			Arg2:         s.Arg2,
+			Result:       s.Result,
+			AgentId:      s.AgentID,
+			StartedAt:    s.StartedAt,
+			FinishedAt:   s.FinishedAt,
+		}
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,208 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/google/uuid"
+)
+
+func addExpressions(t *testing.T, interactor *Interactor, owner string, infix ...string) []uuid.UUID {
+	t.Helper()
+
+	ids := make([]uuid.UUID, len(infix))
+	for idx, expression := range infix {
+		tokens, err := CalculatorInteractor.TokenizeInfix(expression)
+		if err != nil {
+			t.Fatalf("failed to tokenize %s: %v", expression, err)
+		}
+
+		ids[idx], err = interactor.AddExpression(context.Background(), owner, expression, tokens, ExpressionOptions{})
+		if err != nil {
+			t.Fatalf("failed to add expression: %v", err)
+		}
+	}
+
+	return ids
+}
+
+func TestListExpressionsPaginates(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	var infix []string
+	for n := range 7 {
+		infix = append(infix, fmt.Sprintf("%d+1", n))
+	}
+	ids := addExpressions(t, interactor, "alice", infix...)
+	addExpressions(t, interactor, "bob", "2+2")
+
+	var listed []uuid.UUID
+	query := ExpressionQuery{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatal("pagination doesn't terminate")
+		}
+
+		page, err := interactor.ListExpressions("alice", query)
+		if err != nil {
+			t.Fatalf("failed to list expressions: %v", err)
+		}
+
+		if len(page.Expressions) > 3 {
+			t.Fatalf("got page of %d expressions, want at most 3", len(page.Expressions))
+		}
+
+		for _, expression := range page.Expressions {
+			listed = append(listed, expression.Id)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if len(listed) != len(ids) {
+		t.Fatalf("listed %d expressions, want %d", len(listed), len(ids))
+	}
+
+	// The default sort lists the most recent expressions first.
+	for idx, id := range listed {
+		if want := ids[len(ids)-1-idx]; id != want {
+			t.Errorf("expression %d is %s, want %s", idx, id, want)
+		}
+	}
+}
+
+func TestListExpressionsFilters(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	ids := addExpressions(t, interactor, "alice", "1+2", "3*4", "12-1")
+	solveAll(t, interactor)
+	pending := addExpressions(t, interactor, "alice", "5+6")
+
+	done := Done
+	page, err := interactor.ListExpressions("alice", ExpressionQuery{Status: &done, Sort: "created_at"})
+	if err != nil {
+		t.Fatalf("failed to list expressions: %v", err)
+	}
+
+	if len(page.Expressions) != len(ids) {
+		t.Fatalf("got %d done expressions, want %d", len(page.Expressions), len(ids))
+	}
+
+	for idx, expression := range page.Expressions {
+		if expression.Id != ids[idx] {
+			t.Errorf("expression %d is %s, want %s", idx, expression.Id, ids[idx])
+		}
+
+		if expression.FinishedAt == nil {
+			t.Errorf("done expression %s has no finish time", expression.Id)
+		}
+	}
+
+	page, err = interactor.ListExpressions("alice", ExpressionQuery{Search: "1"})
+	if err != nil {
+		t.Fatalf("failed to list expressions: %v", err)
+	}
+
+	if len(page.Expressions) != 2 {
+		t.Fatalf("got %d expressions using 1, want 2", len(page.Expressions))
+	}
+
+	// The most recent expression using 1 is the last done one.
+	query := ExpressionQuery{CreatedAfter: &page.Expressions[0].CreatedAt, Sort: "created_at"}
+	page, err = interactor.ListExpressions("alice", query)
+	if err != nil {
+		t.Fatalf("failed to list expressions: %v", err)
+	}
+
+	want := []uuid.UUID{ids[2], pending[0]}
+	if len(page.Expressions) != len(want) {
+		t.Fatalf("got %d expressions created since %s, want %d", len(page.Expressions), ids[2], len(want))
+	}
+
+	for idx, expression := range page.Expressions {
+		if expression.Id != want[idx] {
+			t.Errorf("expression %d is %s, want %s", idx, expression.Id, want[idx])
+		}
+	}
+}
+
+func TestListExpressionsRejectsInvalidQueries(t *testing.T) {
+	interactor := newTestInteractor(t)
+	addExpressions(t, interactor, "alice", "1+2", "3+4")
+
+	if _, err := interactor.ListExpressions("alice", ExpressionQuery{Sort: "result"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("got %v for unknown sort, want %v", err, ErrInvalidSort)
+	}
+
+	if _, err := interactor.ListExpressions("alice", ExpressionQuery{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v for malformed cursor, want %v", err, ErrInvalidCursor)
+	}
+
+	page, err := interactor.ListExpressions("alice", ExpressionQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to list expressions: %v", err)
+	}
+
+	_, err = interactor.ListExpressions("alice", ExpressionQuery{Cursor: page.NextCursor, Sort: "priority"})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got %v for cursor of another sort, want %v", err, ErrInvalidCursor)
+	}
+}
+
+func TestInteractorRecordsSteps(t *testing.T) {
+	interactor := newTestInteractor(t)
+	ids := addExpressions(t, interactor, "alice", "(1+2)*3-10/4")
+
+	ctx := logging.WithAgentID(context.Background(), "agent-1")
+	for task := interactor.GetNextTask(nil); task != nil; task = interactor.GetNextTask(nil) {
+		results := map[string]float64{"1+2": 3, "3*3": 9, "10/4": 2.5, "9-2.5": 6.5}
+
+		_, _, _, arg1, arg2, operation, _ := task.NextStep()
+		result, ok := results[arg1+operation+arg2]
+		if !ok {
+			t.Fatalf("unexpected step %s %s %s", arg1, operation, arg2)
+		}
+
+		if err := interactor.SolveTask(ctx, task.Expression.Id, result); err != nil {
+			t.Fatalf("failed to solve task: %v", err)
+		}
+	}
+
+	expression := interactor.GetExpression(ids[0])
+	if expression.Text != "(1+2)*3-10/4" {
+		t.Errorf("got expression text %q, want the submitted one", expression.Text)
+	}
+
+	steps, err := interactor.ListSteps(ids[0])
+	if err != nil {
+		t.Fatalf("failed to list steps: %v", err)
+	}
+
+	if len(steps) != 4 {
+		t.Fatalf("got %d steps, want 4", len(steps))
+	}
+
+	for idx, step := range steps {
+		if step.Number != idx+1 {
+			t.Errorf("step %d is numbered %d", idx, step.Number)
+		}
+
+		if step.AgentId != "agent-1" {
+			t.Errorf("step %d was solved by %q, want agent-1", idx, step.AgentId)
+		}
+
+		if step.FinishedAt.Before(step.StartedAt) {
+			t.Errorf("step %d finished at %s, before starting at %s", idx, step.FinishedAt, step.StartedAt)
+		}
+	}
+
+	if last := steps[len(steps)-1]; last.Operation != "-" || last.Result != 6.5 {
+		t.Errorf("got last step %s %s %s = %v, want 9 - 2.5 = 6.5", last.Arg1, last.Operation, last.Arg2, last.Result)
+	}
+}
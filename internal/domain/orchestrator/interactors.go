@@ -1,43 +1,168 @@
 package orchestrator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
 	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"log/slog"
 	"slices"
 	"strconv"
 	"sync"
+	"time"
 )
 
 var CalculatorInteractor = calculator.NewCalculatorInteractor()
 
+var tracer = tracing.Tracer("github.com/gitgernit/go-calculator/internal/domain/orchestrator")
+
+var ErrDeadlinePassed = errors.New("deadline has already passed")
+var ErrTaskNotFound = errors.New("no such task found")
+var ErrStaleResult = errors.New("result is for a step which isn't being solved")
+var ErrStepReleased = errors.New("step couldn't be delivered to an agent")
+var ErrStepFailed = errors.New("step couldn't be solved")
+var ErrStepLeaseExpired = errors.New("step wasn't solved before its lease expired")
+var ErrExpressionNotFound = errors.New("no such expression found")
+var ErrExpressionFinished = errors.New("expression has already finished")
+var ErrExpressionCanceled = errors.New("expression has been canceled")
+var ErrInvalidExpression = errors.New("invalid expression")
+
+const pendingRetryAfter = time.Second
+
 type Task struct {
 	Expression Expression
 	Blocked    bool
 	RPN        []calculator.Token
+	// RequestID is the id of the request which submitted the expression.
+	RequestID string
+	// StepID identifies the step currently handed out to an agent.
+	StepID uuid.UUID
+	// AssignedAt is the time the current step was handed out.
+	AssignedAt time.Time
+	// ReadyAt is the time the current step became ready to be handed out.
+	ReadyAt time.Time
+	// SpanContext is the span context of the expression submission, the
+	// parent of every span of the expression.
+	SpanContext trace.SpanContext
+
+	stepSpan    trace.Span
+	solvedSteps int
+
+	// key identifies the expression by its canonical RPN, see
+	// expressionKey.
+	key string
+	// leader is the task whose evaluation the task shares, if any, and
+	// followers are the tasks sharing its own.
+	leader    *Task
+	followers []*Task
+}
+
+// Context returns ctx annotated with the correlation ids of the task.
+func (t *Task) Context(ctx context.Context) context.Context {
+	if t.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, t.RequestID)
+	}
+	if t.StepID != uuid.Nil {
+		ctx = logging.WithStepID(ctx, t.StepID.String())
+	}
+
+	return logging.WithExpressionID(ctx, t.Expression.Id.String())
+}
+
+// TraceContext returns ctx carrying the span of the step currently handed
+// out, to be propagated to the agent solving it.
+func (t *Task) TraceContext(ctx context.Context) context.Context {
+	if t.stepSpan != nil {
+		return trace.ContextWithSpan(ctx, t.stepSpan)
+	}
+
+	return trace.ContextWithRemoteSpanContext(ctx, t.SpanContext)
 }
 
 type Interactor struct {
-	TaskQueue []*Task
-	mutex     sync.RWMutex
+	Limits    quota.Limits
+	tasks     map[uuid.UUID]*Task
+	scheduler Scheduler
+	costs     CostModel
+	pending   map[string]int
+	// ready is closed and replaced whenever a step becomes ready.
+	ready chan struct{}
+	// changes holds channels closed on the next change of an expression,
+	// for the ones being watched.
+	changes map[uuid.UUID]chan struct{}
+	// settings are the ones costs is made of, changed at runtime.
+	settings Settings
+	// agentWorkersChanged is closed and replaced whenever the amount of
+	// workers agents are asked to run changes.
+	agentWorkersChanged chan struct{}
+	// settingsChangedAt is the time of the latest change of the settings
+	// applied.
+	settingsChangedAt time.Time
+	mutex             sync.RWMutex
+	// settingsMutex serializes changes of the settings.
+	settingsMutex sync.Mutex
+
+	// shared is set if the queue is stored in the database, in which case
+	// tasks, scheduler and pending are unused.
+	shared *sharedQueue
+	// claimed are the steps handed out by this orchestrator from the
+	// shared queue, by step id.
+	claimed map[uuid.UUID]claimedStep
+	// versions are the versions of the watched expressions of the shared
+	// queue, whose changes are polled for.
+	versions map[uuid.UUID]expressionVersion
+
+	// stepLease is how long agents may take to solve a step beyond its
+	// cost, steps aren't handed out again if it's zero.
+	stepLease time.Duration
+
+	// results caches the results of solved expressions by key, if enabled.
+	results *resultCache
+	// inflight are the tasks the next expressions with the same key share
+	// the evaluation of, by key.
+	inflight map[string]*Task
 }
 
-func NewOrchestratorInteractor() *Interactor {
-	interactor := &Interactor{
-		TaskQueue: make([]*Task, 0),
+func newInteractor(limits quota.Limits, scheduler Scheduler, costs CostModel) *Interactor {
+	return &Interactor{
+		Limits:    limits,
+		tasks:     make(map[uuid.UUID]*Task),
+		scheduler: scheduler,
+		costs:     costs,
+		pending:   make(map[string]int),
+		ready:     make(chan struct{}),
+		changes:   make(map[uuid.UUID]chan struct{}),
+		settings:  describeCosts(costs),
+		inflight:  make(map[string]*Task),
+
+		agentWorkersChanged: make(chan struct{}),
 	}
+}
+
+func NewOrchestratorInteractor(limits quota.Limits, scheduler Scheduler, costs CostModel) *Interactor {
+	interactor := newInteractor(limits, scheduler, costs)
 
 	if err := interactor.loadPendingExpressions(); err != nil {
 		panic(fmt.Sprintf("failed to load pending expressions: %v", err))
 	}
 
+	interactor.registerMetrics()
+
 	return interactor
 }
 
 func (i *Interactor) loadPendingExpressions() error {
 	var expressions []db.Expression
-	err := db.Db.Where("status != ?", db.Done).Find(&expressions).Error
+	err := db.Db.Where("status = ?", db.Accepted).Find(&expressions).Error
 	if err != nil {
 		return err
 	}
@@ -46,69 +171,234 @@ func (i *Interactor) loadPendingExpressions() error {
 	defer i.mutex.Unlock()
 
 	for _, dbExpr := range expressions {
-		tokens := toTokenSlice(dbExpr.Tokens)
-		expr := Expression{
-			Id:     dbExpr.ID,
-			Owner:  dbExpr.Owner,
-			Status: Status(dbExpr.Status),
-			Tokens: tokens,
-			Result: dbExpr.Result,
+		expr := fromModel(dbExpr)
+
+		// Progress isn't persisted, so the expression is solved from
+		// scratch and its steps are recorded anew.
+		if err := db.Db.Where("expression_id = ?", expr.Id).Delete(&db.Step{}).Error; err != nil {
+			return err
 		}
 
 		task := &Task{
-			Expression: expr,
+			Expression: *expr,
 			Blocked:    false,
-			RPN:        CalculatorInteractor.TokenizedInfixToPolish(tokens),
+			RPN:        CalculatorInteractor.TokenizedInfixToPolish(expr.Tokens),
 		}
+		task.key = expressionKey(task.RPN)
 
-		i.TaskQueue = append(i.TaskQueue, task)
+		if err := i.enqueue(context.Background(), task); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (i *Interactor) AddExpression(owner string, tokens []calculator.Token) uuid.UUID {
-	expression := NewExpression(owner, tokens)
-	db.Db.Create(&db.Expression{
-		ID:     expression.Id,
-		Owner:  expression.Owner,
-		Status: db.Status(expression.Status),
-		Tokens: toStringSlice(expression.Tokens),
-		Result: expression.Result,
-	})
+func (i *Interactor) checkLimits(owner string, tokens []calculator.Token) error {
+	if i.Limits.MaxLength > 0 {
+		length := 0
+		for _, token := range tokens {
+			length += len(token.Value)
+		}
+
+		if length > i.Limits.MaxLength {
+			return quota.ErrExpressionTooLong
+		}
+	}
+
+	if i.Limits.MaxOperators > 0 {
+		operators := 0
+		for _, token := range tokens {
+			if isOperator(token.Value) {
+				operators++
+			}
+		}
+
+		if operators > i.Limits.MaxOperators {
+			return quota.ErrTooManyOperators
+		}
+	}
+
+	if i.Limits.MaxPending > 0 && i.countPending(owner) >= i.Limits.MaxPending {
+		return &quota.LimitError{
+			Err:        quota.ErrTooManyPending,
+			RetryAfter: pendingRetryAfter,
+		}
+	}
+
+	return nil
+}
+
+// AddExpression accepts the tokenized infix expression text for solving.
+func (i *Interactor) AddExpression(ctx context.Context, owner, text string, tokens []calculator.Token, options ExpressionOptions) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "orchestrator.add_expression")
+	defer span.End()
+
+	if options.Deadline != nil && !time.Now().Before(*options.Deadline) {
+		return uuid.Nil, ErrDeadlinePassed
+	}
 
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
 
+	if err := i.checkLimits(owner, tokens); err != nil {
+		return uuid.Nil, err
+	}
+
+	expression := NewExpression(owner, text, tokens)
+	expression.Priority = options.Priority.clamp()
+	expression.Deadline = options.Deadline
+	expression.Simulate = options.Simulate
+
+	model := &db.Expression{
+		ID:        expression.Id,
+		Owner:     expression.Owner,
+		Text:      expression.Text,
+		Status:    db.Status(expression.Status),
+		Tokens:    toStringSlice(expression.Tokens),
+		Result:    expression.Result,
+		Priority:  int(expression.Priority),
+		Deadline:  expression.Deadline,
+		Simulate:  expression.Simulate,
+		CreatedAt: expression.CreatedAt,
+	}
+
 	task := Task{
-		Expression: expression,
-		Blocked:    false,
-		RPN:        CalculatorInteractor.TokenizedInfixToPolish(tokens),
+		Expression:  expression,
+		Blocked:     false,
+		RPN:         CalculatorInteractor.TokenizedInfixToPolish(tokens),
+		RequestID:   logging.RequestID(ctx),
+		SpanContext: span.SpanContext(),
 	}
+	task.key = expressionKey(task.RPN)
+	i.answerFromCache(ctx, &task)
 
-	i.TaskQueue = append(i.TaskQueue, &task)
+	var err error
+	if i.shared != nil {
+		err = i.enqueueShared(&task, model)
+	} else {
+		err = db.Db.Create(model).Error
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	span.SetAttributes(attribute.String("expression.id", expression.Id.String()))
+
+	slog.InfoContext(task.Context(ctx), "expression accepted",
+		"owner", owner,
+		"priority", expression.Priority.String(),
+	)
 
-	return expression.Id
+	switch {
+	case i.shared == nil:
+		err = i.enqueue(ctx, &task)
+	case len(task.RPN) == 1:
+		err = storeResult(ctx, db.Db, &task)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return expression.Id, nil
 }
 
-func (i *Interactor) ListExpressions(owner string) ([]*Expression, error) {
-	var dbExpressions []db.Expression
-	if err := db.Db.Where("owner = ?", owner).Find(&dbExpressions).Error; err != nil {
-		return nil, err
+// SubmitExpression tokenizes the infix expression text and accepts it for
+// solving.
+func (i *Interactor) SubmitExpression(ctx context.Context, owner, text string, options ExpressionOptions) (uuid.UUID, error) {
+	tokens, err := CalculatorInteractor.TokenizeInfix(text)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidExpression, err)
 	}
 
-	expressions := make([]*Expression, len(dbExpressions))
-	for idx, e := range dbExpressions {
-		expressions[idx] = &Expression{
-			Id:     e.ID,
-			Owner:  e.Owner,
-			Status: Status(e.Status),
-			Tokens: toTokenSlice(e.Tokens),
-			Result: e.Result,
+	return i.AddExpression(ctx, owner, text, tokens, options)
+}
+
+// enqueue registers a task and schedules its first step, unless it shares
+// the evaluation of the same expression being solved already. Expressions
+// without any operations, e.g. a single number, are finished right away.
+func (i *Interactor) enqueue(ctx context.Context, task *Task) error {
+	i.tasks[task.Expression.Id] = task
+	i.pending[task.Expression.Owner]++
+
+	if len(task.RPN) == 1 {
+		return i.finish(ctx, task)
+	}
+
+	if i.follow(task) {
+		return nil
+	}
+
+	i.lead(task)
+	task.ReadyAt = time.Now()
+	i.push(task)
+
+	return nil
+}
+
+// QueueLength returns the amount of unsolved expressions and how many of
+// them have a step currently being solved by an agent.
+func (i *Interactor) QueueLength() (total, blocked int) {
+	if i.shared != nil {
+		return queueLengthShared()
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	for _, task := range i.tasks {
+		if task.Blocked {
+			blocked++
 		}
 	}
 
-	return expressions, nil
+	return len(i.tasks), blocked
+}
+
+// CountExpressions returns the amount of stored expressions per status.
+func (i *Interactor) CountExpressions() (map[Status]int64, error) {
+	var rows []struct {
+		Status db.Status
+		Count  int64
+	}
+
+	err := db.Db.Model(&db.Expression{}).
+		Select("status, count(*) as count").
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[Status]int64, len(rows))
+	for _, row := range rows {
+		counts[Status(row.Status)] = row.Count
+	}
+
+	return counts, nil
+}
+
+func (i *Interactor) Usage(owner string) quota.Usage {
+	if i.shared != nil {
+		return quota.Usage{Pending: countPending(owner), Limits: i.Limits}
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return quota.Usage{
+		Pending: i.pending[owner],
+		Limits:  i.Limits,
+	}
+}
+
+// countPending returns the amount of unsolved expressions of the owner.
+func (i *Interactor) countPending(owner string) int {
+	if i.shared != nil {
+		return countPending(owner)
+	}
+
+	return i.pending[owner]
 }
 
 func (i *Interactor) GetExpression(id uuid.UUID) *Expression {
@@ -117,101 +407,597 @@ func (i *Interactor) GetExpression(id uuid.UUID) *Expression {
 		return nil
 	}
 
-	return &Expression{
-		Id:     e.ID,
-		Owner:  e.Owner,
-		Status: Status(e.Status),
-		Tokens: toTokenSlice(e.Tokens),
-		Result: e.Result,
+	return fromModel(e)
+}
+
+// WatchExpression returns a channel closed on the next change of the
+// expression, a step being solved or the expression finishing. The channel
+// of an expression which isn't being solved is closed already.
+func (i *Interactor) WatchExpression(id uuid.UUID) <-chan struct{} {
+	if i.shared != nil {
+		return i.watchShared(id)
 	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, found := i.tasks[id]; !found {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+
+	changed, found := i.changes[id]
+	if !found {
+		changed = make(chan struct{})
+		i.changes[id] = changed
+	}
+
+	return changed
+}
+
+// notifyChanged wakes up the watchers of the expression.
+func (i *Interactor) notifyChanged(id uuid.UUID) {
+	if changed, found := i.changes[id]; found {
+		close(changed)
+		delete(i.changes, id)
+		delete(i.versions, id)
+	}
+}
+
+// StepCost returns the time the current step of the task is simulated to
+// take, zero unless its expression asks for simulated latency.
+func (i *Interactor) StepCost(task *Task) time.Duration {
+	i.mutex.RLock()
+	costs := i.costs
+	i.mutex.RUnlock()
+
+	return stepCost(costs, task)
+}
+
+func stepCost(costs CostModel, task *Task) time.Duration {
+	if !task.Expression.Simulate {
+		return 0
+	}
+
+	_, _, _, arg1, arg2, operation, _ := task.NextStep()
+	return costs.Cost(operation, arg1, arg2)
 }
 
-func (i *Interactor) GetNextTask() *Task {
+// push queues the ready step of the task and wakes up the callers of
+// WaitNextTask.
+func (i *Interactor) push(task *Task) {
+	i.scheduler.Push(task)
+	i.notifyReady()
+}
+
+// notifyReady wakes up the callers of WaitNextTask.
+func (i *Interactor) notifyReady() {
+	close(i.ready)
+	i.ready = make(chan struct{})
+}
+
+// GetNextTask hands out the next ready step of the operators, returning nil
+// if there is none.
+func (i *Interactor) GetNextTask(operators Operators) *Task {
+	if i.shared != nil {
+		if tasks := i.claimShared(1, operators); len(tasks) > 0 {
+			return tasks[0]
+		}
+		return nil
+	}
+
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
 
-	var task *Task
+	return i.nextTask(operators)
+}
 
-	for _, t := range i.TaskQueue {
-		if !t.Blocked {
-			task = t
-			break
+// WaitNextTask hands out the next ready step of the operators, waiting for
+// one to become ready. It returns nil once ctx is done.
+func (i *Interactor) WaitNextTask(ctx context.Context, operators Operators) *Task {
+	if i.shared != nil {
+		if tasks := i.waitShared(ctx, 1, operators); len(tasks) > 0 {
+			return tasks[0]
 		}
+		return nil
+	}
+
+	for {
+		i.mutex.Lock()
+		task := i.nextTask(operators)
+		ready := i.ready
+		i.mutex.Unlock()
+
+		if task != nil {
+			return task
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ready:
+		}
+	}
+}
+
+// WaitNextTasks hands out up to limit ready steps of the operators, waiting
+// for the first one to become ready. It returns nil once ctx is done.
+func (i *Interactor) WaitNextTasks(ctx context.Context, limit int, operators Operators) []*Task {
+	if i.shared != nil {
+		return i.waitShared(ctx, limit, operators)
 	}
 
+	task := i.WaitNextTask(ctx, operators)
 	if task == nil {
 		return nil
 	}
 
-	task.Blocked = true
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	tasks := []*Task{task}
+	for len(tasks) < limit {
+		task := i.nextTask(operators)
+		if task == nil {
+			break
+		}
+		tasks = append(tasks, task)
+	}
 
-	return task
+	return tasks
 }
 
-func (i *Interactor) SolveTask(id uuid.UUID, result float64) error {
+// ReleaseTask puts back the step of the task handed out with stepID, which
+// couldn't be delivered to an agent or which the agent went away without
+// solving, so it's handed out again. It does nothing if the step isn't
+// handed out anymore.
+func (i *Interactor) ReleaseTask(task *Task, stepID uuid.UUID) {
+	if i.shared != nil {
+		i.releaseShared(task, stepID)
+		return
+	}
+
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
 
-	var taskIndex int
-	var task *Task
-	found := false
+	current, found := i.tasks[task.Expression.Id]
+	if !found || current != task || !task.Blocked || task.StepID != stepID {
+		return
+	}
 
-	for index, t := range i.TaskQueue {
-		if t.Expression.Id == id {
-			task = t
-			taskIndex = index
-			found = true
-			break
+	slog.DebugContext(task.Context(context.Background()), "step released")
+	i.requeue(task, ErrStepReleased)
+}
+
+// requeue makes the step handed out of the task ready again, ending its
+// span with reason.
+func (i *Interactor) requeue(task *Task, reason error) {
+	task.endStepSpan(reason)
+
+	task.Blocked = false
+	task.StepID = uuid.Nil
+	task.ReadyAt = time.Now()
+	i.push(task)
+}
+
+// LeaseSteps has ExpireOverdue hand out again the steps which agents
+// haven't solved lease beyond their cost, such as the ones of a crashed
+// agent. The shared queue leases steps for SharedQueueConfig.StepLease
+// instead.
+func (i *Interactor) LeaseSteps(lease time.Duration) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.stepLease = lease
+}
+
+func (i *Interactor) nextTask(operators Operators) *Task {
+	now := time.Now()
+
+	for {
+		var task *Task
+		if operators == nil {
+			task = i.scheduler.Pop()
+		} else {
+			task = i.scheduler.PopFunc(func(task *Task) bool {
+				_, _, _, _, _, operation, _ := task.NextStep()
+				return operators.Supports(operation)
+			})
+		}
+
+		if task == nil {
+			return nil
 		}
+
+		if task.Expression.Overdue(now) {
+			if err := i.expire(task); err != nil {
+				slog.ErrorContext(task.Context(context.Background()), "failed to expire overdue expression", "error", err)
+			}
+			continue
+		}
+
+		task.Blocked = true
+		task.StepID = uuid.New()
+		task.AssignedAt = now
+		i.startStepSpan(task)
+
+		slog.DebugContext(task.Context(context.Background()), "step assigned")
+
+		return task
 	}
+}
 
-	if !found {
-		return fmt.Errorf("no such task found")
+// startStepSpan records the time the task waited for the current step to
+// be handed out and opens the span of the step, ended once its result
+// arrives.
+func (i *Interactor) startStepSpan(task *Task) {
+	parent := trace.ContextWithRemoteSpanContext(context.Background(), task.SpanContext)
+	_, _, _, _, _, operation, _ := task.NextStep()
+
+	attributes := trace.WithAttributes(
+		attribute.String("expression.id", task.Expression.Id.String()),
+		attribute.String("step.id", task.StepID.String()),
+		attribute.String("step.operation", operation),
+	)
+
+	_, wait := tracer.Start(parent, "orchestrator.queue_wait", trace.WithTimestamp(task.ReadyAt), attributes)
+	wait.End(trace.WithTimestamp(task.AssignedAt))
+
+	_, task.stepSpan = tracer.Start(parent, "orchestrator.step", trace.WithTimestamp(task.AssignedAt), attributes)
+}
+
+func (t *Task) endStepSpan(err error) {
+	if t.stepSpan == nil {
+		return
 	}
 
-	arg1Index, _, operationIndex, _, _, _, found := task.NextStep()
+	if err != nil {
+		t.stepSpan.SetStatus(codes.Error, err.Error())
+	}
+
+	t.stepSpan.End()
+	t.stepSpan = nil
+}
+
+// SolveTask applies the result of the step of the task currently handed
+// out. If ctx carries a step id, the result must be for that step; results
+// of steps which have already been solved are ignored, so agents can resend
+// results they aren't sure have been received.
+func (i *Interactor) SolveTask(ctx context.Context, id uuid.UUID, result float64) error {
+	ctx, span := tracer.Start(ctx, "orchestrator.solve_task", trace.WithAttributes(
+		attribute.String("expression.id", id.String()),
+	))
+	defer span.End()
+
+	stepID := logging.StepID(ctx)
+	if i.shared != nil {
+		return i.solveShared(ctx, id, stepID, result)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	task, found := i.tasks[id]
+	if !found || !task.Blocked || (stepID != "" && stepID != task.StepID.String()) {
+		return i.checkSolved(id, stepID, found)
+	}
+
+	if task.Expression.Overdue(time.Now()) {
+		return i.expire(task)
+	}
+
+	task.endStepSpan(nil)
+	defer i.notifyChanged(id)
+
+	arg1Index, _, operationIndex, arg1, arg2, operation, found := task.NextStep()
 	if !found {
 		return fmt.Errorf("no operation found in RPN")
 	}
 
-	token := calculator.Token{
-		Value: fmt.Sprintf("%v", result),
+	stepDuration.Observe(time.Since(task.AssignedAt).Seconds(), operation)
+
+	if err := recordStep(ctx, db.Db, task, arg1, operation, arg2, result); err != nil {
+		slog.ErrorContext(task.Context(ctx), "failed to record step", "error", err)
 	}
 
-	task.RPN = append(task.RPN[:arg1Index], task.RPN[operationIndex+1:]...)
-	task.RPN = append(task.RPN[:arg1Index], append([]calculator.Token{token}, task.RPN[arg1Index:]...)...)
+	task.apply(arg1Index, operationIndex, result)
 	task.Blocked = false
 
+	slog.DebugContext(task.Context(ctx), "step solved", "result", result)
+	task.StepID = uuid.Nil
+
 	if len(task.RPN) == 1 {
-		finalResult, err := strconv.ParseFloat(task.RPN[0].Value, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse final result: %v", err)
+		return i.finish(ctx, task)
+	}
+
+	task.ReadyAt = time.Now()
+	i.push(task)
+
+	return nil
+}
+
+// apply replaces the operation at operationIndex and its arguments, the
+// first one being at arg1Index, with its result. Every other occurrence of
+// the same operation on the same arguments is replaced as well, so
+// identical parts of the expression are solved once.
+func (t *Task) apply(arg1Index, operationIndex int, result float64) {
+	token := calculator.Token{
+		Value: fmt.Sprintf("%v", result),
+	}
+
+	arg1, arg2, operation := t.RPN[arg1Index].Value, t.RPN[operationIndex-1].Value, t.RPN[operationIndex].Value
+
+	t.RPN = append(t.RPN[:arg1Index], t.RPN[operationIndex+1:]...)
+	t.RPN = append(t.RPN[:arg1Index], append([]calculator.Token{token}, t.RPN[arg1Index:]...)...)
+
+	// An operation right after two numbers always applies to them.
+	for idx := 0; idx+2 < len(t.RPN); idx++ {
+		a, b := t.RPN[idx].Value, t.RPN[idx+1].Value
+		if t.RPN[idx+2].Value != operation || isOperator(a) || isOperator(b) {
+			continue
+		}
+
+		same := sameNumber(a, arg1) && sameNumber(b, arg2)
+		swapped := isCommutative(operation) && sameNumber(a, arg2) && sameNumber(b, arg1)
+		if same || swapped {
+			t.RPN = slices.Replace(t.RPN, idx, idx+3, token)
+		}
+	}
+}
+
+// FailTask fails the expression whose step currently handed out couldn't
+// be solved by the agent for the given reason, along with the expressions
+// sharing its evaluation. The step id in ctx is checked like SolveTask
+// does.
+func (i *Interactor) FailTask(ctx context.Context, id uuid.UUID, reason string) error {
+	ctx, span := tracer.Start(ctx, "orchestrator.fail_task", trace.WithAttributes(
+		attribute.String("expression.id", id.String()),
+	))
+	defer span.End()
+
+	stepID := logging.StepID(ctx)
+	err := fmt.Errorf("%w: %s", ErrStepFailed, reason)
+	if i.shared != nil {
+		return i.failShared(ctx, id, stepID, err)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	task, found := i.tasks[id]
+	if !found || !task.Blocked || (stepID != "" && stepID != task.StepID.String()) {
+		return i.checkSolved(id, stepID, found)
+	}
+
+	return i.fail(ctx, task, err)
+}
+
+// fail ends the task as failed, along with the tasks sharing its
+// evaluation, which would fail the same way.
+func (i *Interactor) fail(ctx context.Context, task *Task, reason error) error {
+	followers := task.followers
+	task.followers = nil
+
+	var errs []error
+	for _, failed := range append([]*Task{task}, followers...) {
+		failed.leader = nil
+
+		if err := i.abort(failed, Failed, reason); err != nil {
+			errs = append(errs, fmt.Errorf("failed to fail expression %s: %v", failed.Expression.Id, err))
+			continue
+		}
+
+		slog.WarnContext(failed.Context(ctx), "expression failed", "error", reason)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkSolved tells apart results which have already been applied from
+// ones which can't be applied.
+func (i *Interactor) checkSolved(id uuid.UUID, stepID string, found bool) error {
+	if stepID == "" {
+		return ErrTaskNotFound
+	}
+
+	var count int64
+	err := db.Db.Model(&db.Step{}).
+		Where("id = ? AND expression_id = ?", stepID, id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case count > 0:
+		return nil
+	case found:
+		return ErrStaleResult
+	default:
+		return ErrTaskNotFound
+	}
+}
+
+// ExpireOverdue expires every ready task which has missed its deadline, and
+// hands out again the steps whose lease has expired. Tasks being solved by
+// an agent are expired once the result arrives. With a shared queue, it's
+// done by the leader only.
+func (i *Interactor) ExpireOverdue() error {
+	if i.shared != nil {
+		return i.expireShared()
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	now := time.Now()
+
+	var errs []error
+	for _, task := range i.tasks {
+		switch {
+		case !task.Blocked && task.Expression.Overdue(now):
+			i.scheduler.Remove(task)
+			errs = append(errs, i.expire(task))
+
+		case task.Blocked && i.stepLease > 0 && now.After(task.AssignedAt.Add(stepCost(i.costs, task)+i.stepLease)):
+			slog.WarnContext(task.Context(context.Background()), "step handed out again after its lease expired")
+			i.requeue(task, ErrStepLeaseExpired)
 		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StartExpiring runs ExpireOverdue every interval until ctx is done. With a
+// shared queue, it also competes for the lease of the background jobs and
+// keeps up with the changes of the other orchestrators meanwhile.
+func (i *Interactor) StartExpiring(ctx context.Context, interval time.Duration) {
+	if i.shared != nil {
+		go i.runShared(ctx)
+	}
 
-		i.TaskQueue = append(i.TaskQueue[:taskIndex], i.TaskQueue[taskIndex+1:]...)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		var expr db.Expression
-		if err := db.Db.First(&expr, "id = ?", id).Error; err != nil {
-			return fmt.Errorf("failed to find expression: %v", err)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.ExpireOverdue(); err != nil {
+				slog.ErrorContext(ctx, "failed to expire overdue expressions", "error", err)
+			}
 		}
+	}
+}
+
+func (i *Interactor) expire(task *Task) error {
+	if err := i.abort(task, Expired, ErrDeadlinePassed); err != nil {
+		return fmt.Errorf("failed to expire expression: %v", err)
+	}
 
-		expr.Status = db.Done
-		expr.Result = finalResult
+	slog.InfoContext(task.Context(context.Background()), "expression expired")
+
+	return nil
+}
+
+// CancelExpression stops solving an expression of the owner. A step being
+// solved by an agent is abandoned, its result being rejected once it
+// arrives.
+func (i *Interactor) CancelExpression(ctx context.Context, owner string, id uuid.UUID) error {
+	if i.shared != nil {
+		return i.cancelShared(ctx, owner, id)
+	}
 
-		if err := db.Db.Save(&expr).Error; err != nil {
-			return fmt.Errorf("failed to update expression: %v", err)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	task, found := i.tasks[id]
+	if !found || task.Expression.Owner != owner {
+		expr := i.GetExpression(id)
+		if expr == nil || expr.Owner != owner {
+			return ErrExpressionNotFound
 		}
+
+		return ErrExpressionFinished
 	}
 
+	if !task.Blocked {
+		i.scheduler.Remove(task)
+	}
+
+	if err := i.abort(task, Canceled, ErrExpressionCanceled); err != nil {
+		return fmt.Errorf("failed to cancel expression: %v", err)
+	}
+
+	slog.InfoContext(task.Context(ctx), "expression canceled")
+
+	return nil
+}
+
+// abort stops solving the task, storing the status it ended with.
+func (i *Interactor) abort(task *Task, status Status, reason error) error {
+	task.endStepSpan(reason)
+
+	delete(i.tasks, task.Expression.Id)
+	i.pending[task.Expression.Owner]--
+	i.unfollow(task)
+	defer i.notifyChanged(task.Expression.Id)
+
+	return storeStatus(db.Db, task.Expression.Id, status, reason)
+}
+
+// storeStatus stores the status an unsolved expression ended with, and the
+// reason it did as its error.
+func storeStatus(tx *gorm.DB, id uuid.UUID, status Status, reason error) error {
+	err := tx.Model(&db.Expression{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":      db.Status(status),
+			"error":       reason.Error(),
+			"finished_at": time.Now().UTC(),
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	expressionsFinished.Inc(status.String())
+
+	return nil
+}
+
+// finish stores the result of a task which has no operations left, along
+// with the ones of the tasks sharing its evaluation.
+func (i *Interactor) finish(ctx context.Context, task *Task) error {
+	delete(i.tasks, task.Expression.Id)
+	i.pending[task.Expression.Owner]--
+	if i.inflight[task.key] == task {
+		delete(i.inflight, task.key)
+	}
+
+	i.cacheResult(task)
+
+	return errors.Join(storeResult(ctx, db.Db, task), i.finishFollowers(ctx, task))
+}
+
+// storeResult stores the result of a task which has no operations left.
+func storeResult(ctx context.Context, tx *gorm.DB, task *Task) error {
+	_, span := tracer.Start(ctx, "orchestrator.store_result")
+	defer span.End()
+
+	id := task.Expression.Id
+
+	finalResult, err := strconv.ParseFloat(task.RPN[0].Value, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse final result: %v", err)
+	}
+
+	var expr db.Expression
+	if err := tx.First(&expr, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("failed to find expression: %v", err)
+	}
+
+	finishedAt := time.Now().UTC()
+	expr.Status = db.Done
+	expr.Result = finalResult
+	expr.FinishedAt = &finishedAt
+
+	if err := tx.Save(&expr).Error; err != nil {
+		return fmt.Errorf("failed to update expression: %v", err)
+	}
+
+	expressionsFinished.Inc(Done.String())
+	slog.InfoContext(task.Context(context.Background()), "expression solved", "result", finalResult)
+
 	return nil
 }
 
 func (t *Task) NextStep() (arg1Index, arg2Index, operationIndex int, arg1, arg2, operation string, found bool) {
 	stack := []int{}
-	operators := []string{"+", "-", "*", "/"}
 
 	for i, token := range t.RPN {
-		if slices.Contains(operators, token.Value) {
+		if isOperator(token.Value) {
 			if len(stack) < 2 {
 				return -1, -1, -1, "", "", "", false
 			}
@@ -226,7 +1012,7 @@ func (t *Task) NextStep() (arg1Index, arg2Index, operationIndex int, arg1, arg2,
 			return arg1Index, arg2Index, operationIndex, arg1, arg2, operation, true
 		}
 
-		if _, err := strconv.Atoi(token.Value); err == nil {
+		if _, err := strconv.ParseFloat(token.Value, 64); err == nil {
 			stack = append(stack, i)
 		}
 	}
@@ -234,6 +1020,30 @@ func (t *Task) NextStep() (arg1Index, arg2Index, operationIndex int, arg1, arg2,
 	return -1, -1, -1, "", "", "", false
 }
 
+func fromModel(e db.Expression) *Expression {
+	return &Expression{
+		Id:         e.ID,
+		Owner:      e.Owner,
+		Text:       e.Text,
+		Status:     Status(e.Status),
+		Tokens:     toTokenSlice(e.Tokens),
+		Result:     e.Result,
+		Priority:   Priority(e.Priority),
+		Deadline:   e.Deadline,
+		Simulate:   e.Simulate,
+		CreatedAt:  e.CreatedAt,
+		FinishedAt: e.FinishedAt,
+		Error:      e.Error,
+	}
+}
+
+// builtinOperators are the operators expressions are made of.
+var builtinOperators = []string{"+", "-", "*", "/"}
+
+func isOperator(value string) bool {
+	return slices.Contains(builtinOperators, value)
+}
+
 func toStringSlice(tokens []calculator.Token) []string {
 	strs := make([]string, len(tokens))
 	for i, t := range tokens {
@@ -0,0 +1,491 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDatabase(t *testing.T) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+}
+
+func newTestInteractor(t *testing.T) *Interactor {
+	t.Helper()
+	setupTestDatabase(t)
+
+	return NewOrchestratorInteractor(quota.Limits{}, NewFairScheduler(), ZeroCost{})
+}
+
+// solveAll plays the role of an agent, solving every handed out step and
+// passing the trace context along the way a transport would.
+func solveAll(t *testing.T, interactor *Interactor) {
+	t.Helper()
+
+	for task := interactor.GetNextTask(nil); task != nil; task = interactor.GetNextTask(nil) {
+		_, _, _, arg1, arg2, operation, found := task.NextStep()
+		if !found {
+			t.Fatalf("expected task to have a step")
+		}
+
+		a, _ := strconv.ParseFloat(arg1, 64)
+		b, _ := strconv.ParseFloat(arg2, 64)
+
+		var result float64
+		switch operation {
+		case "+":
+			result = a + b
+		case "-":
+			result = a - b
+		case "*":
+			result = a * b
+		case "/":
+			result = a / b
+		}
+
+		ctx := tracing.Extract(context.Background(), tracing.Inject(task.TraceContext(context.Background())))
+		if err := interactor.SolveTask(ctx, task.Expression.Id, result); err != nil {
+			t.Fatalf("failed to solve task: %v", err)
+		}
+	}
+}
+
+func TestInteractorSolvesExpression(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	tokens, err := CalculatorInteractor.TokenizeInfix("(1+2)*3-10/4")
+	if err != nil {
+		t.Fatalf("failed to tokenize: %v", err)
+	}
+
+	id, err := interactor.AddExpression(context.Background(), "alice", "(1+2)*3-10/4", tokens, ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+
+	solveAll(t, interactor)
+
+	expression := interactor.GetExpression(id)
+	if expression == nil {
+		t.Fatalf("expected expression to be stored")
+	}
+	if expression.Status != Done {
+		t.Errorf("expected status %s, got %s", Done, expression.Status)
+	}
+	if expression.Result != 6.5 {
+		t.Errorf("expected result 6.5, got %v", expression.Result)
+	}
+}
+
+func TestInteractorTracesExpression(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	interactor := newTestInteractor(t)
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "submission")
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2*3")
+	if _, err := interactor.AddExpression(ctx, "alice", "1+2*3", tokens, ExpressionOptions{}); err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+	root.End()
+
+	solveAll(t, interactor)
+
+	counts := make(map[string]int)
+	steps := make(map[string]bool)
+
+	for _, span := range recorder.Ended() {
+		counts[span.Name()]++
+
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s belongs to another trace", span.Name())
+		}
+		if span.Name() == "orchestrator.step" {
+			steps[span.SpanContext().SpanID().String()] = true
+		}
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "orchestrator.solve_task" && !steps[span.Parent().SpanID().String()] {
+			t.Errorf("expected solve_task span to be a child of a step span")
+		}
+	}
+
+	expected := map[string]int{
+		"orchestrator.add_expression": 1,
+		"orchestrator.queue_wait":     2,
+		"orchestrator.step":           2,
+		"orchestrator.solve_task":     2,
+		"orchestrator.store_result":   1,
+	}
+	for name, count := range expected {
+		if counts[name] != count {
+			t.Errorf("expected %d %s spans, got %d", count, name, counts[name])
+		}
+	}
+}
+
+func TestInteractorIgnoresResentResults(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2+3")
+	id, err := interactor.AddExpression(context.Background(), "alice", "1+2+3", tokens, ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+
+	first := interactor.GetNextTask(nil)
+	firstCtx := logging.WithStepID(context.Background(), first.StepID.String())
+	if err := interactor.SolveTask(firstCtx, id, 3); err != nil {
+		t.Fatalf("failed to solve first step: %v", err)
+	}
+
+	second := interactor.GetNextTask(nil)
+	if second == nil {
+		t.Fatal("expected second step to be handed out")
+	}
+
+	// The first result arrives again while the second step is being solved.
+	if err := interactor.SolveTask(firstCtx, id, 3); err != nil {
+		t.Fatalf("resent result of a solved step: got %v, want nil", err)
+	}
+
+	staleCtx := logging.WithStepID(context.Background(), uuid.NewString())
+	if err := interactor.SolveTask(staleCtx, id, 42); !errors.Is(err, ErrStaleResult) {
+		t.Fatalf("result of an unknown step: got %v, want %v", err, ErrStaleResult)
+	}
+
+	secondCtx := logging.WithStepID(context.Background(), second.StepID.String())
+	if err := interactor.SolveTask(secondCtx, id, 6); err != nil {
+		t.Fatalf("failed to solve second step: %v", err)
+	}
+
+	if err := interactor.SolveTask(secondCtx, id, 6); err != nil {
+		t.Fatalf("resent result of a finished expression: got %v, want nil", err)
+	}
+
+	if err := interactor.SolveTask(context.Background(), id, 6); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("result without a step of a finished expression: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	if expression := interactor.GetExpression(id); expression.Status != Done || expression.Result != 6 {
+		t.Errorf("got %s expression with result %v, want done with 6", expression.Status, expression.Result)
+	}
+}
+
+func TestInteractorWaitsForNextTask(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if task := interactor.WaitNextTask(ctx, nil); task != nil {
+		t.Fatalf("got task %v without any expressions", task)
+	}
+
+	handedOut := make(chan *Task)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		handedOut <- interactor.WaitNextTask(ctx, nil)
+	}()
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+	id, err := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+
+	task := <-handedOut
+	if task == nil || task.Expression.Id != id {
+		t.Fatalf("got task %v, want the step of the added expression", task)
+	}
+	released := task.StepID
+
+	interactor.ReleaseTask(task, task.StepID)
+
+	task = interactor.GetNextTask(nil)
+	if task == nil || task.Expression.Id != id {
+		t.Fatalf("got task %v, want the released step handed out again", task)
+	}
+
+	if task.StepID == released {
+		t.Errorf("released step was handed out again as %s, want a new step id", task.StepID)
+	}
+
+	releasedCtx := logging.WithStepID(context.Background(), released.String())
+	if err := interactor.SolveTask(releasedCtx, id, 3); !errors.Is(err, ErrStaleResult) {
+		t.Errorf("result of a released step: got %v, want %v", err, ErrStaleResult)
+	}
+}
+
+func TestInteractorHandsOutStepsAgainAfterLease(t *testing.T) {
+	interactor := newTestInteractor(t)
+	interactor.LeaseSteps(50 * time.Millisecond)
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+	id, err := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+
+	lost := interactor.GetNextTask(nil)
+	if lost == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+	lostStepID := lost.StepID
+
+	if err := interactor.ExpireOverdue(); err != nil {
+		t.Fatalf("failed to expire overdue: %v", err)
+	}
+	if task := interactor.GetNextTask(nil); task != nil {
+		t.Fatal("expected the step not to be handed out again before its lease expired")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := interactor.ExpireOverdue(); err != nil {
+		t.Fatalf("failed to expire overdue: %v", err)
+	}
+
+	retried := interactor.GetNextTask(nil)
+	if retried == nil || retried.StepID == lostStepID {
+		t.Fatal("expected the step to be handed out again with a new step id")
+	}
+
+	// Releasing the step which was handed out before leaves the new one be.
+	interactor.ReleaseTask(retried, lostStepID)
+	if task := interactor.GetNextTask(nil); task != nil {
+		t.Fatal("expected a stale release to be ignored")
+	}
+
+	lostCtx := logging.WithStepID(context.Background(), lostStepID.String())
+	if err := interactor.SolveTask(lostCtx, id, 3); !errors.Is(err, ErrStaleResult) {
+		t.Fatalf("result of a step handed out again: got %v, want %v", err, ErrStaleResult)
+	}
+
+	retriedCtx := logging.WithStepID(context.Background(), retried.StepID.String())
+	if err := interactor.SolveTask(retriedCtx, id, 3); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if expression := interactor.GetExpression(id); expression.Status != Done || expression.Result != 3 {
+		t.Errorf("got %s expression with result %v, want done with 3", expression.Status, expression.Result)
+	}
+}
+
+func TestInteractorHandsOutBatches(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	for _, text := range []string{"1+2", "3+4", "5+6"} {
+		tokens, _ := CalculatorInteractor.TokenizeInfix(text)
+		if _, err := interactor.AddExpression(context.Background(), "alice", text, tokens, ExpressionOptions{}); err != nil {
+			t.Fatalf("failed to add expression: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if tasks := interactor.WaitNextTasks(ctx, 2, nil); len(tasks) != 2 {
+		t.Fatalf("got %d steps, want 2", len(tasks))
+	}
+
+	if tasks := interactor.WaitNextTasks(ctx, 2, nil); len(tasks) != 1 {
+		t.Fatalf("got %d steps, want the 1 left", len(tasks))
+	}
+}
+
+func TestInteractorRoutesStepsByOperator(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	ids := make(map[string]uuid.UUID)
+	for _, text := range []string{"2+3", "4*5"} {
+		tokens, _ := CalculatorInteractor.TokenizeInfix(text)
+		id, err := interactor.AddExpression(context.Background(), "alice", text, tokens, ExpressionOptions{})
+		if err != nil {
+			t.Fatalf("failed to add expression: %v", err)
+		}
+		ids[text] = id
+	}
+
+	multiplication := NewOperators("*")
+
+	if task := interactor.GetNextTask(multiplication); task == nil || task.Expression.Id != ids["4*5"] {
+		t.Fatalf("got task %v, want the multiplication", task)
+	}
+
+	if task := interactor.GetNextTask(multiplication); task != nil {
+		t.Fatalf("got step of %s handed out to an agent which doesn't support it", task.Expression.Text)
+	}
+
+	if task := interactor.GetNextTask(nil); task == nil || task.Expression.Id != ids["2+3"] {
+		t.Fatalf("got task %v, want the addition", task)
+	}
+}
+
+func TestNewOperatorsCoveringEveryOperator(t *testing.T) {
+	if operators := NewOperators("/", "*", "-", "+"); operators != nil {
+		t.Errorf("got operators %v, want nil for every operator", operators)
+	}
+	if operators := NewOperators("+", "-"); operators == nil || operators.Supports("*") {
+		t.Errorf("got operators %v, want only + and -", operators)
+	}
+}
+
+func TestInteractorCancelsExpression(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	tokens, _ := CalculatorInteractor.TokenizeInfix("1+2")
+	queued, err := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to add expression: %v", err)
+	}
+
+	if err := interactor.CancelExpression(context.Background(), "bob", queued); !errors.Is(err, ErrExpressionNotFound) {
+		t.Fatalf("cancel by another owner: got %v, want %v", err, ErrExpressionNotFound)
+	}
+
+	if err := interactor.CancelExpression(context.Background(), "alice", queued); err != nil {
+		t.Fatalf("failed to cancel queued expression: %v", err)
+	}
+	if task := interactor.GetNextTask(nil); task != nil {
+		t.Fatal("expected canceled expression not to be handed out")
+	}
+
+	solving, _ := interactor.AddExpression(context.Background(), "alice", "1+2", tokens, ExpressionOptions{})
+	task := interactor.GetNextTask(nil)
+	if task == nil {
+		t.Fatal("expected step to be handed out")
+	}
+
+	if err := interactor.CancelExpression(context.Background(), "alice", solving); err != nil {
+		t.Fatalf("failed to cancel expression being solved: %v", err)
+	}
+
+	ctx := logging.WithStepID(context.Background(), task.StepID.String())
+	if err := interactor.SolveTask(ctx, solving, 3); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("result of a canceled expression: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	if err := interactor.CancelExpression(context.Background(), "alice", solving); !errors.Is(err, ErrExpressionFinished) {
+		t.Fatalf("cancel twice: got %v, want %v", err, ErrExpressionFinished)
+	}
+
+	for _, id := range []uuid.UUID{queued, solving} {
+		if expression := interactor.GetExpression(id); expression.Status != Canceled || expression.FinishedAt == nil {
+			t.Errorf("got %s expression, want canceled with a finish time", expression.Status)
+		}
+	}
+	if usage := interactor.Usage("alice"); usage.Pending != 0 {
+		t.Errorf("got %d pending expressions, want 0", usage.Pending)
+	}
+}
+
+func TestInteractorFailsExpression(t *testing.T) {
+	interactor := newTestInteractor(t)
+	ids := addExpressions(t, interactor, "alice", "1/0")
+	shared := addExpressions(t, interactor, "bob", "1/0")
+
+	task := interactor.GetNextTask(nil)
+	if task == nil || task.Expression.Id != ids[0] {
+		t.Fatal("expected the first expression to be handed out")
+	}
+
+	ctx := logging.WithStepID(context.Background(), task.StepID.String())
+	if err := interactor.FailTask(ctx, ids[0], "division by zero"); err != nil {
+		t.Fatalf("failed to fail step: %v", err)
+	}
+	if err := interactor.FailTask(ctx, ids[0], "division by zero"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("failure of a failed expression: got %v, want %v", err, ErrTaskNotFound)
+	}
+
+	for _, id := range []uuid.UUID{ids[0], shared[0]} {
+		expression := interactor.GetExpression(id)
+		if expression.Status != Failed || expression.FinishedAt == nil || !strings.Contains(expression.Error, "division by zero") {
+			t.Errorf("got %s expression with error %q, want failed with a finish time and the reason", expression.Status, expression.Error)
+		}
+	}
+	if task := interactor.GetNextTask(nil); task != nil {
+		t.Error("expected failed expressions not to be handed out")
+	}
+	if usage := interactor.Usage("alice"); usage.Pending != 0 {
+		t.Errorf("got %d pending expressions, want 0", usage.Pending)
+	}
+}
+
+func TestInteractorNotifiesWatchers(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	if _, err := interactor.SubmitExpression(context.Background(), "alice", "1+", ExpressionOptions{}); !errors.Is(err, ErrInvalidExpression) {
+		t.Fatalf("submit invalid expression: got %v, want %v", err, ErrInvalidExpression)
+	}
+
+	id, err := interactor.SubmitExpression(context.Background(), "alice", "1+2*3", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	isClosed := func(changed <-chan struct{}) bool {
+		select {
+		case <-changed:
+			return true
+		default:
+			return false
+		}
+	}
+
+	changed := interactor.WatchExpression(id)
+	task := interactor.GetNextTask(nil)
+	if isClosed(changed) {
+		t.Fatal("expected handing out a step not to notify watchers")
+	}
+
+	if err := interactor.SolveTask(context.Background(), task.Expression.Id, 6); err != nil {
+		t.Fatalf("failed to solve task: %v", err)
+	}
+	if !isClosed(changed) {
+		t.Fatal("expected solving a step to notify watchers")
+	}
+
+	changed = interactor.WatchExpression(id)
+	solveAll(t, interactor)
+	if !isClosed(changed) {
+		t.Fatal("expected finishing the expression to notify watchers")
+	}
+
+	if !isClosed(interactor.WatchExpression(id)) {
+		t.Error("expected a finished expression to be watched with a closed channel")
+	}
+}
@@ -0,0 +1,76 @@
+package orchestrator
+
+import (
+	"log/slog"
+
+	"github.com/gitgernit/go-calculator/internal/infra/metrics"
+)
+
+var stepDuration = metrics.NewHistogram(
+	"orchestrator_step_duration_seconds",
+	"Time between a step being handed out to an agent and its result being received.",
+	metrics.DefaultBuckets,
+	"operation",
+)
+
+var expressionsFinished = metrics.NewCounter(
+	"orchestrator_expressions_finished_total",
+	"Expressions which have left the queue, by final status.",
+	"status",
+)
+
+var expressionsReused = metrics.NewCounter(
+	"orchestrator_expressions_reused_total",
+	"Expressions answered without being solved on their own, by source of the result.",
+	"source",
+)
+
+var leader = metrics.NewGauge(
+	"orchestrator_leader",
+	"1 if the orchestrator holds the lease of the background jobs of the shared queue.",
+)
+
+func (i *Interactor) registerMetrics() {
+	metrics.NewGaugeFunc(
+		"orchestrator_queue_length",
+		"Unsolved expressions held by the orchestrator.",
+		nil,
+		func() []metrics.Sample {
+			total, _ := i.QueueLength()
+			return []metrics.Sample{{Value: float64(total)}}
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"orchestrator_queue_blocked",
+		"Unsolved expressions with a step currently being solved by an agent.",
+		nil,
+		func() []metrics.Sample {
+			_, blocked := i.QueueLength()
+			return []metrics.Sample{{Value: float64(blocked)}}
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"orchestrator_expressions",
+		"Stored expressions by status.",
+		[]string{"status"},
+		func() []metrics.Sample {
+			counts, err := i.CountExpressions()
+			if err != nil {
+				slog.Error("failed to count expressions", "error", err)
+				return nil
+			}
+
+			samples := make([]metrics.Sample, 0, len(counts))
+			for _, status := range []Status{Accepted, Done, Expired, Canceled, Failed} {
+				samples = append(samples, metrics.Sample{
+					LabelValues: []string{status.String()},
+					Value:       float64(counts[status]),
+				})
+			}
+
+			return samples
+		},
+	)
+}
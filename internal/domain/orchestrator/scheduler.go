@@ -0,0 +1,303 @@
+package orchestrator
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+const (
+	FIFOSchedulerName = "fifo"
+	FairSchedulerName = "fair"
+)
+
+// Scheduler holds the tasks which have a step ready to be solved and
+// decides which one is handed out next. Implementations are not
+// safe for concurrent use, the interactor serializes access to them.
+type Scheduler interface {
+	Push(task *Task)
+	Pop() *Task
+	// PopFunc hands out the task Pop would, skipping the ones accept
+	// returns false for, which are left in place.
+	PopFunc(accept func(*Task) bool) *Task
+	Remove(task *Task)
+	Len() int
+}
+
+func NewScheduler(name string) (Scheduler, error) {
+	switch name {
+	case FIFOSchedulerName:
+		return NewFIFOScheduler(), nil
+	case FairSchedulerName, "":
+		return NewFairScheduler(), nil
+	default:
+		return nil, fmt.Errorf("unknown scheduler: %s", name)
+	}
+}
+
+// FIFOScheduler hands out tasks in the order they became ready.
+type FIFOScheduler struct {
+	queue    *list.List
+	elements map[*Task]*list.Element
+}
+
+func NewFIFOScheduler() *FIFOScheduler {
+	return &FIFOScheduler{
+		queue:    list.New(),
+		elements: make(map[*Task]*list.Element),
+	}
+}
+
+func (s *FIFOScheduler) Push(task *Task) {
+	s.elements[task] = s.queue.PushBack(task)
+}
+
+func (s *FIFOScheduler) Pop() *Task {
+	front := s.queue.Front()
+	if front == nil {
+		return nil
+	}
+
+	task := s.queue.Remove(front).(*Task)
+	delete(s.elements, task)
+
+	return task
+}
+
+func (s *FIFOScheduler) PopFunc(accept func(*Task) bool) *Task {
+	for element := s.queue.Front(); element != nil; element = element.Next() {
+		task := element.Value.(*Task)
+		if !accept(task) {
+			continue
+		}
+
+		s.queue.Remove(element)
+		delete(s.elements, task)
+
+		return task
+	}
+
+	return nil
+}
+
+func (s *FIFOScheduler) Remove(task *Task) {
+	if element, ok := s.elements[task]; ok {
+		s.queue.Remove(element)
+		delete(s.elements, task)
+	}
+}
+
+func (s *FIFOScheduler) Len() int {
+	return s.queue.Len()
+}
+
+type scheduledTask struct {
+	task  *Task
+	seq   uint64
+	index int
+}
+
+// ownerQueue holds a single owner's ready tasks, earliest deadline first.
+// Tasks without a deadline go after the ones having it, in FIFO order.
+type ownerQueue struct {
+	owner string
+	tasks []*scheduledTask
+}
+
+func (q *ownerQueue) Len() int {
+	return len(q.tasks)
+}
+
+func (q *ownerQueue) Less(i, j int) bool {
+	a, b := q.tasks[i], q.tasks[j]
+	aDeadline, bDeadline := a.task.Expression.Deadline, b.task.Expression.Deadline
+
+	switch {
+	case aDeadline != nil && bDeadline != nil && !aDeadline.Equal(*bDeadline):
+		return aDeadline.Before(*bDeadline)
+	case aDeadline != nil && bDeadline == nil:
+		return true
+	case aDeadline == nil && bDeadline != nil:
+		return false
+	default:
+		return a.seq < b.seq
+	}
+}
+
+func (q *ownerQueue) Swap(i, j int) {
+	q.tasks[i], q.tasks[j] = q.tasks[j], q.tasks[i]
+	q.tasks[i].index = i
+	q.tasks[j].index = j
+}
+
+func (q *ownerQueue) Push(x any) {
+	scheduled := x.(*scheduledTask)
+	scheduled.index = len(q.tasks)
+	q.tasks = append(q.tasks, scheduled)
+}
+
+func (q *ownerQueue) Pop() any {
+	last := q.tasks[len(q.tasks)-1]
+	q.tasks = q.tasks[:len(q.tasks)-1]
+	last.index = -1
+
+	return last
+}
+
+// priorityLevel round-robins between owners having ready tasks of the
+// same priority.
+type priorityLevel struct {
+	owners  *list.List
+	byOwner map[string]*list.Element
+}
+
+func newPriorityLevel() *priorityLevel {
+	return &priorityLevel{
+		owners:  list.New(),
+		byOwner: make(map[string]*list.Element),
+	}
+}
+
+func (l *priorityLevel) push(scheduled *scheduledTask) {
+	owner := scheduled.task.Expression.Owner
+
+	element, ok := l.byOwner[owner]
+	if !ok {
+		element = l.owners.PushBack(&ownerQueue{owner: owner})
+		l.byOwner[owner] = element
+	}
+
+	heap.Push(element.Value.(*ownerQueue), scheduled)
+}
+
+func (l *priorityLevel) pop() *scheduledTask {
+	element := l.owners.Front()
+	if element == nil {
+		return nil
+	}
+
+	queue := element.Value.(*ownerQueue)
+	scheduled := heap.Pop(queue).(*scheduledTask)
+
+	if queue.Len() == 0 {
+		l.owners.Remove(element)
+		delete(l.byOwner, queue.owner)
+	} else {
+		l.owners.MoveToBack(element)
+	}
+
+	return scheduled
+}
+
+// popFunc is pop skipping the tasks accept returns false for. Owners having
+// none of them accepted keep their turn.
+func (l *priorityLevel) popFunc(accept func(*Task) bool) *scheduledTask {
+	for element := l.owners.Front(); element != nil; element = element.Next() {
+		queue := element.Value.(*ownerQueue)
+
+		next := -1
+		for i, scheduled := range queue.tasks {
+			if accept(scheduled.task) && (next < 0 || queue.Less(i, next)) {
+				next = i
+			}
+		}
+
+		if next < 0 {
+			continue
+		}
+
+		scheduled := heap.Remove(queue, next).(*scheduledTask)
+
+		if queue.Len() == 0 {
+			l.owners.Remove(element)
+			delete(l.byOwner, queue.owner)
+		} else {
+			l.owners.MoveToBack(element)
+		}
+
+		return scheduled
+	}
+
+	return nil
+}
+
+func (l *priorityLevel) remove(scheduled *scheduledTask) {
+	element, ok := l.byOwner[scheduled.task.Expression.Owner]
+	if !ok {
+		return
+	}
+
+	queue := element.Value.(*ownerQueue)
+	heap.Remove(queue, scheduled.index)
+
+	if queue.Len() == 0 {
+		l.owners.Remove(element)
+		delete(l.byOwner, queue.owner)
+	}
+}
+
+// FairScheduler serves higher priorities first and, within a priority,
+// alternates between owners so that a single owner with many expressions
+// cannot starve the others. Picking the owner is constant time, ordering
+// an owner's tasks by deadline is logarithmic in their amount.
+type FairScheduler struct {
+	levels    []*priorityLevel
+	scheduled map[*Task]*scheduledTask
+	seq       uint64
+}
+
+func NewFairScheduler() *FairScheduler {
+	levels := make([]*priorityLevel, HighPriority+1)
+	for i := range levels {
+		levels[i] = newPriorityLevel()
+	}
+
+	return &FairScheduler{
+		levels:    levels,
+		scheduled: make(map[*Task]*scheduledTask),
+	}
+}
+
+func (s *FairScheduler) Push(task *Task) {
+	s.seq++
+	scheduled := &scheduledTask{task: task, seq: s.seq}
+
+	s.scheduled[task] = scheduled
+	s.levels[task.Expression.Priority.clamp()].push(scheduled)
+}
+
+func (s *FairScheduler) Pop() *Task {
+	for priority := len(s.levels) - 1; priority >= 0; priority-- {
+		if scheduled := s.levels[priority].pop(); scheduled != nil {
+			delete(s.scheduled, scheduled.task)
+			return scheduled.task
+		}
+	}
+
+	return nil
+}
+
+func (s *FairScheduler) PopFunc(accept func(*Task) bool) *Task {
+	for priority := len(s.levels) - 1; priority >= 0; priority-- {
+		if scheduled := s.levels[priority].popFunc(accept); scheduled != nil {
+			delete(s.scheduled, scheduled.task)
+			return scheduled.task
+		}
+	}
+
+	return nil
+}
+
+func (s *FairScheduler) Remove(task *Task) {
+	scheduled, ok := s.scheduled[task]
+	if !ok {
+		return
+	}
+
+	delete(s.scheduled, task)
+	s.levels[task.Expression.Priority.clamp()].remove(scheduled)
+}
+
+func (s *FairScheduler) Len() int {
+	return len(s.scheduled)
+}
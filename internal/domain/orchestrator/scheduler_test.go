@@ -0,0 +1,166 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestTask(owner string, priority Priority) *Task {
+	return &Task{
+		Expression: Expression{
+			Id:       uuid.New(),
+			Owner:    owner,
+			Priority: priority,
+		},
+	}
+}
+
+func TestFairSchedulerRoundRobin(t *testing.T) {
+	scheduler := NewFairScheduler()
+
+	for range 3 {
+		scheduler.Push(newTestTask("alice", NormalPriority))
+	}
+	scheduler.Push(newTestTask("bob", NormalPriority))
+	scheduler.Push(newTestTask("carol", NormalPriority))
+
+	expected := []string{"alice", "bob", "carol", "alice", "alice"}
+	for _, owner := range expected {
+		task := scheduler.Pop()
+		if task == nil {
+			t.Fatalf("expected a task for %s, got nil", owner)
+		}
+		if task.Expression.Owner != owner {
+			t.Errorf("expected a task of %s, got %s", owner, task.Expression.Owner)
+		}
+	}
+
+	if task := scheduler.Pop(); task != nil {
+		t.Errorf("expected scheduler to be empty, got task of %s", task.Expression.Owner)
+	}
+}
+
+func TestFairSchedulerPriorities(t *testing.T) {
+	scheduler := NewFairScheduler()
+
+	low := newTestTask("alice", LowPriority)
+	normal := newTestTask("alice", NormalPriority)
+	high := newTestTask("bob", HighPriority)
+
+	scheduler.Push(low)
+	scheduler.Push(normal)
+	scheduler.Push(high)
+
+	if scheduler.Len() != 3 {
+		t.Fatalf("expected 3 tasks, got %d", scheduler.Len())
+	}
+
+	for _, expected := range []*Task{high, normal, low} {
+		if task := scheduler.Pop(); task != expected {
+			t.Errorf("expected priority %d, got %d", expected.Expression.Priority, task.Expression.Priority)
+		}
+	}
+}
+
+func TestFairSchedulerDeadlines(t *testing.T) {
+	scheduler := NewFairScheduler()
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+
+	withoutDeadline := newTestTask("alice", NormalPriority)
+	laterDeadline := newTestTask("alice", NormalPriority)
+	laterDeadline.Expression.Deadline = &later
+	soonDeadline := newTestTask("alice", NormalPriority)
+	soonDeadline.Expression.Deadline = &soon
+
+	scheduler.Push(withoutDeadline)
+	scheduler.Push(laterDeadline)
+	scheduler.Push(soonDeadline)
+
+	for _, expected := range []*Task{soonDeadline, laterDeadline, withoutDeadline} {
+		if task := scheduler.Pop(); task != expected {
+			t.Errorf("expected tasks to be ordered by deadline")
+		}
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	for name, scheduler := range map[string]Scheduler{
+		FIFOSchedulerName: NewFIFOScheduler(),
+		FairSchedulerName: NewFairScheduler(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			first := newTestTask("alice", NormalPriority)
+			second := newTestTask("alice", NormalPriority)
+
+			scheduler.Push(first)
+			scheduler.Push(second)
+			scheduler.Remove(first)
+
+			if scheduler.Len() != 1 {
+				t.Fatalf("expected 1 task, got %d", scheduler.Len())
+			}
+			if task := scheduler.Pop(); task != second {
+				t.Errorf("expected removed task to be skipped")
+			}
+			if task := scheduler.Pop(); task != nil {
+				t.Errorf("expected scheduler to be empty")
+			}
+		})
+	}
+}
+
+func TestFIFOScheduler(t *testing.T) {
+	scheduler := NewFIFOScheduler()
+
+	first := newTestTask("alice", LowPriority)
+	second := newTestTask("bob", HighPriority)
+
+	scheduler.Push(first)
+	scheduler.Push(second)
+
+	if task := scheduler.Pop(); task != first {
+		t.Errorf("expected tasks to be handed out in insertion order")
+	}
+	if task := scheduler.Pop(); task != second {
+		t.Errorf("expected tasks to be handed out in insertion order")
+	}
+}
+
+func TestSchedulerPopFunc(t *testing.T) {
+	for name, scheduler := range map[string]Scheduler{
+		FIFOSchedulerName: NewFIFOScheduler(),
+		FairSchedulerName: NewFairScheduler(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			skipped := newTestTask("alice", NormalPriority)
+			first := newTestTask("alice", NormalPriority)
+			second := newTestTask("bob", NormalPriority)
+
+			scheduler.Push(skipped)
+			scheduler.Push(first)
+			scheduler.Push(second)
+
+			accept := func(task *Task) bool { return task != skipped }
+
+			if task := scheduler.PopFunc(accept); task != first {
+				t.Errorf("expected the first accepted task")
+			}
+			if task := scheduler.PopFunc(accept); task != second {
+				t.Errorf("expected the second accepted task")
+			}
+			if task := scheduler.PopFunc(accept); task != nil {
+				t.Errorf("expected no more accepted tasks")
+			}
+
+			if scheduler.Len() != 1 {
+				t.Fatalf("expected 1 task left, got %d", scheduler.Len())
+			}
+			if task := scheduler.Pop(); task != skipped {
+				t.Errorf("expected skipped task to be left in place")
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// Settings are the settings of the orchestrator which can be changed while
+// it runs.
+type Settings struct {
+	// CostModel names the cost model, see NewCostModel.
+	CostModel      string
+	OperationTimes OperatorCost
+	TimePerDigit   time.Duration
+	// AgentWorkers is the amount of workers agents are asked to run, they
+	// run the amount they are configured with if it's 0.
+	AgentWorkers int
+}
+
+// SettingsUpdate changes the settings which are set, leaving the others as
+// they are. Operation times are changed per operator.
+type SettingsUpdate struct {
+	CostModel      *string
+	OperationTimes OperatorCost
+	TimePerDigit   *time.Duration
+	AgentWorkers   *int
+}
+
+// changesCosts reports whether the update changes the cost model.
+func (u SettingsUpdate) changesCosts() bool {
+	return u.CostModel != nil || len(u.OperationTimes) > 0 || u.TimePerDigit != nil
+}
+
+// SettingsChange is a change of the settings made by an actor.
+type SettingsChange struct {
+	Actor     string
+	Before    Settings
+	After     Settings
+	ChangedAt time.Time
+}
+
+// describeCosts returns the settings the cost model is made of. Models not
+// made by NewCostModel are named by their type.
+func describeCosts(costs CostModel) Settings {
+	switch costs := costs.(type) {
+	case OperatorCost:
+		return Settings{CostModel: OperatorCostModelName, OperationTimes: maps.Clone(costs)}
+	case OperandSizeCost:
+		return Settings{CostModel: OperandSizeCostModelName, OperationTimes: maps.Clone(costs.Operators), TimePerDigit: costs.PerDigit}
+	case ZeroCost:
+		return Settings{CostModel: ZeroCostModelName, OperationTimes: OperatorCost{}}
+	default:
+		return Settings{CostModel: fmt.Sprintf("%T", costs), OperationTimes: OperatorCost{}}
+	}
+}
+
+func (s Settings) apply(update SettingsUpdate) Settings {
+	s.OperationTimes = maps.Clone(s.OperationTimes)
+	if s.OperationTimes == nil {
+		s.OperationTimes = OperatorCost{}
+	}
+	maps.Copy(s.OperationTimes, update.OperationTimes)
+
+	if update.CostModel != nil {
+		s.CostModel = *update.CostModel
+	}
+	if update.TimePerDigit != nil {
+		s.TimePerDigit = *update.TimePerDigit
+	}
+	if update.AgentWorkers != nil {
+		s.AgentWorkers = *update.AgentWorkers
+	}
+
+	return s
+}
+
+func (s Settings) validate() error {
+	for operator, cost := range s.OperationTimes {
+		if cost < 0 {
+			return fmt.Errorf("%w: time of %s must not be negative", ErrInvalidSettings, operator)
+		}
+	}
+	if s.TimePerDigit < 0 {
+		return fmt.Errorf("%w: time per digit must not be negative", ErrInvalidSettings)
+	}
+	if s.AgentWorkers < 0 {
+		return fmt.Errorf("%w: agent workers must not be negative", ErrInvalidSettings)
+	}
+
+	return nil
+}
+
+// storedSettings is the JSON settings are recorded as, times in
+// milliseconds.
+type storedSettings struct {
+	CostModel        string         `json:"cost_model"`
+	OperationTimesMS map[string]int `json:"operation_times_ms"`
+	TimePerDigitMS   int            `json:"time_per_digit_ms"`
+	AgentWorkers     int            `json:"agent_workers"`
+}
+
+func (s Settings) marshal() string {
+	stored := storedSettings{
+		CostModel:        s.CostModel,
+		OperationTimesMS: make(map[string]int, len(s.OperationTimes)),
+		TimePerDigitMS:   int(s.TimePerDigit.Milliseconds()),
+		AgentWorkers:     s.AgentWorkers,
+	}
+	for operator, cost := range s.OperationTimes {
+		stored.OperationTimesMS[operator] = int(cost.Milliseconds())
+	}
+
+	data, _ := json.Marshal(stored)
+	return string(data)
+}
+
+func unmarshalSettings(data string) (Settings, error) {
+	var stored storedSettings
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return Settings{}, err
+	}
+
+	settings := Settings{
+		CostModel:      stored.CostModel,
+		OperationTimes: make(OperatorCost, len(stored.OperationTimesMS)),
+		TimePerDigit:   time.Duration(stored.TimePerDigitMS) * time.Millisecond,
+		AgentWorkers:   stored.AgentWorkers,
+	}
+	for operator, ms := range stored.OperationTimesMS {
+		settings.OperationTimes[operator] = time.Duration(ms) * time.Millisecond
+	}
+
+	return settings, nil
+}
+
+// Settings returns the current settings.
+func (i *Interactor) Settings() Settings {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	settings := i.settings
+	settings.OperationTimes = maps.Clone(settings.OperationTimes)
+
+	return settings
+}
+
+// UpdateSettings applies the update on behalf of the actor, recording the
+// change before applying it. Steps handed out from then on take the new
+// costs, the ones already handed out keep theirs.
+func (i *Interactor) UpdateSettings(ctx context.Context, actor string, update SettingsUpdate) (Settings, error) {
+	i.settingsMutex.Lock()
+	defer i.settingsMutex.Unlock()
+
+	before := i.Settings()
+	after := before.apply(update)
+	if err := after.validate(); err != nil {
+		return before, err
+	}
+
+	var costs CostModel
+	if update.changesCosts() {
+		var err error
+		costs, err = NewCostModel(after.CostModel, maps.Clone(after.OperationTimes), after.TimePerDigit)
+		if err != nil {
+			return before, fmt.Errorf("%w: %w", ErrInvalidSettings, err)
+		}
+	}
+
+	changedAt := time.Now().UTC()
+	err := db.Db.WithContext(ctx).Create(&db.SettingsChange{
+		ID:        uuid.New(),
+		Actor:     actor,
+		Before:    before.marshal(),
+		After:     after.marshal(),
+		ChangedAt: changedAt,
+	}).Error
+	if err != nil {
+		return before, fmt.Errorf("failed to record settings change: %w", err)
+	}
+
+	i.setSettings(after, costs, changedAt)
+
+	slog.InfoContext(ctx, "settings changed", "actor", actor, "before", before.marshal(), "after", after.marshal())
+
+	return after, nil
+}
+
+// setSettings applies the settings changed at changedAt, along with the
+// costs if they are changed.
+func (i *Interactor) setSettings(settings Settings, costs CostModel, changedAt time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if settings.AgentWorkers != i.settings.AgentWorkers {
+		close(i.agentWorkersChanged)
+		i.agentWorkersChanged = make(chan struct{})
+	}
+	i.settings = settings
+	if costs != nil {
+		i.costs = costs
+	}
+	i.settingsChangedAt = changedAt
+}
+
+// RestoreSettings applies the latest change of the settings recorded, so
+// changes outlive restarts of the orchestrator.
+func (i *Interactor) RestoreSettings(ctx context.Context) error {
+	return i.refreshSettings(ctx)
+}
+
+// refreshSettings applies the latest change of the settings recorded by
+// any orchestrator sharing the database, if it hasn't been applied yet.
+func (i *Interactor) refreshSettings(ctx context.Context) error {
+	i.settingsMutex.Lock()
+	defer i.settingsMutex.Unlock()
+
+	i.mutex.RLock()
+	appliedAt := i.settingsChangedAt
+	i.mutex.RUnlock()
+
+	var change db.SettingsChange
+	err := db.Db.WithContext(ctx).
+		Where("changed_at > ?", appliedAt).
+		Order("changed_at DESC").
+		Limit(1).
+		Find(&change).Error
+	if err != nil || change.ID == uuid.Nil {
+		return err
+	}
+
+	after, err := unmarshalSettings(change.After)
+	if err != nil {
+		return fmt.Errorf("invalid settings recorded by change %s: %w", change.ID, err)
+	}
+
+	costs, err := NewCostModel(after.CostModel, maps.Clone(after.OperationTimes), after.TimePerDigit)
+	if err != nil {
+		return fmt.Errorf("invalid settings recorded by change %s: %w", change.ID, err)
+	}
+
+	i.setSettings(after, costs, change.ChangedAt)
+
+	slog.InfoContext(ctx, "settings refreshed", "actor", change.Actor, "after", change.After)
+
+	return nil
+}
+
+// AgentWorkers returns the amount of workers agents are asked to run, along
+// with a channel closed once it changes.
+func (i *Interactor) AgentWorkers() (int, <-chan struct{}) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	return i.settings.AgentWorkers, i.agentWorkersChanged
+}
+
+// ListSettingsChanges returns up to limit of the latest changes of the
+// settings, the latest first.
+func (i *Interactor) ListSettingsChanges(limit int) ([]SettingsChange, error) {
+	var dbChanges []db.SettingsChange
+	if err := db.Db.Order("changed_at DESC").Limit(limit).Find(&dbChanges).Error; err != nil {
+		return nil, err
+	}
+
+	changes := make([]SettingsChange, len(dbChanges))
+	for idx, c := range dbChanges {
+		before, err := unmarshalSettings(c.Before)
+		if err != nil {
+			return nil, fmt.Errorf("invalid settings recorded by change %s: %w", c.ID, err)
+		}
+		after, err := unmarshalSettings(c.After)
+		if err != nil {
+			return nil, fmt.Errorf("invalid settings recorded by change %s: %w", c.ID, err)
+		}
+
+		changes[idx] = SettingsChange{
+			Actor:     c.Actor,
+			Before:    before,
+			After:     after,
+			ChangedAt: c.ChangedAt,
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,1001 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LeaseRenewalInterval is the interval orchestrators sharing a queue renew
+// the lease of the background jobs at.
+const LeaseRenewalInterval = time.Second
+
+// sharedPollInterval is the interval steps and changes made by other
+// orchestrators are polled for.
+const sharedPollInterval = 250 * time.Millisecond
+
+// leaderLease names the lease of the orchestrator running the background
+// jobs of a shared queue.
+const leaderLease = "background-jobs"
+
+// SharedQueueConfig configures the queue shared by the orchestrators
+// running against the same database.
+type SharedQueueConfig struct {
+	// Node identifies the orchestrator among the ones sharing the queue.
+	Node string
+	// LeaseTTL is how long the leader keeps running the background jobs
+	// without renewing its lease.
+	LeaseTTL time.Duration
+	// StepLease is how long agents may take to solve a step beyond its
+	// cost, after which it's handed out again.
+	StepLease time.Duration
+}
+
+type sharedQueue struct {
+	config SharedQueueConfig
+	leader atomic.Bool
+}
+
+// claimedStep is a step handed out by this orchestrator, kept to end its
+// span once solved.
+type claimedStep struct {
+	task       *Task
+	leaseUntil time.Time
+}
+
+// expressionVersion changes whenever a step of the expression is solved or
+// the expression finishes.
+type expressionVersion struct {
+	status db.Status
+	steps  int64
+}
+
+// NewSharedInteractor creates an interactor whose queue is stored in the
+// database, shared with the other orchestrators running against it, so any
+// of them hands out steps and accepts their results. Steps are handed out
+// by priority, then earliest deadline, then in the order they became ready.
+// Background jobs are run by a single orchestrator at a time, see
+// StartExpiring.
+func NewSharedInteractor(limits quota.Limits, costs CostModel, config SharedQueueConfig) *Interactor {
+	interactor := newInteractor(limits, nil, costs)
+	interactor.shared = &sharedQueue{config: config}
+	interactor.claimed = make(map[uuid.UUID]claimedStep)
+	interactor.versions = make(map[uuid.UUID]expressionVersion)
+
+	if err := interactor.adoptPendingExpressions(); err != nil {
+		panic(fmt.Sprintf("failed to load pending expressions: %v", err))
+	}
+
+	interactor.registerMetrics()
+
+	return interactor
+}
+
+// IsLeader reports whether the orchestrator runs the background jobs of
+// the queue, which is always the case unless the queue is shared.
+func (i *Interactor) IsLeader() bool {
+	return i.shared == nil || i.shared.leader.Load()
+}
+
+// lockForUpdate locks the rows selected by tx until the transaction ends,
+// skipping the ones locked already if skipLocked is set. SQLite locks the
+// whole database for the transaction instead.
+func lockForUpdate(tx *gorm.DB, skipLocked bool) *gorm.DB {
+	if !db.IsPostgres() {
+		return tx
+	}
+
+	locking := clause.Locking{Strength: "UPDATE"}
+	if skipLocked {
+		locking.Options = "SKIP LOCKED"
+	}
+
+	return tx.Clauses(locking)
+}
+
+func newQueuedTask(task *Task) *db.QueuedTask {
+	_, _, _, _, _, operation, _ := task.NextStep()
+
+	return &db.QueuedTask{
+		ExpressionID: task.Expression.Id,
+		Owner:        task.Expression.Owner,
+		Priority:     int(task.Expression.Priority),
+		Deadline:     task.Expression.Deadline,
+		Simulate:     task.Expression.Simulate,
+		RPN:          toStringSlice(task.RPN),
+		Operation:    operation,
+		SolvedSteps:  task.solvedSteps,
+		RequestID:    task.RequestID,
+		TraceContext: tracing.Inject(trace.ContextWithRemoteSpanContext(context.Background(), task.SpanContext)),
+		ReadyAt:      time.Now().UTC(),
+		Key:          task.key,
+	}
+}
+
+func taskFromQueued(row db.QueuedTask) *Task {
+	task := &Task{
+		Expression: Expression{
+			Id:       row.ExpressionID,
+			Owner:    row.Owner,
+			Status:   Accepted,
+			Priority: Priority(row.Priority),
+			Deadline: row.Deadline,
+			Simulate: row.Simulate,
+		},
+		RPN:         toTokenSlice(row.RPN),
+		RequestID:   row.RequestID,
+		ReadyAt:     row.ReadyAt,
+		SpanContext: trace.SpanContextFromContext(tracing.Extract(context.Background(), row.TraceContext)),
+		solvedSteps: row.SolvedSteps,
+		key:         row.Key,
+	}
+
+	if row.StepID != nil && row.AssignedAt != nil {
+		task.Blocked = true
+		task.StepID = *row.StepID
+		task.AssignedAt = *row.AssignedAt
+	}
+
+	return task
+}
+
+// markReady makes the next step of the row ready to be handed out again.
+func markReady(row *db.QueuedTask) {
+	row.StepID = nil
+	row.ClaimedBy = ""
+	row.AssignedAt = nil
+	row.LeaseUntil = nil
+	row.ReadyAt = time.Now().UTC()
+}
+
+// readyColumns are the columns markReady changes.
+var readyColumns = []string{"step_id", "claimed_by", "assigned_at", "lease_until", "ready_at"}
+
+// adoptPendingExpressions queues the accepted expressions which aren't,
+// the ones accepted before the queue was shared.
+func (i *Interactor) adoptPendingExpressions() error {
+	// Expressions may have been finished by an orchestrator which didn't
+	// share the queue meanwhile.
+	err := db.Db.
+		Where("expression_id NOT IN (?)", db.Db.Model(&db.Expression{}).Select("id").Where("status = ?", db.Accepted)).
+		Delete(&db.QueuedTask{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Db.Model(&db.QueuedTask{}).
+		Where("leader_id NOT IN (?)", db.Db.Model(&db.QueuedTask{}).Select("expression_id")).
+		Update("leader_id", nil).Error
+	if err != nil {
+		return err
+	}
+
+	var expressions []db.Expression
+	err = db.Db.
+		Where("status = ? AND id NOT IN (?)", db.Accepted, db.Db.Model(&db.QueuedTask{}).Select("expression_id")).
+		Find(&expressions).Error
+	if err != nil {
+		return err
+	}
+
+	for _, dbExpr := range expressions {
+		task := &Task{
+			Expression: *fromModel(dbExpr),
+			RPN:        CalculatorInteractor.TokenizedInfixToPolish(toTokenSlice(dbExpr.Tokens)),
+		}
+		task.key = expressionKey(task.RPN)
+
+		if len(task.RPN) == 1 {
+			if err := storeResult(context.Background(), db.Db, task); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := db.Db.Transaction(func(tx *gorm.DB) error {
+			created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(newQueuedTask(task))
+			if created.Error != nil || created.RowsAffected == 0 {
+				return created.Error
+			}
+
+			// Progress isn't persisted before the expression is queued, so
+			// it's solved from scratch and its steps are recorded anew.
+			return tx.Where("expression_id = ?", task.Expression.Id).Delete(&db.Step{}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enqueueShared stores the expression along with its queued task, unless
+// it has no operations. The task shares the evaluation of the same
+// expression being solved already, if it can, see follows.
+func (i *Interactor) enqueueShared(task *Task, expression *db.Expression) error {
+	var leader db.QueuedTask
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(expression).Error; err != nil {
+			return err
+		}
+
+		if len(task.RPN) == 1 {
+			return nil
+		}
+
+		row := newQueuedTask(task)
+
+		if task.key != "" {
+			// The leader is locked so it isn't finished without its
+			// followers meanwhile.
+			query := lockForUpdate(tx, false).
+				Where("key = ? AND leader_id IS NULL AND priority >= ?", task.key, row.Priority)
+			if !task.Expression.Simulate {
+				query = query.Where("simulate = ?", false)
+			}
+
+			if err := query.Order("ready_at").Limit(1).Find(&leader).Error; err != nil {
+				return err
+			}
+			if leader.ExpressionID != uuid.Nil {
+				row.LeaderID = &leader.ExpressionID
+			}
+		}
+
+		return tx.Create(row).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if leader.ExpressionID != uuid.Nil {
+		expressionsReused.Inc("in_flight")
+		slog.Debug("expression follows another one being solved",
+			"expression_id", task.Expression.Id.String(),
+			"leader_id", leader.ExpressionID.String(),
+		)
+		return nil
+	}
+
+	i.notifyReady()
+
+	return nil
+}
+
+// promoteFollowers has the first of the expressions sharing the evaluation
+// of the one queued as row, which stops being solved, take it over from
+// where it got, the others sharing its evaluation instead.
+func promoteFollowers(tx *gorm.DB, row *db.QueuedTask) error {
+	var followers []db.QueuedTask
+	err := tx.Where("leader_id = ?", row.ExpressionID).Order("priority DESC, ready_at").Find(&followers).Error
+	if err != nil || len(followers) == 0 {
+		return err
+	}
+
+	successor := followers[0]
+	successor.LeaderID = nil
+	successor.RPN = row.RPN
+	successor.Operation = row.Operation
+	successor.ReadyAt = time.Now().UTC()
+
+	err = tx.Model(&successor).
+		Select("leader_id", "rpn", "operation", "ready_at").
+		Updates(&successor).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&db.QueuedTask{}).
+		Where("leader_id = ?", row.ExpressionID).
+		Update("leader_id", successor.ExpressionID).Error
+}
+
+// finishFollowers stores the result of the solved task as the one of the
+// expressions sharing its evaluation, returning their ids.
+func finishFollowers(ctx context.Context, tx *gorm.DB, task *Task) ([]uuid.UUID, error) {
+	var followers []db.QueuedTask
+	if err := tx.Where("leader_id = ?", task.Expression.Id).Find(&followers).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(followers))
+	for _, row := range followers {
+		if err := tx.Delete(&row).Error; err != nil {
+			return nil, err
+		}
+
+		follower := taskFromQueued(row)
+		follower.RPN = slices.Clone(task.RPN)
+		if err := storeResult(ctx, tx, follower); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, row.ExpressionID)
+	}
+
+	return ids, nil
+}
+
+// failFollowers fails the expressions sharing the evaluation of the failed
+// one, returning their ids.
+func failFollowers(tx *gorm.DB, id uuid.UUID, reason error) ([]uuid.UUID, error) {
+	var followers []db.QueuedTask
+	if err := tx.Where("leader_id = ?", id).Find(&followers).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(followers))
+	for _, row := range followers {
+		if err := tx.Delete(&row).Error; err != nil {
+			return nil, err
+		}
+
+		if err := storeStatus(tx, row.ExpressionID, Failed, reason); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, row.ExpressionID)
+	}
+
+	return ids, nil
+}
+
+// countPending returns the amount of unsolved expressions of the owner,
+// all of them if owner is empty.
+func countPending(owner string) int {
+	tx := db.Db.Model(&db.QueuedTask{})
+	if owner != "" {
+		tx = tx.Where("owner = ?", owner)
+	}
+
+	var count int64
+	if err := tx.Count(&count).Error; err != nil {
+		slog.Error("failed to count pending expressions", "error", err)
+	}
+
+	return int(count)
+}
+
+// queueLengthShared returns the amount of unsolved expressions and how many
+// of them have a step currently being solved by an agent.
+func queueLengthShared() (total, blocked int) {
+	var count int64
+	err := db.Db.Model(&db.QueuedTask{}).Where("step_id IS NOT NULL").Count(&count).Error
+	if err != nil {
+		slog.Error("failed to count blocked expressions", "error", err)
+	}
+
+	return countPending(""), int(count)
+}
+
+// waitShared claims up to limit ready steps of the operators, polling for
+// the ones made ready by other orchestrators. It returns nil once ctx is
+// done.
+func (i *Interactor) waitShared(ctx context.Context, limit int, operators Operators) []*Task {
+	for {
+		i.mutex.RLock()
+		ready := i.ready
+		i.mutex.RUnlock()
+
+		if tasks := i.claimShared(limit, operators); len(tasks) > 0 {
+			return tasks
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ready:
+		case <-time.After(sharedPollInterval):
+		}
+	}
+}
+
+// claimShared hands out up to limit ready steps of the operators, skipping
+// the ones other orchestrators are handing out meanwhile. Overdue
+// expressions met along the way are expired.
+func (i *Interactor) claimShared(limit int, operators Operators) []*Task {
+	var claimed, expired []*Task
+	var leases []time.Time
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		query := lockForUpdate(tx, true).Where("step_id IS NULL AND leader_id IS NULL")
+		if operators != nil {
+			query = query.Where("operation IN ?", slices.Sorted(maps.Keys(operators)))
+		}
+
+		var rows []db.QueuedTask
+		err := query.
+			Order("priority DESC, deadline IS NULL, deadline, ready_at").
+			Limit(limit).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for idx := range rows {
+			row := &rows[idx]
+			task := taskFromQueued(*row)
+
+			if task.Expression.Overdue(now) {
+				if err := expireQueued(tx, row); err != nil {
+					return err
+				}
+				expired = append(expired, task)
+				continue
+			}
+
+			stepID := uuid.New()
+			leaseUntil := now.Add(i.StepCost(task) + i.shared.config.StepLease)
+			row.StepID = &stepID
+			row.ClaimedBy = i.shared.config.Node
+			row.AssignedAt = &now
+			row.LeaseUntil = &leaseUntil
+
+			updated := tx.Model(row).
+				Where("step_id IS NULL").
+				Select("step_id", "claimed_by", "assigned_at", "lease_until").
+				Updates(row)
+			if updated.Error != nil {
+				return updated.Error
+			}
+			if updated.RowsAffected == 0 {
+				continue
+			}
+
+			task.Blocked = true
+			task.StepID = stepID
+			task.AssignedAt = now
+			claimed = append(claimed, task)
+			leases = append(leases, leaseUntil)
+		}
+
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to claim steps", "error", err)
+		return nil
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, task := range expired {
+		i.notifyChanged(task.Expression.Id)
+		slog.InfoContext(task.Context(context.Background()), "expression expired")
+	}
+
+	for idx, task := range claimed {
+		i.startStepSpan(task)
+		i.claimed[task.StepID] = claimedStep{task: task, leaseUntil: leases[idx]}
+
+		slog.DebugContext(task.Context(context.Background()), "step assigned")
+	}
+
+	return claimed
+}
+
+// expireQueued removes the row from the queue, storing its expression as
+// expired.
+func expireQueued(tx *gorm.DB, row *db.QueuedTask) error {
+	deleted := tx.Where("expression_id = ?", row.ExpressionID).Delete(&db.QueuedTask{})
+	if deleted.Error != nil || deleted.RowsAffected == 0 {
+		return deleted.Error
+	}
+
+	if err := promoteFollowers(tx, row); err != nil {
+		return err
+	}
+
+	return storeStatus(tx, row.ExpressionID, Expired, ErrDeadlinePassed)
+}
+
+// endClaimedStep ends the span of a step handed out by this orchestrator.
+func (i *Interactor) endClaimedStep(stepID uuid.UUID, err error) {
+	if step, found := i.claimed[stepID]; found {
+		step.task.endStepSpan(err)
+		delete(i.claimed, stepID)
+	}
+}
+
+// releaseShared makes a step which couldn't be delivered ready again.
+func (i *Interactor) releaseShared(task *Task, stepID uuid.UUID) {
+	var row db.QueuedTask
+	markReady(&row)
+
+	updated := db.Db.Model(&row).
+		Where("expression_id = ? AND step_id = ?", task.Expression.Id, stepID).
+		Select(readyColumns).
+		Updates(&row)
+	if updated.Error != nil {
+		slog.ErrorContext(task.Context(context.Background()), "failed to release step", "error", updated.Error)
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.endClaimedStep(stepID, ErrStepReleased)
+
+	if updated.RowsAffected > 0 {
+		slog.DebugContext(task.Context(context.Background()), "step released")
+		i.notifyReady()
+	}
+}
+
+// solveShared applies the result of the step of the expression currently
+// handed out, by any of the orchestrators.
+func (i *Interactor) solveShared(ctx context.Context, id uuid.UUID, stepID string, result float64) error {
+	var task *Task
+	var found, expired bool
+	var followers []uuid.UUID
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var row db.QueuedTask
+		locked := lockForUpdate(tx, false).Where("expression_id = ?", id).Limit(1).Find(&row)
+		if locked.Error != nil || locked.RowsAffected == 0 {
+			return locked.Error
+		}
+
+		found = true
+		if row.StepID == nil || (stepID != "" && stepID != row.StepID.String()) {
+			return nil
+		}
+
+		task = taskFromQueued(row)
+		if task.Expression.Overdue(time.Now()) {
+			expired = true
+			return expireQueued(tx, &row)
+		}
+
+		arg1Index, _, operationIndex, arg1, arg2, operation, ok := task.NextStep()
+		if !ok {
+			return fmt.Errorf("no operation found in RPN")
+		}
+
+		stepDuration.Observe(time.Since(task.AssignedAt).Seconds(), operation)
+
+		if err := recordStep(ctx, tx, task, arg1, operation, arg2, result); err != nil {
+			return fmt.Errorf("failed to record step: %w", err)
+		}
+
+		task.apply(arg1Index, operationIndex, result)
+
+		if len(task.RPN) == 1 {
+			if err := tx.Delete(&row).Error; err != nil {
+				return err
+			}
+
+			if err := storeResult(ctx, tx, task); err != nil {
+				return err
+			}
+
+			var err error
+			followers, err = finishFollowers(ctx, tx, task)
+			return err
+		}
+
+		_, _, _, _, _, row.Operation, _ = task.NextStep()
+		row.RPN = toStringSlice(task.RPN)
+		row.SolvedSteps = task.solvedSteps
+		markReady(&row)
+
+		return tx.Model(&row).
+			Select(append([]string{"rpn", "operation", "solved_steps"}, readyColumns...)).
+			Updates(&row).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if task == nil {
+		return i.checkSolved(id, stepID, found)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	defer i.notifyChanged(id)
+
+	if expired {
+		i.endClaimedStep(task.StepID, ErrDeadlinePassed)
+		slog.InfoContext(task.Context(ctx), "expression expired")
+		return nil
+	}
+
+	i.endClaimedStep(task.StepID, nil)
+	slog.DebugContext(task.Context(ctx), "step solved", "result", result)
+
+	if len(task.RPN) > 1 {
+		i.notifyReady()
+		return nil
+	}
+
+	i.cacheResult(task)
+	for _, follower := range followers {
+		i.notifyChanged(follower)
+	}
+
+	return nil
+}
+
+// failShared fails the expression whose step is currently handed out, by
+// any of the orchestrators, along with the expressions sharing its
+// evaluation.
+func (i *Interactor) failShared(ctx context.Context, id uuid.UUID, stepID string, reason error) error {
+	var task *Task
+	var found bool
+	var followers []uuid.UUID
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var row db.QueuedTask
+		locked := lockForUpdate(tx, false).Where("expression_id = ?", id).Limit(1).Find(&row)
+		if locked.Error != nil || locked.RowsAffected == 0 {
+			return locked.Error
+		}
+
+		found = true
+		if row.StepID == nil || (stepID != "" && stepID != row.StepID.String()) {
+			return nil
+		}
+
+		task = taskFromQueued(row)
+		if err := tx.Delete(&row).Error; err != nil {
+			return err
+		}
+
+		if err := storeStatus(tx, id, Failed, reason); err != nil {
+			return err
+		}
+
+		var err error
+		followers, err = failFollowers(tx, id, reason)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fail expression: %v", err)
+	}
+
+	if task == nil {
+		return i.checkSolved(id, stepID, found)
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.endClaimedStep(task.StepID, reason)
+	i.notifyChanged(id)
+	for _, follower := range followers {
+		i.notifyChanged(follower)
+	}
+
+	slog.WarnContext(task.Context(ctx), "expression failed", "error", reason)
+
+	return nil
+}
+
+// cancelShared stops solving an expression of the owner, queued by any of
+// the orchestrators.
+func (i *Interactor) cancelShared(ctx context.Context, owner string, id uuid.UUID) error {
+	var row db.QueuedTask
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		locked := lockForUpdate(tx, false).Where("expression_id = ? AND owner = ?", id, owner).Limit(1).Find(&row)
+		if locked.Error != nil {
+			return locked.Error
+		}
+		if locked.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Delete(&row).Error; err != nil {
+			return err
+		}
+
+		if err := promoteFollowers(tx, &row); err != nil {
+			return err
+		}
+
+		return storeStatus(tx, id, Canceled, ErrExpressionCanceled)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		expr := i.GetExpression(id)
+		if expr == nil || expr.Owner != owner {
+			return ErrExpressionNotFound
+		}
+
+		return ErrExpressionFinished
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel expression: %v", err)
+	}
+
+	task := taskFromQueued(row)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.endClaimedStep(task.StepID, ErrExpressionCanceled)
+	i.notifyChanged(id)
+	slog.InfoContext(task.Context(ctx), "expression canceled")
+
+	return nil
+}
+
+// expireShared expires every ready task which has missed its deadline and
+// hands out again the steps whose lease has expired. It does nothing unless
+// the orchestrator is the leader.
+func (i *Interactor) expireShared() error {
+	if !i.IsLeader() {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	var overdue []db.QueuedTask
+	err := db.Db.Where("step_id IS NULL AND deadline <= ?", now).Find(&overdue).Error
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, row := range overdue {
+		task := taskFromQueued(row)
+
+		err := db.Db.Transaction(func(tx *gorm.DB) error {
+			deleted := tx.Where("expression_id = ? AND step_id IS NULL", row.ExpressionID).Delete(&db.QueuedTask{})
+			if deleted.Error != nil || deleted.RowsAffected == 0 {
+				return deleted.Error
+			}
+
+			if err := promoteFollowers(tx, &row); err != nil {
+				return err
+			}
+
+			return storeStatus(tx, row.ExpressionID, Expired, ErrDeadlinePassed)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to expire expression: %v", err))
+			continue
+		}
+
+		i.mutex.Lock()
+		i.notifyChanged(row.ExpressionID)
+		i.mutex.Unlock()
+
+		slog.InfoContext(task.Context(context.Background()), "expression expired")
+	}
+
+	var ready db.QueuedTask
+	markReady(&ready)
+
+	reclaimed := db.Db.Model(&ready).
+		Where("step_id IS NOT NULL AND lease_until < ?", now).
+		Select(readyColumns).
+		Updates(&ready)
+	if reclaimed.Error != nil {
+		errs = append(errs, fmt.Errorf("failed to reclaim steps: %v", reclaimed.Error))
+	} else if reclaimed.RowsAffected > 0 {
+		slog.Warn("steps handed out again after their lease expired", "count", reclaimed.RowsAffected)
+
+		i.mutex.Lock()
+		i.notifyReady()
+		i.mutex.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// renewLeadership takes or renews the lease of the background jobs,
+// stepping down if it can't.
+func (i *Interactor) renewLeadership(ctx context.Context) {
+	held, err := acquireLease(ctx, leaderLease, i.shared.config.Node, i.shared.config.LeaseTTL)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to renew lease", "lease", leaderLease, "error", err)
+	}
+
+	if held == i.shared.leader.Swap(held) {
+		return
+	}
+
+	if held {
+		leader.Set(1)
+		slog.InfoContext(ctx, "became leader", "node", i.shared.config.Node)
+	} else {
+		leader.Set(0)
+		slog.InfoContext(ctx, "stepped down as leader", "node", i.shared.config.Node)
+	}
+}
+
+// stepDown gives up the lease of the background jobs, so another
+// orchestrator takes it over without waiting for it to expire.
+func (i *Interactor) stepDown() {
+	if !i.shared.leader.Swap(false) {
+		return
+	}
+
+	err := db.Db.Where("name = ? AND holder = ?", leaderLease, i.shared.config.Node).Delete(&db.Lease{}).Error
+	if err != nil {
+		slog.Error("failed to release lease", "lease", leaderLease, "error", err)
+	}
+
+	leader.Set(0)
+	slog.Info("stepped down as leader", "node", i.shared.config.Node)
+}
+
+// acquireLease takes the lease on behalf of holder for ttl, if it's held
+// by holder already or has expired, reporting whether it's held.
+func acquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	lease := db.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+
+	err := db.Db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&lease).Error
+	if err != nil {
+		return false, err
+	}
+
+	updated := db.Db.WithContext(ctx).Model(&db.Lease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": lease.ExpiresAt})
+
+	return updated.RowsAffected == 1, updated.Error
+}
+
+// watchShared returns a channel closed on the next change of the
+// expression, made by any of the orchestrators.
+func (i *Interactor) watchShared(id uuid.UUID) <-chan struct{} {
+	versions, err := loadVersions([]uuid.UUID{id})
+	version, found := versions[id]
+	if err != nil || !found || version.status != db.Accepted {
+		if err != nil {
+			slog.Error("failed to watch expression", "id", id, "error", err)
+		}
+
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	changed, found := i.changes[id]
+	if !found {
+		changed = make(chan struct{})
+		i.changes[id] = changed
+		i.versions[id] = version
+	}
+
+	return changed
+}
+
+// loadVersions returns the versions of the expressions which exist.
+func loadVersions(ids []uuid.UUID) (map[uuid.UUID]expressionVersion, error) {
+	var statuses []struct {
+		ID     uuid.UUID
+		Status db.Status
+	}
+	err := db.Db.Model(&db.Expression{}).Select("id, status").Where("id IN ?", ids).Scan(&statuses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		ExpressionID uuid.UUID
+		Count        int64
+	}
+	err = db.Db.Model(&db.Step{}).
+		Select("expression_id, count(*) as count").
+		Where("expression_id IN ?", ids).
+		Group("expression_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[uuid.UUID]expressionVersion, len(statuses))
+	for _, s := range statuses {
+		versions[s.ID] = expressionVersion{status: s.Status}
+	}
+	for _, c := range counts {
+		if version, found := versions[c.ExpressionID]; found {
+			version.steps = c.Count
+			versions[c.ExpressionID] = version
+		}
+	}
+
+	return versions, nil
+}
+
+// pollChanges wakes up the watchers of the expressions changed by other
+// orchestrators.
+func (i *Interactor) pollChanges() error {
+	i.mutex.RLock()
+	ids := slices.Collect(maps.Keys(i.changes))
+	i.mutex.RUnlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	versions, err := loadVersions(ids)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for id, version := range versions {
+		if watched, found := i.versions[id]; found && watched != version {
+			i.notifyChanged(id)
+		}
+	}
+
+	return nil
+}
+
+// sweepClaimedSteps ends the spans of the steps handed out by this
+// orchestrator whose lease has expired, as their result may arrive at
+// another orchestrator.
+func (i *Interactor) sweepClaimedSteps() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	now := time.Now()
+	for stepID, step := range i.claimed {
+		if now.After(step.leaseUntil) {
+			i.endClaimedStep(stepID, ErrStepLeaseExpired)
+		}
+	}
+}
+
+// runShared keeps up with the other orchestrators sharing the queue until
+// ctx is done: it renews the lease of the background jobs, applies the
+// settings they change and wakes up the watchers of the expressions they
+// change.
+func (i *Interactor) runShared(ctx context.Context) {
+	i.renewLeadership(ctx)
+
+	renewal := time.NewTicker(LeaseRenewalInterval)
+	defer renewal.Stop()
+
+	poll := time.NewTicker(sharedPollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.stepDown()
+			return
+
+		case <-renewal.C:
+			i.renewLeadership(ctx)
+			i.sweepClaimedSteps()
+
+			if err := i.refreshSettings(ctx); err != nil {
+				slog.ErrorContext(ctx, "failed to refresh settings", "error", err)
+			}
+
+		case <-poll.C:
+			if err := i.pollChanges(); err != nil {
+				slog.ErrorContext(ctx, "failed to poll expression changes", "error", err)
+			}
+		}
+	}
+}
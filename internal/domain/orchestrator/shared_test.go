@@ -0,0 +1,217 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+)
+
+// newTestSharedInteractors creates interactors sharing the queue stored in
+// the same database, as orchestrators on different nodes do.
+func newTestSharedInteractors(t *testing.T, stepLease time.Duration, nodes ...string) []*Interactor {
+	t.Helper()
+
+	if err := db.Open(filepath.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	interactors := make([]*Interactor, len(nodes))
+	for idx, node := range nodes {
+		interactors[idx] = NewSharedInteractor(quota.Limits{}, ZeroCost{}, SharedQueueConfig{
+			Node:      node,
+			LeaseTTL:  time.Minute,
+			StepLease: stepLease,
+		})
+	}
+
+	return interactors
+}
+
+func TestSharedInteractorsSolveExpressionTogether(t *testing.T) {
+	nodes := newTestSharedInteractors(t, time.Minute, "a", "b")
+	a, b := nodes[0], nodes[1]
+
+	id, err := a.SubmitExpression(context.Background(), "alice", "(1+2)*(3+4)", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	if total, _ := b.QueueLength(); total != 1 {
+		t.Fatalf("got queue length %d on the other node, want 1", total)
+	}
+
+	first := b.GetNextTask(nil)
+	if first == nil {
+		t.Fatal("expected the other node to hand out the first step")
+	}
+	if task := a.GetNextTask(nil); task != nil {
+		t.Fatal("expected a step handed out by a node not to be handed out by another one")
+	}
+
+	// The result arrives at the node which didn't hand the step out.
+	firstCtx := logging.WithStepID(context.Background(), first.StepID.String())
+	if err := a.SolveTask(firstCtx, id, 3); err != nil {
+		t.Fatalf("failed to solve first step: %v", err)
+	}
+	if err := b.SolveTask(firstCtx, id, 3); err != nil {
+		t.Fatalf("resent result of a solved step: got %v, want nil", err)
+	}
+
+	solveAll(t, b)
+	solveAll(t, a)
+
+	if expression := b.GetExpression(id); expression.Status != Done || expression.Result != 21 {
+		t.Errorf("got %s expression with result %v, want done with 21", expression.Status, expression.Result)
+	}
+	if total, _ := a.QueueLength(); total != 0 {
+		t.Errorf("got queue length %d after solving, want 0", total)
+	}
+}
+
+func TestSharedInteractorsCancelAndWatch(t *testing.T) {
+	nodes := newTestSharedInteractors(t, time.Minute, "a", "b")
+	a, b := nodes[0], nodes[1]
+
+	id, err := a.SubmitExpression(context.Background(), "alice", "1+2*3", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	changed := a.WatchExpression(id)
+
+	if err := b.CancelExpression(context.Background(), "bob", id); !errors.Is(err, ErrExpressionNotFound) {
+		t.Fatalf("cancel expression of another owner: got %v, want %v", err, ErrExpressionNotFound)
+	}
+	if err := b.CancelExpression(context.Background(), "alice", id); err != nil {
+		t.Fatalf("failed to cancel expression: %v", err)
+	}
+	if err := a.CancelExpression(context.Background(), "alice", id); !errors.Is(err, ErrExpressionFinished) {
+		t.Fatalf("cancel canceled expression: got %v, want %v", err, ErrExpressionFinished)
+	}
+
+	if err := a.pollChanges(); err != nil {
+		t.Fatalf("failed to poll changes: %v", err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected the change made by the other node to notify watchers")
+	}
+
+	if task := a.GetNextTask(nil); task != nil {
+		t.Error("expected a canceled expression not to be handed out")
+	}
+}
+
+func TestSharedInteractorsElectOneLeader(t *testing.T) {
+	nodes := newTestSharedInteractors(t, time.Minute, "a", "b")
+	a, b := nodes[0], nodes[1]
+	a.shared.config.LeaseTTL = 100 * time.Millisecond
+
+	a.renewLeadership(context.Background())
+	b.renewLeadership(context.Background())
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("got leaders a=%v b=%v, want only a", a.IsLeader(), b.IsLeader())
+	}
+
+	// The leader stops renewing its lease, as if it had crashed.
+	time.Sleep(150 * time.Millisecond)
+
+	b.renewLeadership(context.Background())
+	a.renewLeadership(context.Background())
+	if a.IsLeader() || !b.IsLeader() {
+		t.Fatalf("got leaders a=%v b=%v after the lease expired, want only b", a.IsLeader(), b.IsLeader())
+	}
+
+	b.stepDown()
+	a.renewLeadership(context.Background())
+	if !a.IsLeader() || b.IsLeader() {
+		t.Errorf("got leaders a=%v b=%v after stepping down, want only a", a.IsLeader(), b.IsLeader())
+	}
+}
+
+func TestSharedInteractorsHandOutStepsAgainAfterLease(t *testing.T) {
+	nodes := newTestSharedInteractors(t, 50*time.Millisecond, "a", "b")
+	a, b := nodes[0], nodes[1]
+
+	id, err := a.SubmitExpression(context.Background(), "alice", "1+2", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	lost := b.GetNextTask(nil)
+	if lost == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Only the leader hands steps out again.
+	if err := b.ExpireOverdue(); err != nil {
+		t.Fatalf("failed to expire overdue: %v", err)
+	}
+	if task := b.GetNextTask(nil); task != nil {
+		t.Fatal("expected the step not to be handed out again by a node which isn't the leader")
+	}
+
+	a.renewLeadership(context.Background())
+	if err := a.ExpireOverdue(); err != nil {
+		t.Fatalf("failed to expire overdue: %v", err)
+	}
+
+	retried := a.GetNextTask(nil)
+	if retried == nil || retried.StepID == lost.StepID {
+		t.Fatal("expected the step to be handed out again with a new step id")
+	}
+
+	lostCtx := logging.WithStepID(context.Background(), lost.StepID.String())
+	if err := b.SolveTask(lostCtx, id, 3); !errors.Is(err, ErrStaleResult) {
+		t.Fatalf("result of a step handed out again: got %v, want %v", err, ErrStaleResult)
+	}
+
+	retriedCtx := logging.WithStepID(context.Background(), retried.StepID.String())
+	if err := b.SolveTask(retriedCtx, id, 3); err != nil {
+		t.Fatalf("failed to solve step: %v", err)
+	}
+
+	if expression := a.GetExpression(id); expression.Status != Done || expression.Result != 3 {
+		t.Errorf("got %s expression with result %v, want done with 3", expression.Status, expression.Result)
+	}
+}
+
+func TestSharedInteractorsFailExpression(t *testing.T) {
+	nodes := newTestSharedInteractors(t, time.Minute, "a", "b")
+	a, b := nodes[0], nodes[1]
+
+	id, err := a.SubmitExpression(context.Background(), "alice", "2+1/0", ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	task := b.GetNextTask(nil)
+	if task == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+
+	ctx := logging.WithStepID(context.Background(), task.StepID.String())
+	if err := a.FailTask(ctx, id, "division by zero"); err != nil {
+		t.Fatalf("failed to fail step: %v", err)
+	}
+
+	if expression := b.GetExpression(id); expression.Status != Failed || !strings.Contains(expression.Error, "division by zero") {
+		t.Errorf("got %s expression with error %q, want failed with the reason", expression.Status, expression.Error)
+	}
+	if total, _ := b.QueueLength(); total != 0 {
+		t.Errorf("got queue length %d after failing, want 0", total)
+	}
+}
@@ -0,0 +1,44 @@
+package quota
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRateLimited       = errors.New("rate limit exceeded")
+	ErrTooManyPending    = errors.New("too many pending expressions")
+	ErrExpressionTooLong = errors.New("expression is too long")
+	ErrTooManyOperators  = errors.New("expression has too many operators")
+)
+
+// Limits describes per-user restrictions on expression submission.
+// A zero value in any field disables the corresponding check.
+type Limits struct {
+	RequestsPerSecond float64
+	Burst             int
+	MaxPending        int
+	MaxLength         int
+	MaxOperators      int
+}
+
+type Usage struct {
+	Pending         int
+	TokensAvailable float64
+	Limits          Limits
+}
+
+// LimitError carries the duration after which the rejected request
+// may be retried.
+type LimitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
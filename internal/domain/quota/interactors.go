@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter is a token bucket limiter keyed by owner.
+type RateLimiter struct {
+	Limits  Limits
+	buckets map[string]*bucket
+	// swept is the time the refilled buckets were last dropped.
+	swept time.Time
+	now   func() time.Time
+	mutex sync.Mutex
+}
+
+func NewRateLimiter(limits Limits) *RateLimiter {
+	return &RateLimiter{
+		Limits:  limits,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) burst() float64 {
+	if l.Limits.Burst > 0 {
+		return float64(l.Limits.Burst)
+	}
+
+	return math.Max(1, l.Limits.RequestsPerSecond)
+}
+
+// refillTime is the time an empty bucket takes to refill.
+func (l *RateLimiter) refillTime() time.Duration {
+	return time.Duration(l.burst() / l.Limits.RequestsPerSecond * float64(time.Second))
+}
+
+// sweep drops the buckets which have refilled since they were last used,
+// as they are the same as new ones, at most once per refill time.
+func (l *RateLimiter) sweep(now time.Time) {
+	refillTime := l.refillTime()
+	if now.Sub(l.swept) < refillTime {
+		return
+	}
+	l.swept = now
+
+	for owner, b := range l.buckets {
+		if now.Sub(b.updated) >= refillTime {
+			delete(l.buckets, owner)
+		}
+	}
+}
+
+func (l *RateLimiter) refill(owner string) *bucket {
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[owner]
+	if !ok {
+		b = &bucket{tokens: l.burst(), updated: now}
+		l.buckets[owner] = b
+		return b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(l.burst(), b.tokens+elapsed*l.Limits.RequestsPerSecond)
+	b.updated = now
+
+	return b
+}
+
+// Allow consumes a token for the owner. If none is available, it returns
+// a *LimitError wrapping ErrRateLimited with the time until the next token.
+func (l *RateLimiter) Allow(owner string) error {
+	if l.Limits.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b := l.refill(owner)
+	if b.tokens >= 1 {
+		b.tokens--
+		return nil
+	}
+
+	wait := (1 - b.tokens) / l.Limits.RequestsPerSecond
+
+	return &LimitError{
+		Err:        ErrRateLimited,
+		RetryAfter: time.Duration(wait * float64(time.Second)),
+	}
+}
+
+func (l *RateLimiter) Tokens(owner string) float64 {
+	if l.Limits.RequestsPerSecond <= 0 {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.refill(owner).tokens
+}
@@ -0,0 +1,82 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(Limits{RequestsPerSecond: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for range 2 {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Fatalf("expected request to be allowed, got: %v", err)
+		}
+	}
+
+	err := limiter.Allow("alice")
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected rate limit error, got: %v", err)
+	}
+	if limitErr.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected retry after 500ms, got: %v", limitErr.RetryAfter)
+	}
+
+	if err := limiter.Allow("bob"); err != nil {
+		t.Errorf("expected other owners to be unaffected, got: %v", err)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if err := limiter.Allow("alice"); err != nil {
+		t.Errorf("expected bucket to refill, got: %v", err)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(Limits{})
+
+	for range 100 {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Fatalf("expected disabled limiter to allow everything, got: %v", err)
+		}
+	}
+}
+
+func TestRateLimiterDropsRefilledBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(Limits{RequestsPerSecond: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for _, owner := range []string{"alice", "bob"} {
+		if err := limiter.Allow(owner); err != nil {
+			t.Fatalf("expected request to be allowed, got: %v", err)
+		}
+	}
+
+	now = now.Add(750 * time.Millisecond)
+	if err := limiter.Allow("carol"); err != nil {
+		t.Fatalf("expected request to be allowed, got: %v", err)
+	}
+	if len(limiter.buckets) != 3 {
+		t.Fatalf("expected buckets not refilled yet to be kept, got %d", len(limiter.buckets))
+	}
+
+	now = now.Add(750 * time.Millisecond)
+	if err := limiter.Allow("carol"); err != nil {
+		t.Fatalf("expected request to be allowed, got: %v", err)
+	}
+	if _, ok := limiter.buckets["carol"]; !ok || len(limiter.buckets) != 1 {
+		t.Errorf("expected only the refilled buckets to be dropped, got %d buckets", len(limiter.buckets))
+	}
+
+	for range 2 {
+		if err := limiter.Allow("alice"); err != nil {
+			t.Errorf("expected a dropped bucket to start full, got: %v", err)
+		}
+	}
+}
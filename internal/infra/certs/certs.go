@@ -0,0 +1,278 @@
+// Package certs loads TLS certificates and CA bundles from files, reloading
+// them when the files change so certificates can be rotated without
+// restarting.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates found in CA bundle")
+var ErrNoPeerCertificate = errors.New("peer presented no certificate")
+var ErrNoServerName = errors.New("no server name to verify the server certificate against")
+
+type Config struct {
+	Enabled bool
+	// CertFile and KeyFile hold the certificate presented to peers,
+	// required for servers and optional for clients.
+	CertFile string
+	KeyFile  string
+	// CAFile is the bundle peer certificates are verified against. Servers
+	// require clients to present a certificate signed by it if set, clients
+	// verify servers against the system roots if it's empty.
+	CAFile string
+	// ServerName is the name clients expect in the server certificate,
+	// the host dialed if empty.
+	ServerName string
+	// ReloadInterval is how often the files are checked for changes, they
+	// aren't if it's zero.
+	ReloadInterval time.Duration
+}
+
+// fileState tells apart versions of a file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) fileState {
+	if path == "" {
+		return fileState{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Reloader holds the certificate and CA bundle of a Config as last loaded.
+type Reloader struct {
+	config Config
+
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	states [3]fileState
+	mutex  sync.RWMutex
+}
+
+// Load loads the files of the config and keeps reloading them on change
+// until ctx is done. It returns nil if TLS isn't enabled.
+func Load(ctx context.Context, config Config) (*Reloader, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	r, err := NewReloader(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ReloadInterval > 0 {
+		go r.Watch(ctx, config.ReloadInterval)
+	}
+
+	return r, nil
+}
+
+func NewReloader(config Config) (*Reloader, error) {
+	r := &Reloader{config: config}
+	if err := r.load(r.fileStates()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) fileStates() [3]fileState {
+	return [3]fileState{stat(r.config.CertFile), stat(r.config.KeyFile), stat(r.config.CAFile)}
+}
+
+func (r *Reloader) load(states [3]fileState) error {
+	var cert *tls.Certificate
+	if r.config.CertFile != "" || r.config.KeyFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate: %w", err)
+		}
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+	if r.config.CAFile != "" {
+		data, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to load CA bundle: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("failed to load CA bundle: %w", ErrNoCertificates)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cert = cert
+	r.pool = pool
+	r.states = states
+
+	return nil
+}
+
+// Reload loads the files again if any of them has changed since they were
+// last loaded. The previous certificate and bundle are kept if loading
+// fails, so a rotation caught halfway through doesn't break connections.
+func (r *Reloader) Reload() error {
+	states := r.fileStates()
+
+	r.mutex.RLock()
+	changed := states != r.states
+	r.mutex.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	return r.load(states)
+}
+
+// Watch reloads the files every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				slog.Error("failed to reload TLS certificates", "error", err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.cert
+}
+
+func (r *Reloader) certPool() *x509.CertPool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.pool
+}
+
+// verify verifies the chain presented by a peer against the CA bundle.
+func (r *Reloader) verify(rawCerts [][]byte, options x509.VerifyOptions) error {
+	if len(rawCerts) == 0 {
+		return ErrNoPeerCertificate
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	options.Roots = r.certPool()
+	options.Intermediates = x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		options.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(options)
+	return err
+}
+
+// ServerConfig returns the TLS config of a server presenting the current
+// certificate, and requiring clients to present one signed by the current
+// CA bundle if there's one. It returns nil for a nil Reloader.
+func (r *Reloader) ServerConfig() *tls.Config {
+	if r == nil {
+		return nil
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+	}
+
+	// Client certificates are verified by hand rather than with ClientCAs,
+	// which would pin the bundle loaded at startup.
+	if r.config.CAFile != "" {
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return r.verify(rawCerts, x509.VerifyOptions{
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+		}
+	}
+
+	return config
+}
+
+// ClientConfig returns the TLS config of a client verifying servers against
+// the current CA bundle, and presenting the current certificate if there's
+// one. The server certificate must be issued for the configured server
+// name, or host if there's none, which may be a DNS name or an IP address.
+// It returns nil for a nil Reloader.
+func (r *Reloader) ClientConfig(host string) *tls.Config {
+	if r == nil {
+		return nil
+	}
+
+	serverName := r.config.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.certificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+		// The server certificate is verified by VerifyConnection instead,
+		// against the bundle as last reloaded rather than a fixed RootCAs.
+		// The name is taken from the config rather than the connection
+		// state, which leaves it empty for IP addresses.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if serverName == "" {
+				return ErrNoServerName
+			}
+
+			rawCerts := make([][]byte, len(state.PeerCertificates))
+			for i, cert := range state.PeerCertificates {
+				rawCerts[i] = cert.Raw
+			}
+
+			return r.verify(rawCerts, x509.VerifyOptions{DNSName: serverName})
+		},
+	}
+}
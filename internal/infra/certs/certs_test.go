@@ -0,0 +1,277 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// authority is a CA generated for a test, issuing certificates in memory.
+type authority struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &authority{cert: cert, key: key, serial: 1}
+}
+
+// issue returns the PEM encoded certificate and key of a leaf for
+// 127.0.0.1 with the given usage.
+func (a *authority) issue(t *testing.T, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	return a.issueFor(t, usage, net.ParseIP("127.0.0.1"))
+}
+
+// issueFor returns the PEM encoded certificate and key of a leaf for the
+// IP address with the given usage.
+func (a *authority) issueFor(t *testing.T, usage x509.ExtKeyUsage, ip net.IP) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	a.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(a.serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{ip},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (a *authority) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.cert.Raw})
+}
+
+// writeFile writes data to the file, moving its modification time forward
+// so the change is noticed even within the resolution of the filesystem.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to touch %s: %v", path, err)
+	}
+}
+
+// writeConfig writes the certificate, key and CA bundle to files and
+// returns the Config loading them.
+func writeConfig(t *testing.T, certPEM, keyPEM, caPEM []byte) Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	config := Config{Enabled: true}
+
+	if certPEM != nil {
+		config.CertFile = filepath.Join(dir, "cert.pem")
+		config.KeyFile = filepath.Join(dir, "key.pem")
+		writeFile(t, config.CertFile, certPEM)
+		writeFile(t, config.KeyFile, keyPEM)
+	}
+	if caPEM != nil {
+		config.CAFile = filepath.Join(dir, "ca.pem")
+		writeFile(t, config.CAFile, caPEM)
+	}
+
+	return config
+}
+
+// serve serves requests over TLS with the config, responding with the
+// common name of the client certificate.
+func serve(t *testing.T, config *tls.Config) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	})}
+	go server.Serve(tls.NewListener(listener, config))
+	t.Cleanup(func() { server.Close() })
+
+	return "https://" + listener.Addr().String()
+}
+
+// get makes a request over a new connection, returning the serial number
+// of the server certificate.
+func get(url string, config *tls.Config) (*big.Int, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return resp.TLS.PeerCertificates[0].SerialNumber, nil
+}
+
+func TestReloaderRequiresClientCertificates(t *testing.T) {
+	ca := newAuthority(t)
+	serverCert, serverKey := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, x509.ExtKeyUsageClientAuth)
+
+	server, err := NewReloader(writeConfig(t, serverCert, serverKey, ca.pem()))
+	if err != nil {
+		t.Fatalf("failed to load server config: %v", err)
+	}
+	url := serve(t, server.ServerConfig())
+
+	client, err := NewReloader(writeConfig(t, clientCert, clientKey, ca.pem()))
+	if err != nil {
+		t.Fatalf("failed to load client config: %v", err)
+	}
+	if _, err := get(url, client.ClientConfig("127.0.0.1")); err != nil {
+		t.Fatalf("request with a client certificate: %v", err)
+	}
+
+	anonymous, _ := NewReloader(writeConfig(t, nil, nil, ca.pem()))
+	if _, err := get(url, anonymous.ClientConfig("127.0.0.1")); err == nil {
+		t.Error("expected request without a client certificate to fail")
+	}
+
+	otherCert, otherKey := newAuthority(t).issue(t, x509.ExtKeyUsageClientAuth)
+	stranger, _ := NewReloader(writeConfig(t, otherCert, otherKey, ca.pem()))
+	if _, err := get(url, stranger.ClientConfig("127.0.0.1")); err == nil {
+		t.Error("expected request with a certificate of another CA to fail")
+	}
+
+	untrusting, _ := NewReloader(writeConfig(t, clientCert, clientKey, newAuthority(t).pem()))
+	if _, err := get(url, untrusting.ClientConfig("127.0.0.1")); err == nil {
+		t.Error("expected server certificate of another CA to be rejected")
+	}
+}
+
+func TestReloaderReloadsChangedFiles(t *testing.T) {
+	ca := newAuthority(t)
+	serverCert, serverKey := ca.issue(t, x509.ExtKeyUsageServerAuth)
+
+	config := writeConfig(t, serverCert, serverKey, nil)
+	server, err := NewReloader(config)
+	if err != nil {
+		t.Fatalf("failed to load server config: %v", err)
+	}
+	url := serve(t, server.ServerConfig())
+
+	client, err := NewReloader(writeConfig(t, nil, nil, ca.pem()))
+	if err != nil {
+		t.Fatalf("failed to load client config: %v", err)
+	}
+
+	first, err := get(url, client.ClientConfig("127.0.0.1"))
+	if err != nil {
+		t.Fatalf("request before rotation: %v", err)
+	}
+
+	// A certificate caught halfway through being rotated is ignored.
+	rotatedCert, rotatedKey := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.CertFile, rotatedCert)
+	if err := server.Reload(); err == nil {
+		t.Error("expected mismatched key to fail reloading")
+	}
+	if serial, err := get(url, client.ClientConfig("127.0.0.1")); err != nil || serial.Cmp(first) != 0 {
+		t.Errorf("got serial %v, %v after failed reload, want %v", serial, err, first)
+	}
+
+	writeFile(t, config.KeyFile, rotatedKey)
+	if err := server.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if serial, err := get(url, client.ClientConfig("127.0.0.1")); err != nil || serial.Cmp(first) == 0 {
+		t.Errorf("got serial %v, %v after reload, want a new certificate", serial, err)
+	}
+}
+
+func TestClientConfigVerifiesServerName(t *testing.T) {
+	ca := newAuthority(t)
+	serverCert, serverKey := ca.issueFor(t, x509.ExtKeyUsageServerAuth, net.ParseIP("10.0.0.1"))
+
+	server, err := NewReloader(writeConfig(t, serverCert, serverKey, nil))
+	if err != nil {
+		t.Fatalf("failed to load server config: %v", err)
+	}
+	url := serve(t, server.ServerConfig())
+
+	client, err := NewReloader(writeConfig(t, nil, nil, ca.pem()))
+	if err != nil {
+		t.Fatalf("failed to load client config: %v", err)
+	}
+
+	if _, err := get(url, client.ClientConfig("127.0.0.1")); err == nil {
+		t.Error("expected server certificate for another IP address to be rejected")
+	}
+	if _, err := get(url, client.ClientConfig("")); !errors.Is(err, ErrNoServerName) {
+		t.Errorf("request without a server name: got %v, want %v", err, ErrNoServerName)
+	}
+	if _, err := get(url, client.ClientConfig("10.0.0.1")); err != nil {
+		t.Errorf("request to the server with the name it was issued for: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package gorm
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type slogWriter struct {
+	logger *slog.Logger
+}
+
+func (w slogWriter) Printf(format string, args ...interface{}) {
+	w.logger.Warn(fmt.Sprintf(format, args...), "component", "gorm")
+}
+
+// UseLogger routes slow queries and database errors to the given logger.
+func UseLogger(logger *slog.Logger) {
+	Db.Logger = gormlogger.New(slogWriter{logger: logger}, gormlogger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  gormlogger.Warn,
+		IgnoreRecordNotFoundError: true,
+	})
+}
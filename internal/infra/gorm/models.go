@@ -1,7 +1,13 @@
 package gorm
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -9,6 +15,9 @@ import (
 type User struct {
 	Login    string `gorm:"uniqueIndex;not null"`
 	Password string `gorm:"not null"`
+	// Admin marks the accounts created for the admins on startup, as
+	// opposed to registered by users.
+	Admin bool `gorm:"not null;default:false"`
 }
 
 type Status int
@@ -16,24 +25,182 @@ type Status int
 const (
 	Accepted Status = iota
 	Done
+	Expired
+	Canceled
+	Failed
 )
 
 type Expression struct {
-	ID     uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Owner  string    `gorm:"not null"`
-	Status Status    `gorm:"not null"`
-	Tokens []string  `gorm:"type:jsonb;not null;serializer:json"`
-	Result float64   `gorm:"not null"`
+	ID       uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Owner    string     `gorm:"not null"`
+	Text     string     `gorm:"not null;default:''"`
+	Status   Status     `gorm:"not null"`
+	Tokens   []string   `gorm:"type:jsonb;not null;serializer:json"`
+	Result   float64    `gorm:"not null"`
+	Priority int        `gorm:"not null;default:1"`
+	Deadline *time.Time `gorm:"index"`
+	Simulate bool       `gorm:"not null;default:false"`
+
+	CreatedAt  time.Time `gorm:"index"`
+	FinishedAt *time.Time
+	// Error is why the expression has ended without a result.
+	Error string `gorm:"not null;default:''"`
+}
+
+// Step is a single operation of an expression solved by an agent.
+type Step struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ExpressionID uuid.UUID `gorm:"type:uuid;not null;index:idx_steps_expression_number,priority:1"`
+	Number       int       `gorm:"not null;index:idx_steps_expression_number,priority:2"`
+	Arg1         string    `gorm:"not null"`
+	Operation    string    `gorm:"not null"`
+	Arg2         string    `gorm:"not null"`
+	Result       float64   `gorm:"not null"`
+	AgentID      string    `gorm:"not null"`
+	StartedAt    time.Time `gorm:"not null"`
+	FinishedAt   time.Time `gorm:"not null"`
+}
+
+// SettingsChange records a change of the runtime settings of the
+// orchestrator, the settings being stored as JSON.
+type SettingsChange struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Actor     string    `gorm:"not null"`
+	Before    string    `gorm:"not null"`
+	After     string    `gorm:"not null"`
+	ChangedAt time.Time `gorm:"not null;index"`
+}
+
+// QueuedTask is the queue state of an expression being solved, shared by
+// the orchestrators running against the database.
+type QueuedTask struct {
+	ExpressionID uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Owner        string     `gorm:"not null;index"`
+	Priority     int        `gorm:"not null"`
+	Deadline     *time.Time `gorm:"index"`
+	Simulate     bool       `gorm:"not null;default:false"`
+	RPN          []string   `gorm:"type:jsonb;not null;serializer:json"`
+	// Operation is the operator of the next step, so agents are only
+	// handed out steps they support.
+	Operation    string            `gorm:"not null"`
+	SolvedSteps  int               `gorm:"not null;default:0"`
+	RequestID    string            `gorm:"not null;default:''"`
+	TraceContext map[string]string `gorm:"type:jsonb;serializer:json"`
+	ReadyAt      time.Time         `gorm:"not null;index"`
+	// Key identifies the expression by its canonical RPN.
+	Key string `gorm:"not null;default:'';index"`
+	// LeaderID is set if the expression shares the evaluation of the one
+	// with the same key it names, in which case it isn't handed out.
+	LeaderID *uuid.UUID `gorm:"type:uuid;index"`
+
+	// StepID is set while the next step is handed out to an agent, by the
+	// orchestrator named by ClaimedBy, until LeaseUntil.
+	StepID     *uuid.UUID `gorm:"type:uuid;index"`
+	ClaimedBy  string     `gorm:"not null;default:''"`
+	AssignedAt *time.Time
+	LeaseUntil *time.Time `gorm:"index"`
+}
+
+// Lease is held by a single orchestrator at a time, until it expires
+// unless renewed.
+type Lease struct {
+	Name      string    `gorm:"primaryKey"`
+	Holder    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// Db is the connection every repository uses, set by Open.
+var Db *gorm.DB
+
+// Open connects Db to the database at path, which is either a PostgreSQL
+// URL or the path of a SQLite database, created if it doesn't exist.
+// SQLite databases are opened so several processes may share them.
+func Open(path string) error {
+	var dialector gorm.Dialector
+	switch {
+	case IsPostgresURL(path):
+		dialector = postgres.Open(path)
+	default:
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		dialector = sqlite.Open(path + separator + "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	}
+
+	conn, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return err
+	}
+
+	Db = conn
+
+	return nil
+}
+
+// IsPostgresURL reports whether path is a PostgreSQL URL rather than the
+// path of a SQLite database.
+func IsPostgresURL(path string) bool {
+	return strings.HasPrefix(path, "postgres://") || strings.HasPrefix(path, "postgresql://")
 }
 
-var Db, _ = gorm.Open(sqlite.Open("calculator.db"), &gorm.Config{})
+// IsPostgres reports whether Db is connected to PostgreSQL.
+func IsPostgres() bool {
+	return Db.Dialector.Name() == "postgres"
+}
+
+// models lists every table managed by Initialize.
+var models = []interface{}{&User{}, &Expression{}, &Step{}, &SettingsChange{}, &QueuedTask{}, &Lease{}}
 
 func Initialize() error {
-	err := Db.AutoMigrate(&User{})
-	err = Db.AutoMigrate(&Expression{})
+	for _, model := range models {
+		if err := Db.AutoMigrate(model); err != nil {
+			return err
+		}
+	}
+
+	// Expressions stored before creation times were recorded are considered
+	// created at the upgrade, as NULLs can't be paginated over.
+	return Db.Model(&Expression{}).
+		Where("created_at IS NULL").
+		Update("created_at", time.Now().UTC()).Error
+}
+
+// Ping checks that the database is reachable.
+func Ping(ctx context.Context) error {
+	sqlDb, err := Db.DB()
 	if err != nil {
 		return err
 	}
 
+	return sqlDb.PingContext(ctx)
+}
+
+// CheckMigrations reports an error unless every table and column of the
+// models exists, i.e. Initialize has been run against the database.
+func CheckMigrations(ctx context.Context) error {
+	migrator := Db.WithContext(ctx).Migrator()
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: Db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table %s is missing", stmt.Schema.Table)
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+
+			if !migrator.HasColumn(model, field.DBName) {
+				return fmt.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
 	return nil
 }
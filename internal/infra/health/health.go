@@ -0,0 +1,120 @@
+// Package health aggregates named readiness checks of a process.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a single run of all checks.
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc reports nil when the dependency it checks is usable.
+type CheckFunc func(ctx context.Context) error
+
+type Result struct {
+	Name  string
+	Error error
+}
+
+type Report struct {
+	Results []Result
+}
+
+func (r Report) Healthy() bool {
+	for _, result := range r.Results {
+		if result.Error != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Checker struct {
+	checks map[string]CheckFunc
+	mutex  sync.RWMutex
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: make(map[string]CheckFunc)}
+}
+
+// Register adds the check under the given name, replacing a previously
+// registered check with the same name.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checks[name] = check
+}
+
+// Check runs all registered checks concurrently and returns their results
+// sorted by name.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mutex.RLock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	results := make([]Result, 0, len(checks))
+	resultsMutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+
+			resultsMutex.Lock()
+			results = append(results, Result{Name: name, Error: err})
+			resultsMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	return Report{Results: results}
+}
+
+// Flag is a check which passes once it has been set, e.g. after a listener
+// has been bound.
+type Flag struct {
+	err   error
+	set   bool
+	mutex sync.RWMutex
+}
+
+// NewFlag creates an unset flag, which fails with err until it's set.
+func NewFlag(err error) *Flag {
+	return &Flag{err: err}
+}
+
+func (f *Flag) Set(set bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.set = set
+}
+
+func (f *Flag) Check(ctx context.Context) error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if !f.set {
+		return f.err
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckerReportsFailingChecks(t *testing.T) {
+	checker := NewChecker()
+	failure := errors.New("database is down")
+
+	checker.Register("grpc", func(ctx context.Context) error { return nil })
+	checker.Register("database", func(ctx context.Context) error { return failure })
+
+	report := checker.Check(context.Background())
+	if report.Healthy() {
+		t.Fatal("report with a failing check is healthy")
+	}
+
+	if len(report.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(report.Results))
+	}
+
+	if report.Results[0].Name != "database" || report.Results[0].Error != failure {
+		t.Errorf("got first result %+v, want failing database check", report.Results[0])
+	}
+
+	if report.Results[1].Name != "grpc" || report.Results[1].Error != nil {
+		t.Errorf("got second result %+v, want passing grpc check", report.Results[1])
+	}
+}
+
+func TestEmptyCheckerIsHealthy(t *testing.T) {
+	if !NewChecker().Check(context.Background()).Healthy() {
+		t.Error("checker without checks is unhealthy")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	notReady := errors.New("listener is not up")
+	flag := NewFlag(notReady)
+
+	if err := flag.Check(context.Background()); err != notReady {
+		t.Fatalf("got %v before set, want %v", err, notReady)
+	}
+
+	flag.Set(true)
+	if err := flag.Check(context.Background()); err != nil {
+		t.Fatalf("got %v after set, want nil", err)
+	}
+
+	flag.Set(false)
+	if err := flag.Check(context.Background()); err != notReady {
+		t.Fatalf("got %v after unset, want %v", err, notReady)
+	}
+}
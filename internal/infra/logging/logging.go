@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	expressionIDKey
+	stepIDKey
+	agentIDKey
+)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func WithExpressionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, expressionIDKey, id)
+}
+
+func WithStepID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, stepIDKey, id)
+}
+
+func WithAgentID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, agentIDKey, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func ExpressionID(ctx context.Context) string {
+	id, _ := ctx.Value(expressionIDKey).(string)
+	return id
+}
+
+func StepID(ctx context.Context) string {
+	id, _ := ctx.Value(stepIDKey).(string)
+	return id
+}
+
+func AgentID(ctx context.Context) string {
+	id, _ := ctx.Value(agentIDKey).(string)
+	return id
+}
+
+// Handler adds the correlation ids stored in the context to every record.
+type Handler struct {
+	slog.Handler
+}
+
+func (h Handler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := ExpressionID(ctx); id != "" {
+		record.AddAttrs(slog.String("expression_id", id))
+	}
+	if id := StepID(ctx); id != "" {
+		record.AddAttrs(slog.String("step_id", id))
+	}
+	if id := AgentID(ctx); id != "" {
+		record.AddAttrs(slog.String("agent_id", id))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return Handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h Handler) WithGroup(name string) slog.Handler {
+	return Handler{h.Handler.WithGroup(name)}
+}
+
+// New creates a logger writing records of the given level and above to w
+// in either "json" or "text" format.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", level)
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json", "":
+		handler = slog.NewJSONHandler(w, options)
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+
+	return slog.New(Handler{handler}), nil
+}
+
+// Setup replaces the default slog logger with one writing to stderr.
+func Setup(level, format string) error {
+	logger, err := New(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// written reports whether a record with the message was written in either
+// format.
+func written(out, msg string) bool {
+	return strings.Contains(out, "msg="+msg) || strings.Contains(out, `"msg":"`+msg+`"`)
+}
+
+func TestNewParsesLevelAndFormat(t *testing.T) {
+	for _, test := range []struct {
+		level, format string
+		wantDebug     bool
+		wantInfo      bool
+		wantJSON      bool
+	}{
+		{"debug", "json", true, true, true},
+		{"info", "", false, true, true},
+		{"WARN", "text", false, false, false},
+		{"error", "TEXT", false, false, false},
+		{"info+2", "json", false, false, true},
+	} {
+		var out bytes.Buffer
+		logger, err := New(&out, test.level, test.format)
+		if err != nil {
+			t.Fatalf("%s/%s: failed to create logger: %v", test.level, test.format, err)
+		}
+
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Error("error")
+
+		if got := written(out.String(), "debug"); got != test.wantDebug {
+			t.Errorf("%s/%s: got debug records written %v, want %v", test.level, test.format, got, test.wantDebug)
+		}
+		if got := written(out.String(), "info"); got != test.wantInfo {
+			t.Errorf("%s/%s: got info records written %v, want %v", test.level, test.format, got, test.wantInfo)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if got := json.Valid([]byte(lines[len(lines)-1])); got != test.wantJSON {
+			t.Errorf("%s/%s: got JSON %v for %q, want %v", test.level, test.format, got, lines[len(lines)-1], test.wantJSON)
+		}
+	}
+
+	for _, test := range []struct {
+		level, format string
+	}{
+		{"loud", "json"},
+		{"", "json"},
+		{"info", "xml"},
+	} {
+		if _, err := New(&bytes.Buffer{}, test.level, test.format); err == nil {
+			t.Errorf("%s/%s: expected the logger to be rejected", test.level, test.format)
+		}
+	}
+}
+
+func TestHandlerAddsContextAttributes(t *testing.T) {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	})
+
+	for _, test := range []struct {
+		name string
+		ctx  context.Context
+		want map[string]string
+	}{
+		{"empty", context.Background(), map[string]string{}},
+		{"request", WithRequestID(context.Background(), "r1"), map[string]string{"request_id": "r1"}},
+		{"expression", WithExpressionID(context.Background(), "e1"), map[string]string{"expression_id": "e1"}},
+		{"step", WithStepID(context.Background(), "s1"), map[string]string{"step_id": "s1"}},
+		{"agent", WithAgentID(context.Background(), "a1"), map[string]string{"agent_id": "a1"}},
+		{
+			"all",
+			WithAgentID(WithStepID(WithExpressionID(WithRequestID(trace.ContextWithSpanContext(context.Background(), spanContext), "r1"), "e1"), "s1"), "a1"),
+			map[string]string{
+				"request_id":    "r1",
+				"expression_id": "e1",
+				"step_id":       "s1",
+				"agent_id":      "a1",
+				"trace_id":      spanContext.TraceID().String(),
+				"span_id":       spanContext.SpanID().String(),
+			},
+		},
+	} {
+		var out bytes.Buffer
+		logger, err := New(&out, "info", "json")
+		if err != nil {
+			t.Fatalf("failed to create logger: %v", err)
+		}
+
+		logger.With("component", "test").InfoContext(test.ctx, "hello")
+
+		var record map[string]any
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatalf("%s: failed to parse record %q: %v", test.name, out.String(), err)
+		}
+
+		for _, key := range []string{"request_id", "expression_id", "step_id", "agent_id", "trace_id", "span_id"} {
+			got, _ := record[key].(string)
+			if got != test.want[key] {
+				t.Errorf("%s: got %s %q, want %q", test.name, key, got, test.want[key])
+			}
+		}
+		if record["component"] != "test" {
+			t.Errorf("%s: got component %v, want the attributes of the logger kept", test.name, record["component"])
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package metrics implements a minimal subset of Prometheus metric types
+// and the text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var DefaultRegistry = NewRegistry()
+
+type Collector interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+type Registry struct {
+	collectors map[string]Collector
+	mutex      sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register adds the collector to the registry, replacing a previously
+// registered collector with the same name.
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors[c.Name()] = c
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mutex.RUnlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mutex.RLock()
+		c, ok := r.collectors[name]
+		r.mutex.RUnlock()
+
+		if !ok {
+			continue
+		}
+
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) Name() string {
+	return d.name
+}
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+	return err
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+func formatLabels(names, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+type series struct {
+	labels []string
+	value  float64
+}
+
+// vector stores a float value per combination of label values.
+type vector struct {
+	desc
+	series map[string]*series
+	mutex  sync.Mutex
+}
+
+func (v *vector) add(delta float64, values []string) {
+	key := v.key(values)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(values)}
+		v.series[key] = s
+	}
+
+	s.value += delta
+}
+
+func (v *vector) set(value float64, values []string) {
+	key := v.key(values)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.series[key] = &series{labels: slices.Clone(values), value: value}
+}
+
+func (v *vector) Write(w io.Writer) error {
+	v.mutex.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		s := v.series[key]
+		lines = append(lines, v.name+formatLabels(v.labels, s.labels)+" "+formatValue(s.value)+"\n")
+	}
+	v.mutex.Unlock()
+
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type Counter struct {
+	vector
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vector{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		series: make(map[string]*series),
+	}}
+	DefaultRegistry.Register(c)
+
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+
+	c.add(delta, labelValues)
+}
+
+type Gauge struct {
+	vector
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vector{
+		desc:   desc{name: name, help: help, kind: "gauge", labels: labels},
+		series: make(map[string]*series),
+	}}
+	DefaultRegistry.Register(g)
+
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// GaugeFunc is a gauge whose samples are computed on every scrape.
+type GaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	g := &GaugeFunc{
+		desc:    desc{name: name, help: help, kind: "gauge", labels: labels},
+		collect: collect,
+	}
+	DefaultRegistry.Register(g)
+
+	return g
+}
+
+func (g *GaugeFunc) Write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+
+	for _, sample := range g.collect() {
+		g.key(sample.LabelValues)
+
+		line := g.name + formatLabels(g.labels, sample.LabelValues) + " " + formatValue(sample.Value) + "\n"
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type Histogram struct {
+	desc
+	buckets []float64
+	series  map[string]*histogramSeries
+	mutex   sync.Mutex
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  make(map[string]*histogramSeries),
+	}
+	DefaultRegistry.Register(h)
+
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) Write(w io.Writer) error {
+	var b strings.Builder
+
+	h.mutex.Lock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+
+		for i, bound := range h.buckets {
+			b.WriteString(h.name + "_bucket" + formatLabels(h.labels, s.labels, "le", formatValue(bound)) + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+		}
+		b.WriteString(h.name + "_bucket" + formatLabels(h.labels, s.labels, "le", "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+		b.WriteString(h.name + "_sum" + formatLabels(h.labels, s.labels) + " " + formatValue(s.sum) + "\n")
+		b.WriteString(h.name + "_count" + formatLabels(h.labels, s.labels) + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+	h.mutex.Unlock()
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
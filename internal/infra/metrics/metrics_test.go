@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCounterExposition(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Handled requests.", "method", "path")
+	counter.Inc("GET", "/a")
+	counter.Add(2, "GET", "/a")
+	counter.Inc("POST", `/"quoted"`)
+
+	var b strings.Builder
+	if err := counter.Write(&b); err != nil {
+		t.Fatalf("failed to write counter: %v", err)
+	}
+
+	expected := `# HELP test_requests_total Handled requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",path="/a"} 3
+test_requests_total{method="POST",path="/\"quoted\""} 1
+`
+	if b.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var b strings.Builder
+	if err := histogram.Write(&b); err != nil {
+		t.Fatalf("failed to write histogram: %v", err)
+	}
+
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 5.55
+test_duration_seconds_count 3
+`
+	if b.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	gauge := NewGaugeFunc("test_queue", "Queue length.", []string{"state"}, func() []Sample {
+		return []Sample{
+			{LabelValues: []string{"ready"}, Value: 2},
+			{LabelValues: []string{"blocked"}, Value: 1},
+		}
+	})
+
+	var b strings.Builder
+	if err := gauge.Write(&b); err != nil {
+		t.Fatalf("failed to write gauge: %v", err)
+	}
+
+	if !strings.Contains(b.String(), `test_queue{state="ready"} 2`) ||
+		!strings.Contains(b.String(), `test_queue{state="blocked"} 1`) {
+		t.Errorf("unexpected exposition:\n%s", b.String())
+	}
+}
@@ -0,0 +1,51 @@
+// Package retry implements exponential backoff for retrying requests to
+// and reconnecting to remote services.
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+var DefaultBackoff = Backoff{Min: 100 * time.Millisecond, Max: 10 * time.Second}
+
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Delay returns the delay before retrying for the attempt-th time, counting
+// from 0. The delay starts at Min and doubles with every attempt up to Max,
+// less a random jitter of up to a half, so clients failing at the same
+// time don't retry in lockstep.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Min
+	for range attempt {
+		if delay >= b.Max/2 {
+			delay = b.Max
+			break
+		}
+		delay *= 2
+	}
+	delay = min(delay, b.Max)
+
+	if delay <= 1 {
+		return delay
+	}
+
+	return delay - rand.N(delay/2)
+}
+
+// Sleep waits for d to pass, returning ctx.Err() if ctx is done first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
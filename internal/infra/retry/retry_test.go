@@ -0,0 +1,46 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+
+	for attempt, want := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		for range 100 {
+			delay := backoff.Delay(attempt)
+			if delay > want || delay <= want/2 {
+				t.Fatalf("attempt %d: got delay %s, want within (%s, %s]", attempt, delay, want/2, want)
+			}
+		}
+	}
+
+	if delay := backoff.Delay(1000); delay > time.Second {
+		t.Errorf("got delay %s after many attempts, want at most %s", delay, time.Second)
+	}
+}
+
+func TestSleepStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := Sleep(ctx, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleep took %s after the context was done", elapsed)
+	}
+}
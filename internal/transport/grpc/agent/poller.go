@@ -2,85 +2,491 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
+	"sync"
 
 	"github.com/gitgernit/go-calculator/internal/domain/agent"
 	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/retry"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
 	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
+var errNotSubscribed = errors.New("not subscribed to tasks")
+
+// pendingResult is a result which hasn't been acknowledged yet.
+type pendingResult struct {
+	result *proto.TaskResult
+	done   chan error
+}
+
+// GRPCPoller receives steps over a GetTasks stream, announcing how many of
+// them it solves at once so the orchestrator never sends more. When the
+// stream breaks, it resubscribes with backoff and resends every result which
+// hasn't been acknowledged.
 type GRPCPoller struct {
-	client proto.OrchestratorServiceClient
-	conn   *grpc.ClientConn
-	stream proto.OrchestratorService_GetTasksClient
+	client  proto.OrchestratorServiceClient
+	conn    *grpc.ClientConn
+	agentID string
+	// capacity is announced to the orchestrator, it changes along with
+	// the amount of workers.
+	capacity int
+	// operators are advertised to the orchestrator, so it only hands out
+	// steps of them.
+	operators []string
+	cancel    context.CancelFunc
+
+	// tasks is filled by the receiving goroutine, so it never blocks on
+	// workers waiting for acknowledgements.
+	tasks      []*agent.Task
+	tasksReady chan struct{}
+
+	// workers receives the amount of workers the orchestrator asks for,
+	// only the latest one is kept.
+	workers chan int
+
+	stream    proto.OrchestratorService_GetTasksClient
+	streamErr error
+	pending   map[string]*pendingResult
+	mutex     sync.Mutex
+
+	// sendMutex serializes sends, which aren't safe to call concurrently
+	// on a single stream.
+	sendMutex sync.Mutex
 }
 
-func NewGRPCPoller(host, port string) (*GRPCPoller, error) {
-	conn, err := grpc.Dial(
+// NewGRPCPoller connects to the orchestrator at host and port, over TLS
+// with tlsConfig unless it's nil.
+func NewGRPCPoller(host, port, agentID string, capacity int, operators []string, tlsConfig *tls.Config) (*GRPCPoller, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%s", host, port),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	client := proto.NewOrchestratorServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
 
-	stream, err := client.GetTasks(context.Background())
-	if err != nil {
-		return nil, err
+	p := &GRPCPoller{
+		client:     proto.NewOrchestratorServiceClient(conn),
+		conn:       conn,
+		agentID:    agentID,
+		capacity:   capacity,
+		operators:  operators,
+		cancel:     cancel,
+		tasksReady: make(chan struct{}, 1),
+		workers:    make(chan int, 1),
+		streamErr:  errNotSubscribed,
+		pending:    make(map[string]*pendingResult),
 	}
 
-	return &GRPCPoller{
-		client: client,
-		conn:   conn,
-		stream: stream,
-	}, nil
+	go p.subscribe(ctx)
+
+	return p, nil
 }
 
 func (p *GRPCPoller) Close() error {
+	p.cancel()
 	return p.conn.Close()
 }
 
-func (p *GRPCPoller) GetNextTask(ctx context.Context) *agent.Task {
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			task, err := p.stream.Recv()
-			if err != nil {
-				return nil
+// CheckConnection reports whether the connection to the orchestrator is
+// ready and subscribed to tasks.
+func (p *GRPCPoller) CheckConnection(ctx context.Context) error {
+	p.mutex.Lock()
+	streamErr := p.streamErr
+	p.mutex.Unlock()
+
+	if streamErr != nil {
+		return fmt.Errorf("task stream is broken: %w", streamErr)
+	}
+
+	if state := p.conn.GetState(); state != connectivity.Ready {
+		return fmt.Errorf("connection is %s", state)
+	}
+
+	return nil
+}
+
+// subscribe keeps a GetTasks stream open until ctx is done.
+func (p *GRPCPoller) subscribe(ctx context.Context) {
+	for attempt := 0; ; attempt++ {
+		streamCtx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx,
+			"x-request-id", uuid.NewString(),
+			"x-agent-id", p.agentID,
+		))
+
+		stream, err := p.client.GetTasks(streamCtx)
+		if err == nil {
+			if attempt > 0 {
+				slog.InfoContext(ctx, "resubscribed to tasks", "attempt", attempt)
 			}
+			attempt = 0
+
+			p.attach(stream)
+			err = p.receive(ctx, stream)
+		}
+
+		cancel()
+		p.detach(err)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := retry.DefaultBackoff.Delay(attempt)
+		slog.WarnContext(ctx, "task stream broken, resubscribing", "error", err, "retry_in", delay.String())
+
+		if retry.Sleep(ctx, delay) != nil {
+			return
+		}
+	}
+}
 
-			id, err := uuid.Parse(task.Id)
-			if err != nil {
-				return nil
+// attach makes the stream current, announces the capacity of the agent and
+// resends the results which haven't been acknowledged on the previous one.
+func (p *GRPCPoller) attach(stream proto.OrchestratorService_GetTasksClient) {
+	p.mutex.Lock()
+	p.stream = stream
+	p.streamErr = nil
+
+	results := make([]*proto.TaskResult, 0, len(p.pending))
+	for _, pending := range p.pending {
+		results = append(results, pending.result)
+	}
+	capacity := p.capacityMessage()
+	p.mutex.Unlock()
+
+	// A failed send breaks the stream, so receive fails as well and the
+	// capacity and results are sent again on the next one.
+	if err := p.send(stream, capacity); err != nil {
+		return
+	}
+
+	if len(results) > 0 {
+		slog.Info("resending unacknowledged results", "count", len(results))
+		p.send(stream, resultsMessage(results))
+	}
+}
+
+// capacityMessage announces the capacity of the agent, it must be called
+// with the mutex held.
+func (p *GRPCPoller) capacityMessage() *proto.AgentMessage {
+	return &proto.AgentMessage{
+		Message: &proto.AgentMessage_Capacity{Capacity: &proto.Capacity{
+			Steps:     uint32(p.capacity),
+			Batches:   true,
+			Operators: p.operators,
+		}},
+	}
+}
+
+// Workers receives the amount of workers the orchestrator asks for.
+func (p *GRPCPoller) Workers() <-chan int {
+	return p.workers
+}
+
+// SetWorkers announces the new amount of workers as the capacity of the
+// agent. If the stream is broken, it's announced once the poller
+// resubscribes.
+func (p *GRPCPoller) SetWorkers(workers int) {
+	p.mutex.Lock()
+	p.capacity = workers
+	capacity := p.capacityMessage()
+	stream := p.stream
+	p.mutex.Unlock()
+
+	if stream != nil {
+		p.send(stream, capacity)
+	}
+}
+
+// askWorkers passes on the amount of workers the orchestrator asks for,
+// replacing the previous one if it hasn't been received yet.
+func (p *GRPCPoller) askWorkers(workers int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case <-p.workers:
+	default:
+	}
+	p.workers <- workers
+}
+
+// resultsMessage wraps the results in a single message.
+func resultsMessage(results []*proto.TaskResult) *proto.AgentMessage {
+	if len(results) == 1 {
+		return &proto.AgentMessage{
+			Message: &proto.AgentMessage_Result{Result: results[0]},
+		}
+	}
+
+	return &proto.AgentMessage{
+		Message: &proto.AgentMessage_Results{Results: &proto.ResultBatch{Results: results}},
+	}
+}
+
+func (p *GRPCPoller) detach(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.stream = nil
+	p.streamErr = err
+}
+
+func (p *GRPCPoller) send(stream proto.OrchestratorService_GetTasksClient, message *proto.AgentMessage) error {
+	p.sendMutex.Lock()
+	defer p.sendMutex.Unlock()
+
+	return stream.Send(message)
+}
+
+// receive dispatches the messages of the stream until it breaks.
+func (p *GRPCPoller) receive(ctx context.Context, stream proto.OrchestratorService_GetTasksClient) error {
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch message := message.Message.(type) {
+		case *proto.OrchestratorMessage_Task:
+			p.pushTasks(ctx, message.Task)
+
+		case *proto.OrchestratorMessage_Tasks:
+			p.pushTasks(ctx, message.Tasks.Tasks...)
+
+		case *proto.OrchestratorMessage_Ack:
+			p.acknowledge(message.Ack)
+
+		case *proto.OrchestratorMessage_Acks:
+			for _, ack := range message.Acks.Acks {
+				p.acknowledge(ack)
 			}
 
-			return &agent.Task{
-				ID:              id,
-				Arg1:            calculator.Token{Value: task.Arg1},
-				Arg2:            calculator.Token{Value: task.Arg2},
-				Operation:       calculator.Token{Value: task.Operation},
-				OperationTimeMS: int(task.OperationTime),
+		case *proto.OrchestratorMessage_Settings:
+			p.askWorkers(int(message.Settings.Workers))
+		}
+	}
+}
+
+func (p *GRPCPoller) pushTasks(ctx context.Context, tasks ...*proto.IncomingTask) {
+	p.mutex.Lock()
+	for _, task := range tasks {
+		id, err := uuid.Parse(task.Id)
+		if err != nil {
+			slog.ErrorContext(ctx, "received task with invalid id", "id", task.Id)
+			continue
+		}
+
+		p.tasks = append(p.tasks, &agent.Task{
+			ID:              id,
+			Arg1:            calculator.Token{Value: task.Arg1},
+			Arg2:            calculator.Token{Value: task.Arg2},
+			Operation:       calculator.Token{Value: task.Operation},
+			OperationTimeMS: int(task.OperationTime),
+			Simulate:        task.Simulate,
+			RequestID:       task.RequestId,
+			StepID:          task.StepId,
+			TraceContext:    task.TraceContext,
+		})
+	}
+	p.mutex.Unlock()
+
+	p.notifyTasksReady()
+}
+
+func (p *GRPCPoller) notifyTasksReady() {
+	select {
+	case p.tasksReady <- struct{}{}:
+	default:
+	}
+}
+
+func (p *GRPCPoller) acknowledge(ack *proto.ResultAck) {
+	key := resultKey(ack.Id, ack.StepId)
+
+	p.mutex.Lock()
+	result, found := p.pending[key]
+	delete(p.pending, key)
+	p.mutex.Unlock()
+
+	if !found {
+		return
+	}
+
+	if ack.Error != "" {
+		result.done <- fmt.Errorf("result rejected: %s", ack.Error)
+		return
+	}
+
+	result.done <- nil
+}
+
+// resultKey identifies the result of a step.
+func resultKey(id, stepID string) string {
+	return id + "/" + stepID
+}
+
+func (p *GRPCPoller) GetNextTask(ctx context.Context) *agent.Task {
+	tasks := p.GetNextTasks(ctx, 1)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	return tasks[0]
+}
+
+// GetNextTasks takes up to limit of the steps received, waiting for one if
+// there are none.
+func (p *GRPCPoller) GetNextTasks(ctx context.Context, limit int) []*agent.Task {
+	for {
+		p.mutex.Lock()
+		if len(p.tasks) > 0 {
+			n := min(limit, len(p.tasks))
+			tasks := p.tasks[:n:n]
+			p.tasks = p.tasks[n:]
+			remaining := len(p.tasks)
+			p.mutex.Unlock()
+
+			// Wake up the next worker if there's more to do.
+			if remaining > 0 {
+				p.notifyTasksReady()
 			}
+
+			return tasks
+		}
+		p.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.tasksReady:
 		}
 	}
 }
 
-func (p *GRPCPoller) SolveTask(id uuid.UUID, result calculator.Token) error {
+// SolveTask sends the result and waits for it to be acknowledged. If the
+// stream is broken, the result is sent once the poller resubscribes.
+func (p *GRPCPoller) SolveTask(ctx context.Context, id uuid.UUID, result calculator.Token) error {
 	resultFloat, err := strconv.ParseFloat(result.Value, 64)
 	if err != nil {
 		return err
 	}
 
-	return p.stream.Send(&proto.TaskResult{
-		Id:     id.String(),
-		Result: float32(resultFloat),
-	})
+	return p.submit(ctx, []*proto.TaskResult{{
+		Id:           id.String(),
+		Result:       float32(resultFloat),
+		RequestId:    logging.RequestID(ctx),
+		StepId:       logging.StepID(ctx),
+		TraceContext: tracing.Inject(ctx),
+	}})[0]
+}
+
+// FailTask sends the failure of the step and waits for it to be
+// acknowledged, like SolveTask does.
+func (p *GRPCPoller) FailTask(ctx context.Context, id uuid.UUID, reason string) error {
+	return p.submit(ctx, []*proto.TaskResult{{
+		Id:           id.String(),
+		Error:        reason,
+		RequestId:    logging.RequestID(ctx),
+		StepId:       logging.StepID(ctx),
+		TraceContext: tracing.Inject(ctx),
+	}})[0]
+}
+
+// SubmitResults sends the results in a single message and waits for each
+// of them to be acknowledged, like SolveTask does.
+func (p *GRPCPoller) SubmitResults(ctx context.Context, results []agent.Result) []error {
+	errs := make([]error, len(results))
+
+	// submitted maps the results sent to their index in results.
+	var submitted []int
+	var messages []*proto.TaskResult
+	for i, result := range results {
+		var resultFloat float64
+		if result.Error == "" {
+			var err error
+			if resultFloat, err = strconv.ParseFloat(result.Value.Value, 64); err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+
+		submitted = append(submitted, i)
+		messages = append(messages, &proto.TaskResult{
+			Id:           result.Task.ID.String(),
+			Result:       float32(resultFloat),
+			Error:        result.Error,
+			RequestId:    result.Task.RequestID,
+			StepId:       result.Task.StepID,
+			TraceContext: result.TraceContext,
+		})
+	}
+
+	if len(messages) == 0 {
+		return errs
+	}
+
+	for n, err := range p.submit(ctx, messages) {
+		errs[submitted[n]] = err
+	}
+
+	return errs
+}
+
+// submit registers the results as pending, sends them and waits for each
+// of them to be acknowledged or ctx to be done.
+func (p *GRPCPoller) submit(ctx context.Context, results []*proto.TaskResult) []error {
+	pending := make([]*pendingResult, len(results))
+
+	p.mutex.Lock()
+	for i, result := range results {
+		pending[i] = &pendingResult{result: result, done: make(chan error, 1)}
+		p.pending[resultKey(result.Id, result.StepId)] = pending[i]
+	}
+	stream := p.stream
+	p.mutex.Unlock()
+
+	if stream != nil {
+		if err := p.send(stream, resultsMessage(results)); err != nil {
+			slog.WarnContext(ctx, "failed to send results, they will be resent", "error", err)
+		}
+	}
+
+	errs := make([]error, len(results))
+	for i, result := range pending {
+		select {
+		case errs[i] = <-result.done:
+
+		case <-ctx.Done():
+			p.mutex.Lock()
+			delete(p.pending, resultKey(result.result.Id, result.result.StepId))
+			p.mutex.Unlock()
+
+			errs[i] = ctx.Err()
+		}
+	}
+
+	return errs
 }
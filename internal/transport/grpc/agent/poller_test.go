@@ -0,0 +1,252 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// flakyOrchestrator hands out a single step on the first stream and breaks
+// it as soon as the result arrives, acknowledging results only on the
+// following streams.
+type flakyOrchestrator struct {
+	proto.UnimplementedOrchestratorServiceServer
+
+	task       *proto.IncomingTask
+	streams    atomic.Int32
+	capacities chan uint32
+	results    chan *proto.TaskResult
+}
+
+// receiveResult receives the next result on the stream, recording the
+// capacities announced before it.
+func (o *flakyOrchestrator) receiveResult(stream proto.OrchestratorService_GetTasksServer) (*proto.TaskResult, error) {
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		if capacity := message.GetCapacity(); capacity != nil {
+			o.capacities <- capacity.Steps
+			continue
+		}
+
+		return message.GetResult(), nil
+	}
+}
+
+func (o *flakyOrchestrator) GetTasks(stream proto.OrchestratorService_GetTasksServer) error {
+	if o.streams.Add(1) == 1 {
+		err := stream.Send(&proto.OrchestratorMessage{
+			Message: &proto.OrchestratorMessage_Task{Task: o.task},
+		})
+		if err != nil {
+			return err
+		}
+
+		result, err := o.receiveResult(stream)
+		if err != nil {
+			return err
+		}
+		o.results <- result
+
+		return status.Error(codes.Unavailable, "going away")
+	}
+
+	for {
+		result, err := o.receiveResult(stream)
+		if err != nil {
+			return err
+		}
+		o.results <- result
+
+		err = stream.Send(&proto.OrchestratorMessage{
+			Message: &proto.OrchestratorMessage_Ack{Ack: &proto.ResultAck{
+				Id:     result.Id,
+				StepId: result.StepId,
+			}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func TestGRPCPollerResendsResultsAfterReconnecting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	orchestrator := &flakyOrchestrator{
+		task: &proto.IncomingTask{
+			Id:        uuid.NewString(),
+			Arg1:      "1",
+			Arg2:      "2",
+			Operation: "+",
+			StepId:    uuid.NewString(),
+		},
+		capacities: make(chan uint32, 2),
+		results:    make(chan *proto.TaskResult, 2),
+	}
+
+	server := grpc.NewServer()
+	proto.RegisterOrchestratorServiceServer(server, orchestrator)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	poller, err := NewGRPCPoller("127.0.0.1", port, "agent-1", 3, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create poller: %v", err)
+	}
+	t.Cleanup(func() { poller.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	task := poller.GetNextTask(ctx)
+	if task == nil {
+		t.Fatal("expected a task")
+	}
+
+	if task.ID.String() != orchestrator.task.Id || task.StepID != orchestrator.task.StepId {
+		t.Fatalf("got task %s step %s, want %s step %s", task.ID, task.StepID, orchestrator.task.Id, orchestrator.task.StepId)
+	}
+
+	err = poller.SolveTask(task.Context(ctx), task.ID, calculator.Token{Value: "3"})
+	if err != nil {
+		t.Fatalf("failed to solve task: %v", err)
+	}
+
+	for attempt := range 2 {
+		result := <-orchestrator.results
+		if result.StepId != task.StepID || result.Result != 3 {
+			t.Errorf("attempt %d: got result %v for step %s, want 3 for %s", attempt, result.Result, result.StepId, task.StepID)
+		}
+	}
+
+	for attempt := range 2 {
+		if capacity := <-orchestrator.capacities; capacity != 3 {
+			t.Errorf("attempt %d: got capacity %d announced, want 3", attempt, capacity)
+		}
+	}
+
+	if streams := orchestrator.streams.Load(); streams < 2 {
+		t.Errorf("got %d streams, want the poller to resubscribe", streams)
+	}
+
+	if err := poller.CheckConnection(ctx); err != nil {
+		t.Errorf("poller isn't connected after resubscribing: %v", err)
+	}
+}
+
+func TestGRPCPollerGivesUpWhenContextIsDone(t *testing.T) {
+	poller, err := NewGRPCPoller("127.0.0.1", "1", "agent-1", 1, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create poller: %v", err)
+	}
+	t.Cleanup(func() { poller.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if task := poller.GetNextTask(ctx); task != nil {
+		t.Fatalf("got task %v without an orchestrator", task)
+	}
+
+	ctx = logging.WithStepID(context.Background(), uuid.NewString())
+	ctx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	if err := poller.SolveTask(ctx, uuid.New(), calculator.Token{Value: "1"}); err == nil {
+		t.Fatal("result was acknowledged without an orchestrator")
+	}
+
+	if err := poller.CheckConnection(ctx); err == nil {
+		t.Error("poller is connected without an orchestrator")
+	}
+}
+
+// resizingOrchestrator asks agents for 3 workers and records the capacities
+// they announce.
+type resizingOrchestrator struct {
+	proto.UnimplementedOrchestratorServiceServer
+
+	capacities chan uint32
+}
+
+func (o *resizingOrchestrator) GetTasks(stream proto.OrchestratorService_GetTasksServer) error {
+	err := stream.Send(&proto.OrchestratorMessage{
+		Message: &proto.OrchestratorMessage_Settings{Settings: &proto.AgentSettings{Workers: 3}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if capacity := message.GetCapacity(); capacity != nil {
+			o.capacities <- capacity.Steps
+		}
+	}
+}
+
+func TestGRPCPollerAnnouncesResizedWorkers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	orchestrator := &resizingOrchestrator{capacities: make(chan uint32, 2)}
+
+	server := grpc.NewServer()
+	proto.RegisterOrchestratorServiceServer(server, orchestrator)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	poller, err := NewGRPCPoller("127.0.0.1", port, "agent-1", 1, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create poller: %v", err)
+	}
+	t.Cleanup(func() { poller.Close() })
+
+	select {
+	case workers := <-poller.Workers():
+		if workers != 3 {
+			t.Errorf("got %d workers asked for, want 3", workers)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the orchestrator to ask for workers")
+	}
+
+	poller.SetWorkers(3)
+
+	for _, want := range []uint32{1, 3} {
+		select {
+		case capacity := <-orchestrator.capacities:
+			if capacity != want {
+				t.Errorf("got capacity %d announced, want %d", capacity, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected capacity %d to be announced", want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package calculator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const AuthorizationMetadataKey = "authorization"
+
+// publicMethods can be called without a token.
+var publicMethods = map[string]bool{
+	proto.CalculatorService_Register_FullMethodName: true,
+	proto.CalculatorService_Login_FullMethodName:    true,
+}
+
+type ownerKey struct{}
+
+// Owner returns the login of the user the call has been authenticated as.
+func Owner(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerKey{}).(string)
+	return owner
+}
+
+// authenticate checks the token in the metadata of calls to the
+// CalculatorService, returning the context carrying the owner. Calls to
+// other services are left alone.
+func authenticate(ctx context.Context, users *auth.UserInteractor, method string) (context.Context, error) {
+	if !strings.HasPrefix(method, "/"+proto.CalculatorService_ServiceDesc.ServiceName+"/") || publicMethods[method] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(AuthorizationMetadataKey)
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid authorization metadata")
+	}
+
+	owner, err := users.CheckToken(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return context.WithValue(ctx, ownerKey{}, owner), nil
+}
+
+// UnaryAuthInterceptor authenticates unary calls to the CalculatorService.
+func UnaryAuthInterceptor(users *auth.UserInteractor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, users, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuthInterceptor authenticates streaming calls to the
+// CalculatorService.
+func StreamAuthInterceptor(users *auth.UserInteractor) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), users, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
@@ -0,0 +1,364 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server is the public CalculatorService, backed by the same interactors
+// as the HTTP API.
+type Server struct {
+	proto.UnimplementedCalculatorServiceServer
+	Interactor *orchestrator.Interactor
+	Users      *auth.UserInteractor
+	Limiter    *quota.RateLimiter
+}
+
+func NewServer(interactor *orchestrator.Interactor, users *auth.UserInteractor, limiter *quota.RateLimiter) *Server {
+	return &Server{
+		Interactor: interactor,
+		Users:      users,
+		Limiter:    limiter,
+	}
+}
+
+var statuses = map[orchestrator.Status]proto.ExpressionStatus{
+	orchestrator.Accepted: proto.ExpressionStatus_EXPRESSION_STATUS_ACCEPTED,
+	orchestrator.Done:     proto.ExpressionStatus_EXPRESSION_STATUS_DONE,
+	orchestrator.Expired:  proto.ExpressionStatus_EXPRESSION_STATUS_EXPIRED,
+	orchestrator.Canceled: proto.ExpressionStatus_EXPRESSION_STATUS_CANCELED,
+	orchestrator.Failed:   proto.ExpressionStatus_EXPRESSION_STATUS_FAILED,
+}
+
+var priorities = map[orchestrator.Priority]proto.Priority{
+	orchestrator.LowPriority:    proto.Priority_PRIORITY_LOW,
+	orchestrator.NormalPriority: proto.Priority_PRIORITY_NORMAL,
+	orchestrator.HighPriority:   proto.Priority_PRIORITY_HIGH,
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+func newExpression(expr *orchestrator.Expression) *proto.Expression {
+	return &proto.Expression{
+		Id:         expr.Id.String(),
+		Expression: expr.Text,
+		Status:     statuses[expr.Status],
+		Result:     expr.Result,
+		Priority:   priorities[expr.Priority],
+		Deadline:   timestamp(expr.Deadline),
+		Simulate:   expr.Simulate,
+		CreatedAt:  timestamppb.New(expr.CreatedAt),
+		FinishedAt: timestamp(expr.FinishedAt),
+		Error:      expr.Error,
+	}
+}
+
+func newStep(step orchestrator.Step) *proto.Step {
+	return &proto.Step{
+		Number:     uint32(step.Number),
+		Arg1:       step.Arg1,
+		Operation:  step.Operation,
+		Arg2:       step.Arg2,
+		Result:     step.Result,
+		AgentId:    step.AgentId,
+		StartedAt:  timestamppb.New(step.StartedAt),
+		FinishedAt: timestamppb.New(step.FinishedAt),
+	}
+}
+
+func parsePriority(priority proto.Priority) (orchestrator.Priority, error) {
+	if priority == proto.Priority_PRIORITY_UNSPECIFIED {
+		return orchestrator.NormalPriority, nil
+	}
+
+	for p, value := range priorities {
+		if value == priority {
+			return p, nil
+		}
+	}
+
+	return orchestrator.NormalPriority, status.Error(codes.InvalidArgument, "invalid priority")
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid id")
+	}
+
+	return parsed, nil
+}
+
+// resourceExhausted reports a limit error along with the time to wait
+// before retrying.
+func resourceExhausted(limitErr *quota.LimitError) error {
+	st := status.New(codes.ResourceExhausted, limitErr.Error())
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(limitErr.RetryAfter),
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+func (s *Server) Register(ctx context.Context, req *proto.RegisterRequest) (*proto.RegisterResponse, error) {
+	if req.Login == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password are required")
+	}
+
+	err := s.Users.Create(req.Login, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrUserExists):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to create user", "error", err)
+		return nil, status.Error(codes.Internal, "failed to create user")
+	}
+
+	return &proto.RegisterResponse{}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *proto.LoginRequest) (*proto.LoginResponse, error) {
+	if req.Login == "" || req.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password are required")
+	}
+
+	token, err := s.Users.Authorize(req.Login, req.Password)
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+
+	case errors.Is(err, auth.ErrInvalidPassword):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to authorize", "error", err)
+		return nil, status.Error(codes.Internal, "failed to authorize")
+	}
+
+	return &proto.LoginResponse{Token: token}, nil
+}
+
+func (s *Server) Submit(ctx context.Context, req *proto.SubmitRequest) (*proto.SubmitResponse, error) {
+	owner := Owner(ctx)
+
+	var limitErr *quota.LimitError
+	if err := s.Limiter.Allow(owner); errors.As(err, &limitErr) {
+		return nil, resourceExhausted(limitErr)
+	}
+
+	priority, err := parsePriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	options := orchestrator.ExpressionOptions{
+		Priority: priority,
+		Simulate: !req.NoSimulate,
+	}
+	if req.Deadline != nil {
+		deadline := req.Deadline.AsTime()
+		options.Deadline = &deadline
+	}
+
+	id, err := s.Interactor.SubmitExpression(ctx, owner, req.Expression, options)
+	switch {
+	case errors.Is(err, orchestrator.ErrInvalidExpression),
+		errors.Is(err, orchestrator.ErrDeadlinePassed),
+		errors.Is(err, quota.ErrExpressionTooLong),
+		errors.Is(err, quota.ErrTooManyOperators):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+
+	case errors.As(err, &limitErr):
+		return nil, resourceExhausted(limitErr)
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to add expression", "error", err)
+		return nil, status.Error(codes.Internal, "failed to add expression")
+	}
+
+	return &proto.SubmitResponse{Id: id.String()}, nil
+}
+
+// getExpression returns the expression if it belongs to the caller.
+func (s *Server) getExpression(ctx context.Context, id uuid.UUID) (*orchestrator.Expression, error) {
+	expr := s.Interactor.GetExpression(id)
+	if expr == nil || expr.Owner != Owner(ctx) {
+		return nil, status.Error(codes.NotFound, "expression not found")
+	}
+
+	return expr, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *proto.GetRequest) (*proto.Expression, error) {
+	id, err := parseID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := s.getExpression(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newExpression(expr), nil
+}
+
+func (s *Server) List(ctx context.Context, req *proto.ListRequest) (*proto.ListResponse, error) {
+	query := orchestrator.ExpressionQuery{
+		Search: req.Search,
+		Sort:   req.Sort,
+		Limit:  int(min(req.Limit, orchestrator.MaxListLimit)),
+		Cursor: req.Cursor,
+	}
+
+	if req.Status != proto.ExpressionStatus_EXPRESSION_STATUS_UNSPECIFIED {
+		found := false
+		for st, value := range statuses {
+			if value == req.Status {
+				query.Status = &st
+				found = true
+			}
+		}
+		if !found {
+			return nil, status.Error(codes.InvalidArgument, "invalid status")
+		}
+	}
+	if req.CreatedAfter != nil {
+		after := req.CreatedAfter.AsTime()
+		query.CreatedAfter = &after
+	}
+	if req.CreatedBefore != nil {
+		before := req.CreatedBefore.AsTime()
+		query.CreatedBefore = &before
+	}
+
+	page, err := s.Interactor.ListExpressions(Owner(ctx), query)
+	switch {
+	case errors.Is(err, orchestrator.ErrInvalidSort), errors.Is(err, orchestrator.ErrInvalidCursor):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to fetch expressions", "error", err)
+		return nil, status.Error(codes.Internal, "failed to fetch expressions")
+	}
+
+	resp := &proto.ListResponse{
+		Expressions: make([]*proto.Expression, 0, len(page.Expressions)),
+		NextCursor:  page.NextCursor,
+	}
+	for _, expr := range page.Expressions {
+		resp.Expressions = append(resp.Expressions, newExpression(expr))
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Cancel(ctx context.Context, req *proto.CancelRequest) (*proto.Expression, error) {
+	id, err := parseID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Interactor.CancelExpression(ctx, Owner(ctx), id)
+	switch {
+	case errors.Is(err, orchestrator.ErrExpressionNotFound):
+		return nil, status.Error(codes.NotFound, "expression not found")
+
+	case errors.Is(err, orchestrator.ErrExpressionFinished):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to cancel expression", "error", err)
+		return nil, status.Error(codes.Internal, "failed to cancel expression")
+	}
+
+	expr, err := s.getExpression(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newExpression(expr), nil
+}
+
+// Watch sends the expression and the steps solved since the previous event
+// whenever it changes, until it's finished.
+func (s *Server) Watch(req *proto.WatchRequest, stream proto.CalculatorService_WatchServer) error {
+	ctx := stream.Context()
+
+	id, err := parseID(req.Id)
+	if err != nil {
+		return err
+	}
+
+	// Only the owner watches the expression.
+	if _, err := s.getExpression(ctx, id); err != nil {
+		return err
+	}
+
+	sent := 0
+	for {
+		// The channel is taken before reading the expression, so no change
+		// made after reading it goes unnoticed.
+		changed := s.Interactor.WatchExpression(id)
+
+		expr, err := s.getExpression(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		steps, err := s.Interactor.ListSteps(id)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to fetch steps", "error", err)
+			return status.Error(codes.Internal, "failed to fetch steps")
+		}
+
+		event := &proto.WatchEvent{Expression: newExpression(expr)}
+		for _, step := range steps[min(sent, len(steps)):] {
+			event.Steps = append(event.Steps, newStep(step))
+		}
+		sent = len(steps)
+
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+
+		if expr.Status != orchestrator.Accepted {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func RegisterService(grpcServer *grpc.Server, s *Server) {
+	proto.RegisterCalculatorServiceServer(grpcServer, s)
+}
@@ -0,0 +1,209 @@
+package calculator
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestService(t *testing.T, limits quota.Limits) (*orchestrator.Interactor, proto.CalculatorServiceClient) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	interactor := orchestrator.NewOrchestratorInteractor(limits, orchestrator.NewFIFOScheduler(), orchestrator.ZeroCost{})
+	users := &auth.UserInteractor{JWTSecretKey: "test"}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryAuthInterceptor(users)),
+		grpc.StreamInterceptor(StreamAuthInterceptor(users)),
+	)
+	RegisterService(server, NewServer(interactor, users, quota.NewRateLimiter(limits)))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return interactor, proto.NewCalculatorServiceClient(client)
+}
+
+// login registers the user and returns a context authenticated as them.
+func login(t *testing.T, client proto.CalculatorServiceClient, name string) context.Context {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := client.Register(ctx, &proto.RegisterRequest{Login: name, Password: "secret"}); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+
+	resp, err := client.Login(ctx, &proto.LoginRequest{Login: name, Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, AuthorizationMetadataKey, "Bearer "+resp.Token)
+}
+
+func assertCode(t *testing.T, name string, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got %v (%v), want %v", name, got, err, want)
+	}
+}
+
+func TestServerWatchesExpression(t *testing.T) {
+	interactor, client := newTestService(t, quota.Limits{})
+	ctx := login(t, client, "alice")
+
+	resp, err := client.Submit(ctx, &proto.SubmitRequest{Expression: "(1+2)*3", Priority: proto.Priority_PRIORITY_HIGH})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+
+	watchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(watchCtx, &proto.WatchRequest{Id: resp.Id})
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	go func() {
+		for task := interactor.WaitNextTask(watchCtx, nil); task != nil; task = interactor.WaitNextTask(watchCtx, nil) {
+			_, _, _, arg1, arg2, operation, _ := task.NextStep()
+			a, _ := strconv.ParseFloat(arg1, 64)
+			b, _ := strconv.ParseFloat(arg2, 64)
+
+			result := a + b
+			if operation == "*" {
+				result = a * b
+			}
+
+			interactor.SolveTask(watchCtx, task.Expression.Id, result)
+		}
+	}()
+
+	var steps []*proto.Step
+	var last *proto.Expression
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to receive event: %v", err)
+		}
+
+		steps = append(steps, event.Steps...)
+		last = event.Expression
+	}
+
+	if last.Status != proto.ExpressionStatus_EXPRESSION_STATUS_DONE || last.Result != 9 || last.Priority != proto.Priority_PRIORITY_HIGH {
+		t.Errorf("got %v, want a done high priority expression with result 9", last)
+	}
+	if len(steps) != 2 || steps[0].Operation != "+" || steps[1].Operation != "*" {
+		t.Errorf("got steps %v, want 1+2 and 3*3 once each", steps)
+	}
+
+	expr, err := client.Get(ctx, &proto.GetRequest{Id: resp.Id})
+	if err != nil || expr.Result != 9 {
+		t.Errorf("get: got %v, %v, want the solved expression", expr, err)
+	}
+
+	page, err := client.List(ctx, &proto.ListRequest{Status: proto.ExpressionStatus_EXPRESSION_STATUS_DONE})
+	if err != nil || len(page.Expressions) != 1 || page.Expressions[0].Id != resp.Id {
+		t.Errorf("list: got %v, %v, want the solved expression", page, err)
+	}
+}
+
+func TestServerMapsErrors(t *testing.T) {
+	_, client := newTestService(t, quota.Limits{MaxPending: 1})
+	ctx := login(t, client, "alice")
+
+	_, err := client.Register(ctx, &proto.RegisterRequest{Login: "alice", Password: "secret"})
+	assertCode(t, "register twice", err, codes.AlreadyExists)
+
+	_, err = client.Login(context.Background(), &proto.LoginRequest{Login: "alice", Password: "wrong"})
+	assertCode(t, "wrong password", err, codes.Unauthenticated)
+
+	_, err = client.List(context.Background(), &proto.ListRequest{})
+	assertCode(t, "no token", err, codes.Unauthenticated)
+
+	invalid := metadata.AppendToOutgoingContext(context.Background(), AuthorizationMetadataKey, "Bearer invalid")
+	stream, err := client.Watch(invalid, &proto.WatchRequest{Id: uuid.NewString()})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	assertCode(t, "watch with an invalid token", err, codes.Unauthenticated)
+
+	_, err = client.Submit(ctx, &proto.SubmitRequest{Expression: "1+"})
+	assertCode(t, "invalid expression", err, codes.InvalidArgument)
+
+	_, err = client.List(ctx, &proto.ListRequest{Sort: "result"})
+	assertCode(t, "invalid sort", err, codes.InvalidArgument)
+
+	_, err = client.Get(ctx, &proto.GetRequest{Id: "not-an-id"})
+	assertCode(t, "invalid id", err, codes.InvalidArgument)
+
+	resp, err := client.Submit(ctx, &proto.SubmitRequest{Expression: "1+2"})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+
+	_, err = client.Submit(ctx, &proto.SubmitRequest{Expression: "1+2"})
+	assertCode(t, "too many pending", err, codes.ResourceExhausted)
+
+	bob := login(t, client, "bob")
+	_, err = client.Get(bob, &proto.GetRequest{Id: resp.Id})
+	assertCode(t, "another owner's expression", err, codes.NotFound)
+
+	stream, err = client.Watch(bob, &proto.WatchRequest{Id: resp.Id})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	assertCode(t, "watch another owner's expression", err, codes.NotFound)
+
+	expr, err := client.Cancel(ctx, &proto.CancelRequest{Id: resp.Id})
+	if err != nil || expr.Status != proto.ExpressionStatus_EXPRESSION_STATUS_CANCELED {
+		t.Fatalf("failed to cancel: %v, %v", err, expr)
+	}
+
+	_, err = client.Cancel(ctx, &proto.CancelRequest{Id: resp.Id})
+	assertCode(t, "cancel twice", err, codes.FailedPrecondition)
+}
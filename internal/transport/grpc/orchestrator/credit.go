@@ -0,0 +1,85 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultCapacity is the capacity of agents which haven't announced one.
+const defaultCapacity = 1
+
+// credit limits the steps handed out on a stream to the capacity announced
+// by the agent.
+type credit struct {
+	capacity int
+	inFlight int
+	// changed is closed and replaced whenever credit may have become
+	// available.
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func newCredit() *credit {
+	return &credit{
+		capacity: defaultCapacity,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (c *credit) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *credit) setCapacity(capacity int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.capacity = capacity
+	c.notify()
+}
+
+// release frees up the credit of a solved step. Results resent from a
+// previous stream may free up more than has been taken on this one, so
+// in-flight steps never drop below zero.
+func (c *credit) release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.inFlight = max(c.inFlight-1, 0)
+	c.notify()
+}
+
+// acquire takes the credit for a step, waiting until there is any. It
+// fails once ctx is done.
+func (c *credit) acquire(ctx context.Context) error {
+	for {
+		c.mutex.Lock()
+		if c.inFlight < c.capacity {
+			c.inFlight++
+			c.mutex.Unlock()
+			return nil
+		}
+		changed := c.changed
+		c.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// tryAcquire takes the credit for a step if there is any, without waiting.
+func (c *credit) tryAcquire() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.inFlight >= c.capacity {
+		return false
+	}
+
+	c.inFlight++
+	return true
+}
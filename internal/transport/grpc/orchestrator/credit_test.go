@@ -0,0 +1,63 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreditLimitsStepsInFlight(t *testing.T) {
+	c := newCredit()
+	c.setCapacity(2)
+
+	for range 2 {
+		if err := c.acquire(context.Background()); err != nil {
+			t.Fatalf("failed to acquire credit: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := c.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquired credit beyond capacity: got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	acquired := make(chan error)
+	go func() { acquired <- c.acquire(context.Background()) }()
+
+	c.release()
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("failed to acquire released credit: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("released credit wasn't acquired")
+	}
+}
+
+func TestCreditIgnoresExcessReleases(t *testing.T) {
+	c := newCredit()
+	c.setCapacity(3)
+
+	c.release()
+	c.release()
+
+	for range 3 {
+		if !c.tryAcquire() {
+			t.Fatal("failed to acquire credit within capacity")
+		}
+	}
+	if c.tryAcquire() {
+		t.Fatal("excess releases were counted as credit")
+	}
+
+	c.setCapacity(1)
+	c.release()
+	if c.tryAcquire() {
+		t.Error("acquired credit beyond the lowered capacity")
+	}
+}
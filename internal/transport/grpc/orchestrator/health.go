@@ -0,0 +1,54 @@
+package orchestrator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// RegisterHealthService registers the standard gRPC health service. The
+// status of both the whole server and OrchestratorService follows the
+// checker, which is rerun every interval until ctx is done.
+func RegisterHealthService(ctx context.Context, grpcServer *grpc.Server, checker *health.Checker, interval time.Duration) {
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	update := func() {
+		status := healthpb.HealthCheckResponse_SERVING
+		if report := checker.Check(ctx); !report.Healthy() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			for _, result := range report.Results {
+				if result.Error != nil {
+					slog.WarnContext(ctx, "health check failed", "check", result.Name, "error", result.Error)
+				}
+			}
+		}
+
+		healthServer.SetServingStatus("", status)
+		healthServer.SetServingStatus(proto.OrchestratorService_ServiceDesc.ServiceName, status)
+	}
+
+	update()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				healthServer.Shutdown()
+				return
+
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+}
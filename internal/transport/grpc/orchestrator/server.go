@@ -1,91 +1,402 @@
 package orchestrator
 
 import (
-	"github.com/gitgernit/go-calculator/internal/config"
+	"context"
 	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
-var Config, _ = config.New()
+const (
+	RequestIDMetadataKey = "x-request-id"
+	AgentIDMetadataKey   = "x-agent-id"
+)
+
+// DefaultReleaseGrace is how long the steps in flight on a stream which
+// ended are left to the agent to resend their results on a new one.
+const DefaultReleaseGrace = 10 * time.Second
 
 type Server struct {
 	proto.UnimplementedOrchestratorServiceServer
 	Interactor *orchestrator.Interactor
-	Mutex      sync.Mutex
+	// ReleaseGrace is how long the steps in flight on a stream which ended
+	// are kept handed out before they're handed out again.
+	ReleaseGrace time.Duration
 }
 
 func NewServer(interactor *orchestrator.Interactor) *Server {
 	return &Server{
-		Interactor: interactor,
+		Interactor:   interactor,
+		ReleaseGrace: DefaultReleaseGrace,
+	}
+}
+
+// announcement is what the agent on a stream has announced of itself,
+// besides its capacity.
+type announcement struct {
+	batches   bool
+	operators orchestrator.Operators
+}
+
+// agentStream is a GetTasks stream along with the state of the agent on it.
+type agentStream struct {
+	proto.OrchestratorService_GetTasksServer
+
+	credit    *credit
+	announced atomic.Pointer[announcement]
+
+	// sendMutex serializes sends, as tasks and acknowledgements are sent
+	// from different goroutines.
+	sendMutex sync.Mutex
+
+	// inflight are the steps handed out on the stream whose result hasn't
+	// arrived yet, by expression and step id.
+	inflight      map[string]inflightStep
+	inflightMutex sync.Mutex
+}
+
+// inflightStep is a step handed out on a stream.
+type inflightStep struct {
+	task   *orchestrator.Task
+	stepID uuid.UUID
+}
+
+func newAgentStream(stream proto.OrchestratorService_GetTasksServer) *agentStream {
+	agent := &agentStream{
+		OrchestratorService_GetTasksServer: stream,
+		credit:                             newCredit(),
+		inflight:                           make(map[string]inflightStep),
+	}
+	agent.announced.Store(&announcement{})
+
+	return agent
+}
+
+// handOut records the steps as being solved by the agent.
+func (a *agentStream) handOut(tasks []*orchestrator.Task) {
+	a.inflightMutex.Lock()
+	defer a.inflightMutex.Unlock()
+
+	for _, task := range tasks {
+		a.inflight[stepKey(task.Expression.Id.String(), task.StepID.String())] = inflightStep{task: task, stepID: task.StepID}
 	}
 }
 
+// settle stops recording the step the result is for as being solved,
+// reporting whether it was handed out on the stream. Results resent from a
+// previous stream are for steps which weren't.
+func (a *agentStream) settle(result *proto.TaskResult) bool {
+	a.inflightMutex.Lock()
+	defer a.inflightMutex.Unlock()
+
+	key := stepKey(result.Id, result.StepId)
+	if _, ok := a.inflight[key]; !ok {
+		return false
+	}
+	delete(a.inflight, key)
+
+	return true
+}
+
+// release puts back the steps, so they're handed out to other agents.
+func (a *agentStream) release(interactor *orchestrator.Interactor, tasks []*orchestrator.Task) {
+	a.inflightMutex.Lock()
+	defer a.inflightMutex.Unlock()
+
+	for _, task := range tasks {
+		key := stepKey(task.Expression.Id.String(), task.StepID.String())
+		if step, ok := a.inflight[key]; ok {
+			interactor.ReleaseTask(step.task, step.stepID)
+			delete(a.inflight, key)
+		}
+	}
+}
+
+// releaseLater puts back the steps the agent hasn't sent the result of once
+// grace has passed, so the agent may still resend them on a new stream.
+// Steps solved meanwhile are left as they are.
+func (a *agentStream) releaseLater(interactor *orchestrator.Interactor, grace time.Duration) {
+	a.inflightMutex.Lock()
+	steps := a.inflight
+	a.inflight = make(map[string]inflightStep)
+	a.inflightMutex.Unlock()
+
+	if len(steps) == 0 {
+		return
+	}
+
+	time.AfterFunc(grace, func() {
+		for _, step := range steps {
+			interactor.ReleaseTask(step.task, step.stepID)
+		}
+	})
+}
+
+// stepKey identifies a step handed out.
+func stepKey(id, stepID string) string {
+	return id + "/" + stepID
+}
+
+func (a *agentStream) Send(message *proto.OrchestratorMessage) error {
+	a.sendMutex.Lock()
+	defer a.sendMutex.Unlock()
+
+	return a.OrchestratorService_GetTasksServer.Send(message)
+}
+
+// GetTasks hands out steps to the agent as they become ready, keeping no
+// more of them in flight than the capacity the agent has announced, and
+// only of the operators it supports. Steps still in flight once the stream
+// ends are handed out again after ReleaseGrace, unless the agent resends
+// their results meanwhile.
 func (s *Server) GetTasks(stream proto.OrchestratorService_GetTasksServer) error {
-	go func() {
-		for {
-			result, err := stream.Recv()
-			if err != nil {
-				return
-			}
+	ctx := stream.Context()
+	agent := newAgentStream(stream)
+	defer agent.releaseLater(s.Interactor, s.ReleaseGrace)
 
-			id, err := uuid.Parse(result.Id)
-			if err != nil {
-				continue
-			}
+	// Agents announce themselves in the first message, which is handled
+	// before handing out any step.
+	message, err := stream.Recv()
+	if err != nil {
+		return nil
+	}
+	if err := s.handleMessage(ctx, agent, message); err != nil {
+		return err
+	}
 
-			s.Mutex.Lock()
-			err = s.Interactor.SolveTask(id, float64(result.Result))
-			s.Mutex.Unlock()
+	go s.receiveMessages(ctx, agent)
+	go s.sendSettings(ctx, agent)
 
-			if err != nil {
-				continue
+	for {
+		if err := agent.credit.acquire(ctx); err != nil {
+			return nil
+		}
+
+		announced := agent.announced.Load()
+
+		task := s.Interactor.WaitNextTask(ctx, announced.operators)
+		if task == nil {
+			return nil
+		}
+		tasks := []*orchestrator.Task{task}
+
+		// Agents accepting batches are handed out every ready step they
+		// have credit for at once.
+		for announced.batches && agent.credit.tryAcquire() {
+			task := s.Interactor.GetNextTask(announced.operators)
+			if task == nil {
+				agent.credit.release()
+				break
 			}
+			tasks = append(tasks, task)
+		}
+
+		agent.handOut(tasks)
+		if err := s.sendTasks(ctx, agent, tasks); err != nil {
+			// The agent never got the steps, so there's nothing to wait for.
+			agent.release(s.Interactor, tasks)
+			return err
 		}
-	}()
+	}
+}
 
+// sendSettings sends the settings the agent is asked to run with, and again
+// whenever they change, until the stream is closed.
+func (s *Server) sendSettings(ctx context.Context, agent *agentStream) {
 	for {
-		s.Mutex.Lock()
-		task := s.Interactor.GetNextTask()
-		s.Mutex.Unlock()
+		workers, changed := s.Interactor.AgentWorkers()
 
-		if task == nil {
-			time.Sleep(1 * time.Second)
-			continue
+		err := agent.Send(&proto.OrchestratorMessage{
+			Message: &proto.OrchestratorMessage_Settings{Settings: &proto.AgentSettings{Workers: uint32(workers)}},
+		})
+		if err != nil {
+			return
 		}
 
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// sendTasks sends the steps in a single message.
+func (s *Server) sendTasks(ctx context.Context, agent *agentStream, tasks []*orchestrator.Task) error {
+	incoming := make([]*proto.IncomingTask, len(tasks))
+
+	for i, task := range tasks {
 		_, _, _, arg1, arg2, operation, _ := task.NextStep()
-		var execTime uint64
-
-		switch operation {
-		case "+":
-			execTime = uint64(Config.TimeAdditionMS)
-		case "-":
-			execTime = uint64(Config.TimeSubtractionMS)
-		case "*":
-			execTime = uint64(Config.TimeMultiplicationsMS)
-		case "/":
-			execTime = uint64(Config.TimeDivisionsMS)
-		default:
-			continue
-		}
-
-		err := stream.Send(&proto.IncomingTask{
+
+		incoming[i] = &proto.IncomingTask{
 			Id:            task.Expression.Id.String(),
 			Arg1:          arg1,
 			Arg2:          arg2,
 			Operation:     operation,
-			OperationTime: execTime,
-		})
+			OperationTime: uint64(s.Interactor.StepCost(task).Milliseconds()),
+			RequestId:     task.RequestID,
+			StepId:        task.StepID.String(),
+			TraceContext:  tracing.Inject(task.TraceContext(ctx)),
+			Simulate:      task.Expression.Simulate,
+		}
+	}
+
+	var message *proto.OrchestratorMessage
+	switch len(incoming) {
+	case 1:
+		message = &proto.OrchestratorMessage{
+			Message: &proto.OrchestratorMessage_Task{Task: incoming[0]},
+		}
+	default:
+		message = &proto.OrchestratorMessage{
+			Message: &proto.OrchestratorMessage_Tasks{Tasks: &proto.TaskBatch{Tasks: incoming}},
+		}
+	}
+
+	if err := agent.Send(message); err != nil {
+		slog.ErrorContext(ctx, "failed to send tasks", "count", len(incoming), "error", err)
+		return err
+	}
 
+	return nil
+}
+
+// receiveMessages handles the messages sent on the stream until it's
+// closed.
+func (s *Server) receiveMessages(ctx context.Context, agent *agentStream) {
+	for {
+		message, err := agent.Recv()
 		if err != nil {
-			return err
+			return
+		}
+
+		if err := s.handleMessage(ctx, agent, message); err != nil {
+			return
+		}
+	}
+}
+
+// handleMessage applies a message of the agent. Every result is
+// acknowledged, and frees up the credit of its step if it was handed out on
+// the stream.
+func (s *Server) handleMessage(ctx context.Context, agent *agentStream, message *proto.AgentMessage) error {
+	switch message := message.Message.(type) {
+	case *proto.AgentMessage_Capacity:
+		steps := max(int(message.Capacity.Steps), defaultCapacity)
+		slog.DebugContext(ctx, "agent announced capacity",
+			"steps", steps,
+			"batches", message.Capacity.Batches,
+			"operators", message.Capacity.Operators,
+		)
+
+		agent.announced.Store(&announcement{
+			batches:   message.Capacity.Batches,
+			operators: orchestrator.NewOperators(message.Capacity.Operators...),
+		})
+		agent.credit.setCapacity(steps)
+
+	case *proto.AgentMessage_Result:
+		settled := agent.settle(message.Result)
+		ack := s.applyResult(ctx, message.Result)
+		if settled {
+			agent.credit.release()
+		}
+
+		return agent.Send(&proto.OrchestratorMessage{Message: &proto.OrchestratorMessage_Ack{Ack: ack}})
+
+	case *proto.AgentMessage_Results:
+		acks := make([]*proto.ResultAck, len(message.Results.Results))
+		for i, result := range message.Results.Results {
+			settled := agent.settle(result)
+			acks[i] = s.applyResult(ctx, result)
+			if settled {
+				agent.credit.release()
+			}
 		}
+
+		return agent.Send(&proto.OrchestratorMessage{Message: &proto.OrchestratorMessage_Acks{Acks: &proto.AckBatch{Acks: acks}}})
+	}
+
+	return nil
+}
+
+// applyResult solves, or fails, the step the result is for, returning the
+// acknowledgement of the result.
+func (s *Server) applyResult(ctx context.Context, result *proto.TaskResult) *proto.ResultAck {
+	ack := &proto.ResultAck{Id: result.Id, StepId: result.StepId}
+
+	resultCtx := logging.WithExpressionID(ctx, result.Id)
+	if result.RequestId != "" {
+		resultCtx = logging.WithRequestID(resultCtx, result.RequestId)
+	}
+	if result.StepId != "" {
+		resultCtx = logging.WithStepID(resultCtx, result.StepId)
+	}
+	resultCtx = tracing.Extract(resultCtx, result.TraceContext)
+
+	id, err := uuid.Parse(result.Id)
+	if err != nil {
+		slog.WarnContext(ctx, "received result with invalid id", "id", result.Id)
+		ack.Error = "invalid id"
+		return ack
+	}
+
+	if result.Error != "" {
+		err = s.Interactor.FailTask(resultCtx, id, result.Error)
+	} else {
+		err = s.Interactor.SolveTask(resultCtx, id, float64(result.Result))
+	}
+	if err != nil {
+		slog.WarnContext(resultCtx, "failed to solve task", "error", err)
+		ack.Error = err.Error()
 	}
+
+	return ack
+}
+
+type loggingStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggingStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamLoggingInterceptor assigns a request id to every stream, taking it
+// from the x-request-id metadata when the client provides one, and logs
+// when the stream is closed. The x-agent-id metadata identifies the agent
+// owning the stream.
+func StreamLoggingInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := stream.Context()
+
+	id := uuid.NewString()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadataKey); len(values) > 0 && values[0] != "" {
+			id = values[0]
+		}
+		if values := md.Get(AgentIDMetadataKey); len(values) > 0 && values[0] != "" {
+			ctx = logging.WithAgentID(ctx, values[0])
+		}
+	}
+
+	ctx = logging.WithRequestID(ctx, id)
+	start := time.Now()
+
+	slog.InfoContext(ctx, "stream opened", "method", info.FullMethod)
+	err := handler(srv, &loggingStream{ServerStream: stream, ctx: ctx})
+	slog.InfoContext(ctx, "stream closed", "method", info.FullMethod, "duration", time.Since(start), "error", err)
+
+	return err
 }
 
 func RegisterService(grpcServer *grpc.Server, interactor *orchestrator.Interactor) {
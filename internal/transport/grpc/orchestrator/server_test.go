@@ -0,0 +1,228 @@
+package orchestrator
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/transport/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestServer serves the orchestrator over an in-memory connection,
+// returning a client of it.
+func newTestServer(t *testing.T, grace time.Duration) (*orchestrator.Interactor, proto.OrchestratorServiceClient) {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	interactor := orchestrator.NewOrchestratorInteractor(quota.Limits{}, orchestrator.NewFIFOScheduler(), orchestrator.ZeroCost{})
+	server := NewServer(interactor)
+	server.ReleaseGrace = grace
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	proto.RegisterOrchestratorServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	client, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return interactor, proto.NewOrchestratorServiceClient(client)
+}
+
+// testAgent is an agent on a GetTasks stream.
+type testAgent struct {
+	t        *testing.T
+	stream   proto.OrchestratorService_GetTasksClient
+	messages chan *proto.OrchestratorMessage
+	// disconnect ends the stream.
+	disconnect context.CancelFunc
+}
+
+// connect opens a stream announcing the capacity.
+func connect(t *testing.T, client proto.OrchestratorServiceClient, steps uint32) *testAgent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stream, err := client.GetTasks(ctx)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+
+	agent := &testAgent{t: t, stream: stream, messages: make(chan *proto.OrchestratorMessage, 16), disconnect: cancel}
+	go func() {
+		defer close(agent.messages)
+		for {
+			message, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			agent.messages <- message
+		}
+	}()
+
+	agent.send(&proto.AgentMessage{Message: &proto.AgentMessage_Capacity{Capacity: &proto.Capacity{Steps: steps}}})
+
+	return agent
+}
+
+func (a *testAgent) send(message *proto.AgentMessage) {
+	a.t.Helper()
+
+	if err := a.stream.Send(message); err != nil {
+		a.t.Fatalf("failed to send: %v", err)
+	}
+}
+
+// nextTask returns the next step handed out, or nil if none is within
+// timeout.
+func (a *testAgent) nextTask(timeout time.Duration) *proto.IncomingTask {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case message := <-a.messages:
+			if task := message.GetTask(); task != nil {
+				return task
+			}
+		case <-deadline:
+			return nil
+		}
+	}
+}
+
+// solve sends the result of the step, returning its acknowledgement.
+func (a *testAgent) solve(task *proto.IncomingTask, result float32) *proto.ResultAck {
+	a.t.Helper()
+
+	a.send(&proto.AgentMessage{Message: &proto.AgentMessage_Result{Result: &proto.TaskResult{Id: task.Id, StepId: task.StepId, Result: result}}})
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-a.messages:
+			if ack := message.GetAck(); ack != nil {
+				return ack
+			}
+		case <-deadline:
+			a.t.Fatal("result wasn't acknowledged")
+		}
+	}
+}
+
+func submit(t *testing.T, interactor *orchestrator.Interactor, text string) {
+	t.Helper()
+
+	if _, err := interactor.SubmitExpression(context.Background(), "alice", text, orchestrator.ExpressionOptions{}); err != nil {
+		t.Fatalf("failed to submit %s: %v", text, err)
+	}
+}
+
+func TestGetTasksAcceptsResultsResentAfterReconnecting(t *testing.T) {
+	interactor, client := newTestServer(t, time.Minute)
+	submit(t, interactor, "1+2")
+
+	first := connect(t, client, 1)
+	task := first.nextTask(5 * time.Second)
+	if task == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+	first.disconnect()
+
+	second := connect(t, client, 1)
+	if ack := second.solve(task, 3); ack.Error != "" {
+		t.Fatalf("result resent after reconnecting was rejected: %s", ack.Error)
+	}
+
+	if task := second.nextTask(200 * time.Millisecond); task != nil {
+		t.Errorf("got step %s of %s handed out again, want the expression solved", task.StepId, task.Id)
+	}
+}
+
+func TestGetTasksHandsOutStepsOfEndedStreamsAfterGrace(t *testing.T) {
+	interactor, client := newTestServer(t, 100*time.Millisecond)
+	submit(t, interactor, "1+2")
+
+	first := connect(t, client, 1)
+	lost := first.nextTask(5 * time.Second)
+	if lost == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+	first.disconnect()
+
+	second := connect(t, client, 1)
+	retried := second.nextTask(5 * time.Second)
+	if retried == nil || retried.Id != lost.Id || retried.StepId == lost.StepId {
+		t.Fatalf("got %v, want the step handed out again with a new step id", retried)
+	}
+
+	if ack := second.solve(lost, 3); ack.Error == "" {
+		t.Error("expected the result of the step handed out again to be rejected")
+	}
+	if ack := second.solve(retried, 3); ack.Error != "" {
+		t.Errorf("result of the step handed out again was rejected: %s", ack.Error)
+	}
+}
+
+func TestGetTasksKeepsCapacityWithResentResults(t *testing.T) {
+	interactor, client := newTestServer(t, time.Minute)
+	submit(t, interactor, "1+2")
+
+	first := connect(t, client, 1)
+	resent := first.nextTask(5 * time.Second)
+	if resent == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+	first.disconnect()
+
+	submit(t, interactor, "3+4")
+	second := connect(t, client, 1)
+	inFlight := second.nextTask(5 * time.Second)
+	if inFlight == nil {
+		t.Fatal("expected a step to be handed out")
+	}
+
+	if ack := second.solve(resent, 3); ack.Error != "" {
+		t.Fatalf("result resent after reconnecting was rejected: %s", ack.Error)
+	}
+
+	submit(t, interactor, "5+6")
+	if task := second.nextTask(200 * time.Millisecond); task != nil {
+		t.Fatal("expected a resent result not to free up capacity")
+	}
+
+	if ack := second.solve(inFlight, 7); ack.Error != "" {
+		t.Fatalf("result was rejected: %s", ack.Error)
+	}
+	if task := second.nextTask(5 * time.Second); task == nil {
+		t.Error("expected the result of the step in flight to free up capacity")
+	}
+}
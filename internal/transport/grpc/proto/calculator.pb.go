@@ -0,0 +1,1174 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.28.2
+// source: internal/transport/grpc/proto/calculator.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ExpressionStatus int32
+
+const (
+	ExpressionStatus_EXPRESSION_STATUS_UNSPECIFIED ExpressionStatus = 0
+	ExpressionStatus_EXPRESSION_STATUS_ACCEPTED    ExpressionStatus = 1
+	ExpressionStatus_EXPRESSION_STATUS_DONE        ExpressionStatus = 2
+	ExpressionStatus_EXPRESSION_STATUS_EXPIRED     ExpressionStatus = 3
+	ExpressionStatus_EXPRESSION_STATUS_CANCELED    ExpressionStatus = 4
+	ExpressionStatus_EXPRESSION_STATUS_FAILED      ExpressionStatus = 5
+)
+
+// Enum value maps for ExpressionStatus.
+var (
+	ExpressionStatus_name = map[int32]string{
+		0: "EXPRESSION_STATUS_UNSPECIFIED",
+		1: "EXPRESSION_STATUS_ACCEPTED",
+		2: "EXPRESSION_STATUS_DONE",
+		3: "EXPRESSION_STATUS_EXPIRED",
+		4: "EXPRESSION_STATUS_CANCELED",
+		5: "EXPRESSION_STATUS_FAILED",
+	}
+	ExpressionStatus_value = map[string]int32{
+		"EXPRESSION_STATUS_UNSPECIFIED": 0,
+		"EXPRESSION_STATUS_ACCEPTED":    1,
+		"EXPRESSION_STATUS_DONE":        2,
+		"EXPRESSION_STATUS_EXPIRED":     3,
+		"EXPRESSION_STATUS_CANCELED":    4,
+		"EXPRESSION_STATUS_FAILED":      5,
+	}
+)
+
+func (x ExpressionStatus) Enum() *ExpressionStatus {
+	p := new(ExpressionStatus)
+	*p = x
+	return p
+}
+
+func (x ExpressionStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ExpressionStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_transport_grpc_proto_calculator_proto_enumTypes[0].Descriptor()
+}
+
+func (ExpressionStatus) Type() protoreflect.EnumType {
+	return &file_internal_transport_grpc_proto_calculator_proto_enumTypes[0]
+}
+
+func (x ExpressionStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ExpressionStatus.Descriptor instead.
+func (ExpressionStatus) EnumDescriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{0}
+}
+
+// Priority defaults to PRIORITY_NORMAL when unspecified.
+type Priority int32
+
+const (
+	Priority_PRIORITY_UNSPECIFIED Priority = 0
+	Priority_PRIORITY_LOW         Priority = 1
+	Priority_PRIORITY_NORMAL      Priority = 2
+	Priority_PRIORITY_HIGH        Priority = 3
+)
+
+// Enum value maps for Priority.
+var (
+	Priority_name = map[int32]string{
+		0: "PRIORITY_UNSPECIFIED",
+		1: "PRIORITY_LOW",
+		2: "PRIORITY_NORMAL",
+		3: "PRIORITY_HIGH",
+	}
+	Priority_value = map[string]int32{
+		"PRIORITY_UNSPECIFIED": 0,
+		"PRIORITY_LOW":         1,
+		"PRIORITY_NORMAL":      2,
+		"PRIORITY_HIGH":        3,
+	}
+)
+
+func (x Priority) Enum() *Priority {
+	p := new(Priority)
+	*p = x
+	return p
+}
+
+func (x Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_transport_grpc_proto_calculator_proto_enumTypes[1].Descriptor()
+}
+
+func (Priority) Type() protoreflect.EnumType {
+	return &file_internal_transport_grpc_proto_calculator_proto_enumTypes[1]
+}
+
+func (x Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Priority.Descriptor instead.
+func (Priority) EnumDescriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{1}
+}
+
+type RegisterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Login         string                 `protobuf:"bytes,1,opt,name=login,proto3" json:"login,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RegisterRequest) GetLogin() string {
+	if x != nil {
+		return x.Login
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type RegisterResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{1}
+}
+
+type LoginRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Login         string                 `protobuf:"bytes,1,opt,name=login,proto3" json:"login,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LoginRequest) GetLogin() string {
+	if x != nil {
+		return x.Login
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type LoginResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LoginResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type SubmitRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Expression string                 `protobuf:"bytes,1,opt,name=expression,proto3" json:"expression,omitempty"`
+	Priority   Priority               `protobuf:"varint,2,opt,name=priority,proto3,enum=proto.Priority" json:"priority,omitempty"`
+	Deadline   *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=deadline,proto3" json:"deadline,omitempty"`
+	// no_simulate makes agents solve the steps right away, instead of
+	// taking the time the cost model assigns to them.
+	NoSimulate    bool `protobuf:"varint,4,opt,name=no_simulate,json=noSimulate,proto3" json:"no_simulate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitRequest) Reset() {
+	*x = SubmitRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRequest) ProtoMessage() {}
+
+func (x *SubmitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRequest.ProtoReflect.Descriptor instead.
+func (*SubmitRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubmitRequest) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *SubmitRequest) GetDeadline() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Deadline
+	}
+	return nil
+}
+
+func (x *SubmitRequest) GetNoSimulate() bool {
+	if x != nil {
+		return x.NoSimulate
+	}
+	return false
+}
+
+type SubmitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitResponse) Reset() {
+	*x = SubmitResponse{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitResponse) ProtoMessage() {}
+
+func (x *SubmitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitResponse.ProtoReflect.Descriptor instead.
+func (*SubmitResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SubmitResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRequest) Reset() {
+	*x = CancelRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRequest) ProtoMessage() {}
+
+func (x *CancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRequest.ProtoReflect.Descriptor instead.
+func (*CancelRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CancelRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Expression struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Expression string                 `protobuf:"bytes,2,opt,name=expression,proto3" json:"expression,omitempty"`
+	Status     ExpressionStatus       `protobuf:"varint,3,opt,name=status,proto3,enum=proto.ExpressionStatus" json:"status,omitempty"`
+	Result     float64                `protobuf:"fixed64,4,opt,name=result,proto3" json:"result,omitempty"`
+	Priority   Priority               `protobuf:"varint,5,opt,name=priority,proto3,enum=proto.Priority" json:"priority,omitempty"`
+	Deadline   *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=deadline,proto3" json:"deadline,omitempty"`
+	Simulate   bool                   `protobuf:"varint,7,opt,name=simulate,proto3" json:"simulate,omitempty"`
+	CreatedAt  *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	FinishedAt *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	// error is why the expression has ended without a result.
+	Error         string `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Expression) Reset() {
+	*x = Expression{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Expression) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Expression) ProtoMessage() {}
+
+func (x *Expression) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Expression.ProtoReflect.Descriptor instead.
+func (*Expression) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Expression) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Expression) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+func (x *Expression) GetStatus() ExpressionStatus {
+	if x != nil {
+		return x.Status
+	}
+	return ExpressionStatus_EXPRESSION_STATUS_UNSPECIFIED
+}
+
+func (x *Expression) GetResult() float64 {
+	if x != nil {
+		return x.Result
+	}
+	return 0
+}
+
+func (x *Expression) GetPriority() Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return Priority_PRIORITY_UNSPECIFIED
+}
+
+func (x *Expression) GetDeadline() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Deadline
+	}
+	return nil
+}
+
+func (x *Expression) GetSimulate() bool {
+	if x != nil {
+		return x.Simulate
+	}
+	return false
+}
+
+func (x *Expression) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Expression) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Expression) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// ListRequest takes the same filters as the HTTP API. Unset fields don't
+// filter anything.
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        ExpressionStatus       `protobuf:"varint,1,opt,name=status,proto3,enum=proto.ExpressionStatus" json:"status,omitempty"`
+	CreatedAfter  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	CreatedBefore *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	Search        string                 `protobuf:"bytes,4,opt,name=search,proto3" json:"search,omitempty"`
+	Sort          string                 `protobuf:"bytes,5,opt,name=sort,proto3" json:"sort,omitempty"`
+	Limit         uint32                 `protobuf:"varint,6,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor        string                 `protobuf:"bytes,7,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListRequest) GetStatus() ExpressionStatus {
+	if x != nil {
+		return x.Status
+	}
+	return ExpressionStatus_EXPRESSION_STATUS_UNSPECIFIED
+}
+
+func (x *ListRequest) GetCreatedAfter() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAfter
+	}
+	return nil
+}
+
+func (x *ListRequest) GetCreatedBefore() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedBefore
+	}
+	return nil
+}
+
+func (x *ListRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+func (x *ListRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListRequest) GetLimit() uint32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type ListResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Expressions []*Expression          `protobuf:"bytes,1,rep,name=expressions,proto3" json:"expressions,omitempty"`
+	// next_cursor continues the listing, empty on the last page.
+	NextCursor    string `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListResponse) GetExpressions() []*Expression {
+	if x != nil {
+		return x.Expressions
+	}
+	return nil
+}
+
+func (x *ListResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *WatchRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Step struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        uint32                 `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Arg1          string                 `protobuf:"bytes,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Operation     string                 `protobuf:"bytes,3,opt,name=operation,proto3" json:"operation,omitempty"`
+	Arg2          string                 `protobuf:"bytes,4,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	Result        float64                `protobuf:"fixed64,5,opt,name=result,proto3" json:"result,omitempty"`
+	AgentId       string                 `protobuf:"bytes,6,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Step) Reset() {
+	*x = Step{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Step) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Step) ProtoMessage() {}
+
+func (x *Step) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Step.ProtoReflect.Descriptor instead.
+func (*Step) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Step) GetNumber() uint32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Step) GetArg1() string {
+	if x != nil {
+		return x.Arg1
+	}
+	return ""
+}
+
+func (x *Step) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *Step) GetArg2() string {
+	if x != nil {
+		return x.Arg2
+	}
+	return ""
+}
+
+func (x *Step) GetResult() float64 {
+	if x != nil {
+		return x.Result
+	}
+	return 0
+}
+
+func (x *Step) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *Step) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Step) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+type WatchEvent struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Expression *Expression            `protobuf:"bytes,1,opt,name=expression,proto3" json:"expression,omitempty"`
+	// steps are the steps solved since the previous event.
+	Steps         []*Step `protobuf:"bytes,2,rep,name=steps,proto3" json:"steps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_calculator_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *WatchEvent) GetExpression() *Expression {
+	if x != nil {
+		return x.Expression
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetSteps() []*Step {
+	if x != nil {
+		return x.Steps
+	}
+	return nil
+}
+
+var File_internal_transport_grpc_proto_calculator_proto protoreflect.FileDescriptor
+
+const file_internal_transport_grpc_proto_calculator_proto_rawDesc = "" +
+	"\n" +
+	".internal/transport/grpc/proto/calculator.proto\x12\x05proto\x1a\x1fgoogle/protobuf/timestamp.proto\"C\n" +
+	"\x0fRegisterRequest\x12\x14\n" +
+	"\x05login\x18\x01 \x01(\tR\x05login\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"\x12\n" +
+	"\x10RegisterResponse\"@\n" +
+	"\fLoginRequest\x12\x14\n" +
+	"\x05login\x18\x01 \x01(\tR\x05login\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"%\n" +
+	"\rLoginResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\"\xb5\x01\n" +
+	"\rSubmitRequest\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x01 \x01(\tR\n" +
+	"expression\x12+\n" +
+	"\bpriority\x18\x02 \x01(\x0e2\x0f.proto.PriorityR\bpriority\x126\n" +
+	"\bdeadline\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bdeadline\x12\x1f\n" +
+	"\vno_simulate\x18\x04 \x01(\bR\n" +
+	"noSimulate\" \n" +
+	"\x0eSubmitResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1c\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x1f\n" +
+	"\rCancelRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x94\x03\n" +
+	"\n" +
+	"Expression\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x02 \x01(\tR\n" +
+	"expression\x12/\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x17.proto.ExpressionStatusR\x06status\x12\x16\n" +
+	"\x06result\x18\x04 \x01(\x01R\x06result\x12+\n" +
+	"\bpriority\x18\x05 \x01(\x0e2\x0f.proto.PriorityR\bpriority\x126\n" +
+	"\bdeadline\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\bdeadline\x12\x1a\n" +
+	"\bsimulate\x18\a \x01(\bR\bsimulate\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12;\n" +
+	"\vfinished_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error\"\x9c\x02\n" +
+	"\vListRequest\x12/\n" +
+	"\x06status\x18\x01 \x01(\x0e2\x17.proto.ExpressionStatusR\x06status\x12?\n" +
+	"\rcreated_after\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\fcreatedAfter\x12A\n" +
+	"\x0ecreated_before\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\rcreatedBefore\x12\x16\n" +
+	"\x06search\x18\x04 \x01(\tR\x06search\x12\x12\n" +
+	"\x04sort\x18\x05 \x01(\tR\x04sort\x12\x14\n" +
+	"\x05limit\x18\x06 \x01(\rR\x05limit\x12\x16\n" +
+	"\x06cursor\x18\a \x01(\tR\x06cursor\"d\n" +
+	"\fListResponse\x123\n" +
+	"\vexpressions\x18\x01 \x03(\v2\x11.proto.ExpressionR\vexpressions\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"\x1e\n" +
+	"\fWatchRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x8f\x02\n" +
+	"\x04Step\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\rR\x06number\x12\x12\n" +
+	"\x04arg1\x18\x02 \x01(\tR\x04arg1\x12\x1c\n" +
+	"\toperation\x18\x03 \x01(\tR\toperation\x12\x12\n" +
+	"\x04arg2\x18\x04 \x01(\tR\x04arg2\x12\x16\n" +
+	"\x06result\x18\x05 \x01(\x01R\x06result\x12\x19\n" +
+	"\bagent_id\x18\x06 \x01(\tR\aagentId\x129\n" +
+	"\n" +
+	"started_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\"b\n" +
+	"\n" +
+	"WatchEvent\x121\n" +
+	"\n" +
+	"expression\x18\x01 \x01(\v2\x11.proto.ExpressionR\n" +
+	"expression\x12!\n" +
+	"\x05steps\x18\x02 \x03(\v2\v.proto.StepR\x05steps*\xce\x01\n" +
+	"\x10ExpressionStatus\x12!\n" +
+	"\x1dEXPRESSION_STATUS_UNSPECIFIED\x10\x00\x12\x1e\n" +
+	"\x1aEXPRESSION_STATUS_ACCEPTED\x10\x01\x12\x1a\n" +
+	"\x16EXPRESSION_STATUS_DONE\x10\x02\x12\x1d\n" +
+	"\x19EXPRESSION_STATUS_EXPIRED\x10\x03\x12\x1e\n" +
+	"\x1aEXPRESSION_STATUS_CANCELED\x10\x04\x12\x1c\n" +
+	"\x18EXPRESSION_STATUS_FAILED\x10\x05*^\n" +
+	"\bPriority\x12\x18\n" +
+	"\x14PRIORITY_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fPRIORITY_LOW\x10\x01\x12\x13\n" +
+	"\x0fPRIORITY_NORMAL\x10\x02\x12\x11\n" +
+	"\rPRIORITY_HIGH\x10\x032\x8d\x03\n" +
+	"\x11CalculatorService\x12=\n" +
+	"\bRegister\x12\x16.proto.RegisterRequest\x1a\x17.proto.RegisterResponse\"\x00\x124\n" +
+	"\x05Login\x12\x13.proto.LoginRequest\x1a\x14.proto.LoginResponse\"\x00\x127\n" +
+	"\x06Submit\x12\x14.proto.SubmitRequest\x1a\x15.proto.SubmitResponse\"\x00\x12-\n" +
+	"\x03Get\x12\x11.proto.GetRequest\x1a\x11.proto.Expression\"\x00\x121\n" +
+	"\x04List\x12\x12.proto.ListRequest\x1a\x13.proto.ListResponse\"\x00\x123\n" +
+	"\x06Cancel\x12\x14.proto.CancelRequest\x1a\x11.proto.Expression\"\x00\x123\n" +
+	"\x05Watch\x12\x13.proto.WatchRequest\x1a\x11.proto.WatchEvent\"\x000\x01B\x1fZ\x1dinternal/transport/grpc/protob\x06proto3"
+
+var (
+	file_internal_transport_grpc_proto_calculator_proto_rawDescOnce sync.Once
+	file_internal_transport_grpc_proto_calculator_proto_rawDescData []byte
+)
+
+func file_internal_transport_grpc_proto_calculator_proto_rawDescGZIP() []byte {
+	file_internal_transport_grpc_proto_calculator_proto_rawDescOnce.Do(func() {
+		file_internal_transport_grpc_proto_calculator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_transport_grpc_proto_calculator_proto_rawDesc), len(file_internal_transport_grpc_proto_calculator_proto_rawDesc)))
+	})
+	return file_internal_transport_grpc_proto_calculator_proto_rawDescData
+}
+
+var file_internal_transport_grpc_proto_calculator_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_internal_transport_grpc_proto_calculator_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_internal_transport_grpc_proto_calculator_proto_goTypes = []any{
+	(ExpressionStatus)(0),         // 0: proto.ExpressionStatus
+	(Priority)(0),                 // 1: proto.Priority
+	(*RegisterRequest)(nil),       // 2: proto.RegisterRequest
+	(*RegisterResponse)(nil),      // 3: proto.RegisterResponse
+	(*LoginRequest)(nil),          // 4: proto.LoginRequest
+	(*LoginResponse)(nil),         // 5: proto.LoginResponse
+	(*SubmitRequest)(nil),         // 6: proto.SubmitRequest
+	(*SubmitResponse)(nil),        // 7: proto.SubmitResponse
+	(*GetRequest)(nil),            // 8: proto.GetRequest
+	(*CancelRequest)(nil),         // 9: proto.CancelRequest
+	(*Expression)(nil),            // 10: proto.Expression
+	(*ListRequest)(nil),           // 11: proto.ListRequest
+	(*ListResponse)(nil),          // 12: proto.ListResponse
+	(*WatchRequest)(nil),          // 13: proto.WatchRequest
+	(*Step)(nil),                  // 14: proto.Step
+	(*WatchEvent)(nil),            // 15: proto.WatchEvent
+	(*timestamppb.Timestamp)(nil), // 16: google.protobuf.Timestamp
+}
+var file_internal_transport_grpc_proto_calculator_proto_depIdxs = []int32{
+	1,  // 0: proto.SubmitRequest.priority:type_name -> proto.Priority
+	16, // 1: proto.SubmitRequest.deadline:type_name -> google.protobuf.Timestamp
+	0,  // 2: proto.Expression.status:type_name -> proto.ExpressionStatus
+	1,  // 3: proto.Expression.priority:type_name -> proto.Priority
+	16, // 4: proto.Expression.deadline:type_name -> google.protobuf.Timestamp
+	16, // 5: proto.Expression.created_at:type_name -> google.protobuf.Timestamp
+	16, // 6: proto.Expression.finished_at:type_name -> google.protobuf.Timestamp
+	0,  // 7: proto.ListRequest.status:type_name -> proto.ExpressionStatus
+	16, // 8: proto.ListRequest.created_after:type_name -> google.protobuf.Timestamp
+	16, // 9: proto.ListRequest.created_before:type_name -> google.protobuf.Timestamp
+	10, // 10: proto.ListResponse.expressions:type_name -> proto.Expression
+	16, // 11: proto.Step.started_at:type_name -> google.protobuf.Timestamp
+	16, // 12: proto.Step.finished_at:type_name -> google.protobuf.Timestamp
+	10, // 13: proto.WatchEvent.expression:type_name -> proto.Expression
+	14, // 14: proto.WatchEvent.steps:type_name -> proto.Step
+	2,  // 15: proto.CalculatorService.Register:input_type -> proto.RegisterRequest
+	4,  // 16: proto.CalculatorService.Login:input_type -> proto.LoginRequest
+	6,  // 17: proto.CalculatorService.Submit:input_type -> proto.SubmitRequest
+	8,  // 18: proto.CalculatorService.Get:input_type -> proto.GetRequest
+	11, // 19: proto.CalculatorService.List:input_type -> proto.ListRequest
+	9,  // 20: proto.CalculatorService.Cancel:input_type -> proto.CancelRequest
+	13, // 21: proto.CalculatorService.Watch:input_type -> proto.WatchRequest
+	3,  // 22: proto.CalculatorService.Register:output_type -> proto.RegisterResponse
+	5,  // 23: proto.CalculatorService.Login:output_type -> proto.LoginResponse
+	7,  // 24: proto.CalculatorService.Submit:output_type -> proto.SubmitResponse
+	10, // 25: proto.CalculatorService.Get:output_type -> proto.Expression
+	12, // 26: proto.CalculatorService.List:output_type -> proto.ListResponse
+	10, // 27: proto.CalculatorService.Cancel:output_type -> proto.Expression
+	15, // 28: proto.CalculatorService.Watch:output_type -> proto.WatchEvent
+	22, // [22:29] is the sub-list for method output_type
+	15, // [15:22] is the sub-list for method input_type
+	15, // [15:15] is the sub-list for extension type_name
+	15, // [15:15] is the sub-list for extension extendee
+	0,  // [0:15] is the sub-list for field type_name
+}
+
+func init() { file_internal_transport_grpc_proto_calculator_proto_init() }
+func file_internal_transport_grpc_proto_calculator_proto_init() {
+	if File_internal_transport_grpc_proto_calculator_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_transport_grpc_proto_calculator_proto_rawDesc), len(file_internal_transport_grpc_proto_calculator_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_transport_grpc_proto_calculator_proto_goTypes,
+		DependencyIndexes: file_internal_transport_grpc_proto_calculator_proto_depIdxs,
+		EnumInfos:         file_internal_transport_grpc_proto_calculator_proto_enumTypes,
+		MessageInfos:      file_internal_transport_grpc_proto_calculator_proto_msgTypes,
+	}.Build()
+	File_internal_transport_grpc_proto_calculator_proto = out.File
+	file_internal_transport_grpc_proto_calculator_proto_goTypes = nil
+	file_internal_transport_grpc_proto_calculator_proto_depIdxs = nil
+}
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.35.2
+// 	protoc-gen-go v1.36.6
 // 	protoc        v5.28.2
 // source: internal/transport/grpc/proto/orchestrator.proto
 
@@ -11,6 +11,7 @@ import (
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -20,18 +21,496 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-type TaskResult struct {
-	state         protoimpl.MessageState
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*AgentMessage_Result
+	//	*AgentMessage_Capacity
+	//	*AgentMessage_Results
+	Message       isAgentMessage_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AgentMessage) GetMessage() isAgentMessage_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetResult() *TaskResult {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetCapacity() *Capacity {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_Capacity); ok {
+			return x.Capacity
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetResults() *ResultBatch {
+	if x != nil {
+		if x, ok := x.Message.(*AgentMessage_Results); ok {
+			return x.Results
+		}
+	}
+	return nil
+}
+
+type isAgentMessage_Message interface {
+	isAgentMessage_Message()
+}
+
+type AgentMessage_Result struct {
+	Result *TaskResult `protobuf:"bytes,1,opt,name=result,proto3,oneof"`
+}
+
+type AgentMessage_Capacity struct {
+	Capacity *Capacity `protobuf:"bytes,2,opt,name=capacity,proto3,oneof"`
+}
+
+type AgentMessage_Results struct {
+	Results *ResultBatch `protobuf:"bytes,3,opt,name=results,proto3,oneof"`
+}
+
+func (*AgentMessage_Result) isAgentMessage_Message() {}
+
+func (*AgentMessage_Capacity) isAgentMessage_Message() {}
+
+func (*AgentMessage_Results) isAgentMessage_Message() {}
+
+// Capacity may be sent at any time, replacing the previous capacity. An
+// agent which hasn't announced its capacity is handed out a step at a time.
+type Capacity struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Steps uint32                 `protobuf:"varint,1,opt,name=steps,proto3" json:"steps,omitempty"`
+	// batches is set by agents which accept TaskBatch messages.
+	Batches bool `protobuf:"varint,2,opt,name=batches,proto3" json:"batches,omitempty"`
+	// operators are the operators the agent supports, it's handed out steps
+	// of any operator if there are none.
+	Operators     []string `protobuf:"bytes,3,rep,name=operators,proto3" json:"operators,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Capacity) Reset() {
+	*x = Capacity{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Capacity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Capacity) ProtoMessage() {}
+
+func (x *Capacity) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Capacity.ProtoReflect.Descriptor instead.
+func (*Capacity) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Capacity) GetSteps() uint32 {
+	if x != nil {
+		return x.Steps
+	}
+	return 0
+}
+
+func (x *Capacity) GetBatches() bool {
+	if x != nil {
+		return x.Batches
+	}
+	return false
+}
+
+func (x *Capacity) GetOperators() []string {
+	if x != nil {
+		return x.Operators
+	}
+	return nil
+}
+
+type OrchestratorMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*OrchestratorMessage_Task
+	//	*OrchestratorMessage_Ack
+	//	*OrchestratorMessage_Tasks
+	//	*OrchestratorMessage_Acks
+	//	*OrchestratorMessage_Settings
+	Message       isOrchestratorMessage_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrchestratorMessage) Reset() {
+	*x = OrchestratorMessage{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrchestratorMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrchestratorMessage) ProtoMessage() {}
+
+func (x *OrchestratorMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrchestratorMessage.ProtoReflect.Descriptor instead.
+func (*OrchestratorMessage) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *OrchestratorMessage) GetMessage() isOrchestratorMessage_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetTask() *IncomingTask {
+	if x != nil {
+		if x, ok := x.Message.(*OrchestratorMessage_Task); ok {
+			return x.Task
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetAck() *ResultAck {
+	if x != nil {
+		if x, ok := x.Message.(*OrchestratorMessage_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetTasks() *TaskBatch {
+	if x != nil {
+		if x, ok := x.Message.(*OrchestratorMessage_Tasks); ok {
+			return x.Tasks
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetAcks() *AckBatch {
+	if x != nil {
+		if x, ok := x.Message.(*OrchestratorMessage_Acks); ok {
+			return x.Acks
+		}
+	}
+	return nil
+}
+
+func (x *OrchestratorMessage) GetSettings() *AgentSettings {
+	if x != nil {
+		if x, ok := x.Message.(*OrchestratorMessage_Settings); ok {
+			return x.Settings
+		}
+	}
+	return nil
+}
+
+type isOrchestratorMessage_Message interface {
+	isOrchestratorMessage_Message()
+}
+
+type OrchestratorMessage_Task struct {
+	Task *IncomingTask `protobuf:"bytes,1,opt,name=task,proto3,oneof"`
+}
+
+type OrchestratorMessage_Ack struct {
+	Ack *ResultAck `protobuf:"bytes,2,opt,name=ack,proto3,oneof"`
+}
+
+type OrchestratorMessage_Tasks struct {
+	Tasks *TaskBatch `protobuf:"bytes,3,opt,name=tasks,proto3,oneof"`
+}
+
+type OrchestratorMessage_Acks struct {
+	Acks *AckBatch `protobuf:"bytes,4,opt,name=acks,proto3,oneof"`
+}
+
+type OrchestratorMessage_Settings struct {
+	Settings *AgentSettings `protobuf:"bytes,5,opt,name=settings,proto3,oneof"`
+}
+
+func (*OrchestratorMessage_Task) isOrchestratorMessage_Message() {}
+
+func (*OrchestratorMessage_Ack) isOrchestratorMessage_Message() {}
+
+func (*OrchestratorMessage_Tasks) isOrchestratorMessage_Message() {}
+
+func (*OrchestratorMessage_Acks) isOrchestratorMessage_Message() {}
+
+func (*OrchestratorMessage_Settings) isOrchestratorMessage_Message() {}
+
+// AgentSettings are the settings the orchestrator asks agents to run with.
+// Agents announce their new capacity once they have applied them.
+type AgentSettings struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// workers is the amount of workers to run, 0 meaning the amount the
+	// agent is configured with.
+	Workers       uint32 `protobuf:"varint,1,opt,name=workers,proto3" json:"workers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentSettings) Reset() {
+	*x = AgentSettings{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentSettings) ProtoMessage() {}
+
+func (x *AgentSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentSettings.ProtoReflect.Descriptor instead.
+func (*AgentSettings) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AgentSettings) GetWorkers() uint32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+type TaskBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tasks         []*IncomingTask        `protobuf:"bytes,1,rep,name=tasks,proto3" json:"tasks,omitempty"`
+	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskBatch) Reset() {
+	*x = TaskBatch{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskBatch) ProtoMessage() {}
+
+func (x *TaskBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskBatch.ProtoReflect.Descriptor instead.
+func (*TaskBatch) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TaskBatch) GetTasks() []*IncomingTask {
+	if x != nil {
+		return x.Tasks
+	}
+	return nil
+}
+
+type ResultBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*TaskResult          `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-	Id     string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Result float32 `protobuf:"fixed32,2,opt,name=result,proto3" json:"result,omitempty"`
+func (x *ResultBatch) Reset() {
+	*x = ResultBatch{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResultBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultBatch) ProtoMessage() {}
+
+func (x *ResultBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultBatch.ProtoReflect.Descriptor instead.
+func (*ResultBatch) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ResultBatch) GetResults() []*TaskResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type AckBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Acks          []*ResultAck           `protobuf:"bytes,1,rep,name=acks,proto3" json:"acks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AckBatch) Reset() {
+	*x = AckBatch{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AckBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AckBatch) ProtoMessage() {}
+
+func (x *AckBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AckBatch.ProtoReflect.Descriptor instead.
+func (*AckBatch) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *AckBatch) GetAcks() []*ResultAck {
+	if x != nil {
+		return x.Acks
+	}
+	return nil
+}
+
+type TaskResult struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Result       float32                `protobuf:"fixed32,2,opt,name=result,proto3" json:"result,omitempty"`
+	RequestId    string                 `protobuf:"bytes,3,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	StepId       string                 `protobuf:"bytes,4,opt,name=stepId,proto3" json:"stepId,omitempty"`
+	TraceContext map[string]string      `protobuf:"bytes,5,rep,name=traceContext,proto3" json:"traceContext,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// error is why the agent couldn't solve the step, failing the
+	// expression. result is ignored if it's set.
+	Error         string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *TaskResult) Reset() {
 	*x = TaskResult{}
-	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[0]
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -43,7 +522,7 @@ func (x *TaskResult) String() string {
 func (*TaskResult) ProtoMessage() {}
 
 func (x *TaskResult) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[0]
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -56,7 +535,7 @@ func (x *TaskResult) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TaskResult.ProtoReflect.Descriptor instead.
 func (*TaskResult) Descriptor() ([]byte, []int) {
-	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{0}
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *TaskResult) GetId() string {
@@ -73,21 +552,116 @@ func (x *TaskResult) GetResult() float32 {
 	return 0
 }
 
-type IncomingTask struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+func (x *TaskResult) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *TaskResult) GetStepId() string {
+	if x != nil {
+		return x.StepId
+	}
+	return ""
+}
+
+func (x *TaskResult) GetTraceContext() map[string]string {
+	if x != nil {
+		return x.TraceContext
+	}
+	return nil
+}
+
+func (x *TaskResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// ResultAck acknowledges the result of a step. The result has been
+// rejected if error is set.
+type ResultAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	StepId        string                 `protobuf:"bytes,2,opt,name=stepId,proto3" json:"stepId,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResultAck) Reset() {
+	*x = ResultAck{}
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResultAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultAck) ProtoMessage() {}
+
+func (x *ResultAck) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultAck.ProtoReflect.Descriptor instead.
+func (*ResultAck) Descriptor() ([]byte, []int) {
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ResultAck) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
 
-	Id            string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Arg1          string `protobuf:"bytes,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
-	Arg2          string `protobuf:"bytes,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
-	Operation     string `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
-	OperationTime uint64 `protobuf:"varint,5,opt,name=operationTime,proto3" json:"operationTime,omitempty"`
+func (x *ResultAck) GetStepId() string {
+	if x != nil {
+		return x.StepId
+	}
+	return ""
+}
+
+func (x *ResultAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type IncomingTask struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Arg1          string                 `protobuf:"bytes,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Arg2          string                 `protobuf:"bytes,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	Operation     string                 `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
+	OperationTime uint64                 `protobuf:"varint,5,opt,name=operationTime,proto3" json:"operationTime,omitempty"`
+	RequestId     string                 `protobuf:"bytes,6,opt,name=requestId,proto3" json:"requestId,omitempty"`
+	StepId        string                 `protobuf:"bytes,7,opt,name=stepId,proto3" json:"stepId,omitempty"`
+	TraceContext  map[string]string      `protobuf:"bytes,8,rep,name=traceContext,proto3" json:"traceContext,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// simulate asks the agent to take operationTime milliseconds to solve
+	// the step.
+	Simulate      bool `protobuf:"varint,9,opt,name=simulate,proto3" json:"simulate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *IncomingTask) Reset() {
 	*x = IncomingTask{}
-	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[1]
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -99,7 +673,7 @@ func (x *IncomingTask) String() string {
 func (*IncomingTask) ProtoMessage() {}
 
 func (x *IncomingTask) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[1]
+	mi := &file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -112,7 +686,7 @@ func (x *IncomingTask) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IncomingTask.ProtoReflect.Descriptor instead.
 func (*IncomingTask) Descriptor() ([]byte, []int) {
-	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{1}
+	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *IncomingTask) GetId() string {
@@ -150,60 +724,142 @@ func (x *IncomingTask) GetOperationTime() uint64 {
 	return 0
 }
 
-var File_internal_transport_grpc_proto_orchestrator_proto protoreflect.FileDescriptor
+func (x *IncomingTask) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
 
-var file_internal_transport_grpc_proto_orchestrator_proto_rawDesc = []byte{
-	0x0a, 0x30, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73,
-	0x70, 0x6f, 0x72, 0x74, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
-	0x6f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x12, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x34, 0x0a, 0x0a, 0x54, 0x61, 0x73,
-	0x6b, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c,
-	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x02, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22,
-	0x8a, 0x01, 0x0a, 0x0c, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x54, 0x61, 0x73, 0x6b,
-	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64,
-	0x12, 0x12, 0x0a, 0x04, 0x61, 0x72, 0x67, 0x31, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
-	0x61, 0x72, 0x67, 0x31, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x72, 0x67, 0x32, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x04, 0x61, 0x72, 0x67, 0x32, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72,
-	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6f, 0x70, 0x65,
-	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x24, 0x0a, 0x0d, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74,
-	0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0d, 0x6f,
-	0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x32, 0x4f, 0x0a, 0x13,
-	0x4f, 0x72, 0x63, 0x68, 0x65, 0x73, 0x74, 0x72, 0x61, 0x74, 0x6f, 0x72, 0x53, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x12, 0x38, 0x0a, 0x08, 0x47, 0x65, 0x74, 0x54, 0x61, 0x73, 0x6b, 0x73, 0x12,
-	0x11, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54, 0x61, 0x73, 0x6b, 0x52, 0x65, 0x73, 0x75,
-	0x6c, 0x74, 0x1a, 0x13, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x49, 0x6e, 0x63, 0x6f, 0x6d,
-	0x69, 0x6e, 0x67, 0x54, 0x61, 0x73, 0x6b, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x1f, 0x5a,
-	0x1d, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x70,
-	0x6f, 0x72, 0x74, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *IncomingTask) GetStepId() string {
+	if x != nil {
+		return x.StepId
+	}
+	return ""
 }
 
+func (x *IncomingTask) GetTraceContext() map[string]string {
+	if x != nil {
+		return x.TraceContext
+	}
+	return nil
+}
+
+func (x *IncomingTask) GetSimulate() bool {
+	if x != nil {
+		return x.Simulate
+	}
+	return false
+}
+
+var File_internal_transport_grpc_proto_orchestrator_proto protoreflect.FileDescriptor
+
+const file_internal_transport_grpc_proto_orchestrator_proto_rawDesc = "" +
+	"\n" +
+	"0internal/transport/grpc/proto/orchestrator.proto\x12\x05proto\"\xa5\x01\n" +
+	"\fAgentMessage\x12+\n" +
+	"\x06result\x18\x01 \x01(\v2\x11.proto.TaskResultH\x00R\x06result\x12-\n" +
+	"\bcapacity\x18\x02 \x01(\v2\x0f.proto.CapacityH\x00R\bcapacity\x12.\n" +
+	"\aresults\x18\x03 \x01(\v2\x12.proto.ResultBatchH\x00R\aresultsB\t\n" +
+	"\amessage\"X\n" +
+	"\bCapacity\x12\x14\n" +
+	"\x05steps\x18\x01 \x01(\rR\x05steps\x12\x18\n" +
+	"\abatches\x18\x02 \x01(\bR\abatches\x12\x1c\n" +
+	"\toperators\x18\x03 \x03(\tR\toperators\"\xf6\x01\n" +
+	"\x13OrchestratorMessage\x12)\n" +
+	"\x04task\x18\x01 \x01(\v2\x13.proto.IncomingTaskH\x00R\x04task\x12$\n" +
+	"\x03ack\x18\x02 \x01(\v2\x10.proto.ResultAckH\x00R\x03ack\x12(\n" +
+	"\x05tasks\x18\x03 \x01(\v2\x10.proto.TaskBatchH\x00R\x05tasks\x12%\n" +
+	"\x04acks\x18\x04 \x01(\v2\x0f.proto.AckBatchH\x00R\x04acks\x122\n" +
+	"\bsettings\x18\x05 \x01(\v2\x14.proto.AgentSettingsH\x00R\bsettingsB\t\n" +
+	"\amessage\")\n" +
+	"\rAgentSettings\x12\x18\n" +
+	"\aworkers\x18\x01 \x01(\rR\aworkers\"6\n" +
+	"\tTaskBatch\x12)\n" +
+	"\x05tasks\x18\x01 \x03(\v2\x13.proto.IncomingTaskR\x05tasks\":\n" +
+	"\vResultBatch\x12+\n" +
+	"\aresults\x18\x01 \x03(\v2\x11.proto.TaskResultR\aresults\"0\n" +
+	"\bAckBatch\x12$\n" +
+	"\x04acks\x18\x01 \x03(\v2\x10.proto.ResultAckR\x04acks\"\x8a\x02\n" +
+	"\n" +
+	"TaskResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\x02R\x06result\x12\x1c\n" +
+	"\trequestId\x18\x03 \x01(\tR\trequestId\x12\x16\n" +
+	"\x06stepId\x18\x04 \x01(\tR\x06stepId\x12G\n" +
+	"\ftraceContext\x18\x05 \x03(\v2#.proto.TaskResult.TraceContextEntryR\ftraceContext\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x1a?\n" +
+	"\x11TraceContextEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"I\n" +
+	"\tResultAck\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06stepId\x18\x02 \x01(\tR\x06stepId\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\xe8\x02\n" +
+	"\fIncomingTask\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04arg1\x18\x02 \x01(\tR\x04arg1\x12\x12\n" +
+	"\x04arg2\x18\x03 \x01(\tR\x04arg2\x12\x1c\n" +
+	"\toperation\x18\x04 \x01(\tR\toperation\x12$\n" +
+	"\roperationTime\x18\x05 \x01(\x04R\roperationTime\x12\x1c\n" +
+	"\trequestId\x18\x06 \x01(\tR\trequestId\x12\x16\n" +
+	"\x06stepId\x18\a \x01(\tR\x06stepId\x12I\n" +
+	"\ftraceContext\x18\b \x03(\v2%.proto.IncomingTask.TraceContextEntryR\ftraceContext\x12\x1a\n" +
+	"\bsimulate\x18\t \x01(\bR\bsimulate\x1a?\n" +
+	"\x11TraceContextEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012X\n" +
+	"\x13OrchestratorService\x12A\n" +
+	"\bGetTasks\x12\x13.proto.AgentMessage\x1a\x1a.proto.OrchestratorMessage\"\x00(\x010\x01B\x1fZ\x1dinternal/transport/grpc/protob\x06proto3"
+
 var (
 	file_internal_transport_grpc_proto_orchestrator_proto_rawDescOnce sync.Once
-	file_internal_transport_grpc_proto_orchestrator_proto_rawDescData = file_internal_transport_grpc_proto_orchestrator_proto_rawDesc
+	file_internal_transport_grpc_proto_orchestrator_proto_rawDescData []byte
 )
 
 func file_internal_transport_grpc_proto_orchestrator_proto_rawDescGZIP() []byte {
 	file_internal_transport_grpc_proto_orchestrator_proto_rawDescOnce.Do(func() {
-		file_internal_transport_grpc_proto_orchestrator_proto_rawDescData = protoimpl.X.CompressGZIP(file_internal_transport_grpc_proto_orchestrator_proto_rawDescData)
+		file_internal_transport_grpc_proto_orchestrator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_internal_transport_grpc_proto_orchestrator_proto_rawDesc), len(file_internal_transport_grpc_proto_orchestrator_proto_rawDesc)))
 	})
 	return file_internal_transport_grpc_proto_orchestrator_proto_rawDescData
 }
 
-var file_internal_transport_grpc_proto_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_internal_transport_grpc_proto_orchestrator_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_internal_transport_grpc_proto_orchestrator_proto_goTypes = []any{
-	(*TaskResult)(nil),   // 0: proto.TaskResult
-	(*IncomingTask)(nil), // 1: proto.IncomingTask
+	(*AgentMessage)(nil),        // 0: proto.AgentMessage
+	(*Capacity)(nil),            // 1: proto.Capacity
+	(*OrchestratorMessage)(nil), // 2: proto.OrchestratorMessage
+	(*AgentSettings)(nil),       // 3: proto.AgentSettings
+	(*TaskBatch)(nil),           // 4: proto.TaskBatch
+	(*ResultBatch)(nil),         // 5: proto.ResultBatch
+	(*AckBatch)(nil),            // 6: proto.AckBatch
+	(*TaskResult)(nil),          // 7: proto.TaskResult
+	(*ResultAck)(nil),           // 8: proto.ResultAck
+	(*IncomingTask)(nil),        // 9: proto.IncomingTask
+	nil,                         // 10: proto.TaskResult.TraceContextEntry
+	nil,                         // 11: proto.IncomingTask.TraceContextEntry
 }
 var file_internal_transport_grpc_proto_orchestrator_proto_depIdxs = []int32{
-	0, // 0: proto.OrchestratorService.GetTasks:input_type -> proto.TaskResult
-	1, // 1: proto.OrchestratorService.GetTasks:output_type -> proto.IncomingTask
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	7,  // 0: proto.AgentMessage.result:type_name -> proto.TaskResult
+	1,  // 1: proto.AgentMessage.capacity:type_name -> proto.Capacity
+	5,  // 2: proto.AgentMessage.results:type_name -> proto.ResultBatch
+	9,  // 3: proto.OrchestratorMessage.task:type_name -> proto.IncomingTask
+	8,  // 4: proto.OrchestratorMessage.ack:type_name -> proto.ResultAck
+	4,  // 5: proto.OrchestratorMessage.tasks:type_name -> proto.TaskBatch
+	6,  // 6: proto.OrchestratorMessage.acks:type_name -> proto.AckBatch
+	3,  // 7: proto.OrchestratorMessage.settings:type_name -> proto.AgentSettings
+	9,  // 8: proto.TaskBatch.tasks:type_name -> proto.IncomingTask
+	7,  // 9: proto.ResultBatch.results:type_name -> proto.TaskResult
+	8,  // 10: proto.AckBatch.acks:type_name -> proto.ResultAck
+	10, // 11: proto.TaskResult.traceContext:type_name -> proto.TaskResult.TraceContextEntry
+	11, // 12: proto.IncomingTask.traceContext:type_name -> proto.IncomingTask.TraceContextEntry
+	0,  // 13: proto.OrchestratorService.GetTasks:input_type -> proto.AgentMessage
+	2,  // 14: proto.OrchestratorService.GetTasks:output_type -> proto.OrchestratorMessage
+	14, // [14:15] is the sub-list for method output_type
+	13, // [13:14] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_internal_transport_grpc_proto_orchestrator_proto_init() }
@@ -211,13 +867,25 @@ func file_internal_transport_grpc_proto_orchestrator_proto_init() {
 	if File_internal_transport_grpc_proto_orchestrator_proto != nil {
 		return
 	}
+	file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[0].OneofWrappers = []any{
+		(*AgentMessage_Result)(nil),
+		(*AgentMessage_Capacity)(nil),
+		(*AgentMessage_Results)(nil),
+	}
+	file_internal_transport_grpc_proto_orchestrator_proto_msgTypes[2].OneofWrappers = []any{
+		(*OrchestratorMessage_Task)(nil),
+		(*OrchestratorMessage_Ack)(nil),
+		(*OrchestratorMessage_Tasks)(nil),
+		(*OrchestratorMessage_Acks)(nil),
+		(*OrchestratorMessage_Settings)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_internal_transport_grpc_proto_orchestrator_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_transport_grpc_proto_orchestrator_proto_rawDesc), len(file_internal_transport_grpc_proto_orchestrator_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -226,7 +894,6 @@ func file_internal_transport_grpc_proto_orchestrator_proto_init() {
 		MessageInfos:      file_internal_transport_grpc_proto_orchestrator_proto_msgTypes,
 	}.Build()
 	File_internal_transport_grpc_proto_orchestrator_proto = out.File
-	file_internal_transport_grpc_proto_orchestrator_proto_rawDesc = nil
 	file_internal_transport_grpc_proto_orchestrator_proto_goTypes = nil
 	file_internal_transport_grpc_proto_orchestrator_proto_depIdxs = nil
 }
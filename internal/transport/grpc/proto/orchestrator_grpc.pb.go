@@ -26,7 +26,25 @@ const (
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type OrchestratorServiceClient interface {
-	GetTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TaskResult, IncomingTask], error)
+	// GetTasks hands out steps to an agent and receives their results. Every
+	// result is acknowledged, results which haven't been acknowledged when
+	// the stream breaks are resent on a new one. Steps unsolved when the
+	// stream breaks are handed out again after a grace period, unless their
+	// results are resent meanwhile.
+	//
+	// Agents announce their capacity, the amount of steps they can solve at
+	// once, in the first message on the stream; no step is handed out before
+	// it. The orchestrator hands out steps only while fewer than that are
+	// unsolved, every result of a step handed out on the stream frees up a
+	// step.
+	//
+	// Agents which announce it receive the steps handed out at once in a
+	// TaskBatch. Results may be sent in a ResultBatch, acknowledged in an
+	// AckBatch.
+	//
+	// The orchestrator sends AgentSettings once the agent has announced
+	// itself and whenever they change.
+	GetTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error)
 }
 
 type orchestratorServiceClient struct {
@@ -37,24 +55,42 @@ func NewOrchestratorServiceClient(cc grpc.ClientConnInterface) OrchestratorServi
 	return &orchestratorServiceClient{cc}
 }
 
-func (c *orchestratorServiceClient) GetTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TaskResult, IncomingTask], error) {
+func (c *orchestratorServiceClient) GetTasks(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	stream, err := c.cc.NewStream(ctx, &OrchestratorService_ServiceDesc.Streams[0], OrchestratorService_GetTasks_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &grpc.GenericClientStream[TaskResult, IncomingTask]{ClientStream: stream}
+	x := &grpc.GenericClientStream[AgentMessage, OrchestratorMessage]{ClientStream: stream}
 	return x, nil
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type OrchestratorService_GetTasksClient = grpc.BidiStreamingClient[TaskResult, IncomingTask]
+type OrchestratorService_GetTasksClient = grpc.BidiStreamingClient[AgentMessage, OrchestratorMessage]
 
 // OrchestratorServiceServer is the server API for OrchestratorService service.
 // All implementations must embed UnimplementedOrchestratorServiceServer
 // for forward compatibility.
 type OrchestratorServiceServer interface {
-	GetTasks(grpc.BidiStreamingServer[TaskResult, IncomingTask]) error
+	// GetTasks hands out steps to an agent and receives their results. Every
+	// result is acknowledged, results which haven't been acknowledged when
+	// the stream breaks are resent on a new one. Steps unsolved when the
+	// stream breaks are handed out again after a grace period, unless their
+	// results are resent meanwhile.
+	//
+	// Agents announce their capacity, the amount of steps they can solve at
+	// once, in the first message on the stream; no step is handed out before
+	// it. The orchestrator hands out steps only while fewer than that are
+	// unsolved, every result of a step handed out on the stream frees up a
+	// step.
+	//
+	// Agents which announce it receive the steps handed out at once in a
+	// TaskBatch. Results may be sent in a ResultBatch, acknowledged in an
+	// AckBatch.
+	//
+	// The orchestrator sends AgentSettings once the agent has announced
+	// itself and whenever they change.
+	GetTasks(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error
 	mustEmbedUnimplementedOrchestratorServiceServer()
 }
 
@@ -65,7 +101,7 @@ type OrchestratorServiceServer interface {
 // pointer dereference when methods are called.
 type UnimplementedOrchestratorServiceServer struct{}
 
-func (UnimplementedOrchestratorServiceServer) GetTasks(grpc.BidiStreamingServer[TaskResult, IncomingTask]) error {
+func (UnimplementedOrchestratorServiceServer) GetTasks(grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]) error {
 	return status.Errorf(codes.Unimplemented, "method GetTasks not implemented")
 }
 func (UnimplementedOrchestratorServiceServer) mustEmbedUnimplementedOrchestratorServiceServer() {}
@@ -90,11 +126,11 @@ func RegisterOrchestratorServiceServer(s grpc.ServiceRegistrar, srv Orchestrator
 }
 
 func _OrchestratorService_GetTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(OrchestratorServiceServer).GetTasks(&grpc.GenericServerStream[TaskResult, IncomingTask]{ServerStream: stream})
+	return srv.(OrchestratorServiceServer).GetTasks(&grpc.GenericServerStream[AgentMessage, OrchestratorMessage]{ServerStream: stream})
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type OrchestratorService_GetTasksServer = grpc.BidiStreamingServer[TaskResult, IncomingTask]
+type OrchestratorService_GetTasksServer = grpc.BidiStreamingServer[AgentMessage, OrchestratorMessage]
 
 // OrchestratorService_ServiceDesc is the grpc.ServiceDesc for OrchestratorService service.
 // It's only intended for direct use with grpc.RegisterService,
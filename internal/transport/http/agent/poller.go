@@ -3,15 +3,26 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gitgernit/go-calculator/internal/config"
 	"github.com/gitgernit/go-calculator/internal/domain/agent"
 	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/retry"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,91 +32,551 @@ type Task struct {
 	Arg2            string    `json:"arg2"`
 	Operation       string    `json:"operation"`
 	OperationTimeMS int       `json:"operation_time"`
+	Simulate        bool      `json:"simulate"`
 }
 
 type TaskResponse struct {
 	Task *Task `json:"task"`
 }
 
+// BatchTask is a step of a batch, carrying the ids and trace context a
+// single step is sent with in headers.
+type BatchTask struct {
+	Task
+	StepID       string            `json:"step_id"`
+	RequestID    string            `json:"request_id"`
+	TraceContext map[string]string `json:"trace_context"`
+}
+
+type TasksResponse struct {
+	Tasks []BatchTask `json:"tasks"`
+}
+
+type ResultRequest struct {
+	ID           uuid.UUID         `json:"id"`
+	Result       float64           `json:"result"`
+	Error        string            `json:"error,omitempty"`
+	StepID       string            `json:"step_id"`
+	RequestID    string            `json:"request_id,omitempty"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+type ResultsRequest struct {
+	Results []ResultRequest `json:"results"`
+}
+
+type ResultResponse struct {
+	ID     uuid.UUID `json:"id"`
+	StepID string    `json:"step_id"`
+	Status int       `json:"status"`
+	Error  string    `json:"error"`
+}
+
+type ResultsResponse struct {
+	Results []ResultResponse `json:"results"`
+}
+
+// tracedClient propagates the trace context of the step when submitting
+// its result. Polling uses the default client, as idle polls aren't part
+// of any trace.
+var tracedClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+var errNotConnected = errors.New("no request has reached the orchestrator yet")
+
 type ExpressionPoller struct {
 	Config config.Config
+	// Operators are advertised to the orchestrator, so it only hands out
+	// steps of them.
+	Operators []string
+	// TLS makes requests go over HTTPS with the config, they go over plain
+	// HTTP if it's nil.
+	TLS *tls.Config
+
+	clientsOnce  sync.Once
+	client       *http.Client
+	tracedClient *http.Client
+
+	connected     bool
+	connectionErr error
+	// askedWorkers is the amount of workers the orchestrator last asked
+	// for, sent on workers when it changes.
+	askedWorkers int
+	workersOnce  sync.Once
+	workers      chan int
+	mutex        sync.RWMutex
+}
+
+// CheckConnection reports whether the last request reached the
+// orchestrator.
+func (p *ExpressionPoller) CheckConnection(ctx context.Context) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if !p.connected {
+		return errNotConnected
+	}
+
+	return p.connectionErr
+}
+
+func (p *ExpressionPoller) setConnectionErr(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.connected = true
+	p.connectionErr = err
+}
+
+// Workers receives the amount of workers the orchestrator asks for in
+// responses to polls, whenever it changes.
+func (p *ExpressionPoller) Workers() <-chan int {
+	return p.workersChannel()
 }
 
-func (p *ExpressionPoller) GetNextTask(context context.Context) *agent.Task {
-	url := fmt.Sprintf("http://%s:%d/internal/task", p.Config.OrchestratorHost, p.Config.OrchestratorPort)
-	for {
-		select {
-		case <-context.Done():
+func (p *ExpressionPoller) workersChannel() chan int {
+	p.workersOnce.Do(func() { p.workers = make(chan int, 1) })
+	return p.workers
+}
+
+// SetWorkers does nothing, as polls ask for as many steps as there are idle
+// workers.
+func (p *ExpressionPoller) SetWorkers(workers int) {}
+
+// readWorkers reads the amount of workers the orchestrator asks for from
+// the response to a poll. Only the latest amount is kept if it isn't
+// received in time.
+func (p *ExpressionPoller) readWorkers(header http.Header) {
+	workers, err := strconv.Atoi(header.Get(transporthttp.AgentWorkersHeader))
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if workers == p.askedWorkers {
+		return
+	}
+	p.askedWorkers = workers
+
+	ch := p.workersChannel()
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- workers
+}
+
+// clients returns the client polls are made with and the one submitting
+// results, both going over TLS if configured.
+func (p *ExpressionPoller) clients() (*http.Client, *http.Client) {
+	p.clientsOnce.Do(func() {
+		if p.TLS == nil {
+			p.client, p.tracedClient = http.DefaultClient, tracedClient
+			return
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = p.TLS
+		p.client = &http.Client{Transport: transport}
+		p.tracedClient = &http.Client{Transport: otelhttp.NewTransport(transport)}
+	})
+
+	return p.client, p.tracedClient
+}
+
+// statusError is an unexpected response of the orchestrator.
+type statusError struct {
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.status)
+}
+
+// transient reports whether the request may succeed if retried.
+func (e *statusError) transient() bool {
+	return e.code >= http.StatusInternalServerError || e.code == http.StatusTooManyRequests
+}
+
+// GetNextTask polls the orchestrator until it hands out a step, retrying
+// failed polls with backoff. Polls are held by the orchestrator for up to
+// PollingWaitMS, and are made at most once per PollingIntervalMS.
+func (p *ExpressionPoller) GetNextTask(ctx context.Context) *agent.Task {
+	tasks := p.poll(ctx, func(ctx context.Context) ([]*agent.Task, error) {
+		task, err := p.fetchTask(ctx)
+		if task == nil {
+			return nil, err
+		}
+
+		return []*agent.Task{task}, err
+	})
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	return tasks[0]
+}
+
+// GetNextTasks polls the orchestrator like GetNextTask does, until it hands
+// out up to limit steps at once.
+func (p *ExpressionPoller) GetNextTasks(ctx context.Context, limit int) []*agent.Task {
+	return p.poll(ctx, func(ctx context.Context) ([]*agent.Task, error) {
+		return p.fetchTasks(ctx, limit)
+	})
+}
+
+func (p *ExpressionPoller) poll(ctx context.Context, fetch func(context.Context) ([]*agent.Task, error)) []*agent.Task {
+	for attempt := 0; ; {
+		start := time.Now()
+		tasks, err := fetch(ctx)
+		if ctx.Err() != nil {
 			return nil
+		}
+
+		delay := time.Duration(p.Config.PollingIntervalMS)*time.Millisecond - time.Since(start)
+		switch {
+		case err != nil:
+			delay = retry.DefaultBackoff.Delay(attempt)
+			attempt++
+			slog.WarnContext(ctx, "failed to fetch task, retrying", "error", err, "retry_in", delay.String())
+
+		case len(tasks) > 0:
+			return tasks
 
 		default:
-			req, err := http.NewRequestWithContext(context, "GET", url, nil)
-			if err != nil {
-				fmt.Println("error creating request:", err)
-				return nil
-			}
+			attempt = 0
+		}
 
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				fmt.Println("error making request:", err)
-				return nil
-			}
-			defer resp.Body.Close()
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return nil
+		}
+	}
+}
+
+// fetchTask polls the orchestrator once, returning nil if no step became
+// ready while the poll was held.
+func (p *ExpressionPoller) fetchTask(ctx context.Context) (*agent.Task, error) {
+	endpoint := p.url("/internal/task")
+	if p.Config.PollingWaitMS > 0 {
+		endpoint += "?wait=" + p.wait()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setPollHeaders(req)
+
+	client, _ := p.clients()
+	resp, err := client.Do(req)
+	p.setConnectionErr(err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p.readWorkers(resp.Header)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{status: resp.Status, code: resp.StatusCode}
+	}
+
+	var taskResponse TaskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&taskResponse); err != nil {
+		return nil, fmt.Errorf("error decoding task: %w", err)
+	}
+
+	if taskResponse.Task == nil {
+		return nil, errors.New("response has no task")
+	}
+
+	return &agent.Task{
+		ID:              taskResponse.Task.ID,
+		Arg1:            calculator.Token{Value: taskResponse.Task.Arg1},
+		Arg2:            calculator.Token{Value: taskResponse.Task.Arg2},
+		Operation:       calculator.Token{Value: taskResponse.Task.Operation},
+		OperationTimeMS: taskResponse.Task.OperationTimeMS,
+		Simulate:        taskResponse.Task.Simulate,
+		RequestID:       resp.Header.Get(transporthttp.RequestIDHeader),
+		StepID:          resp.Header.Get(transporthttp.StepIDHeader),
+		TraceContext:    tracing.Inject(tracing.ExtractHeader(ctx, resp.Header)),
+	}, nil
+}
+
+func (p *ExpressionPoller) url(path string) string {
+	scheme := "http"
+	if p.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s:%d%s", scheme, p.Config.OrchestratorHost, p.Config.OrchestratorPort, path)
+}
 
-			if resp.StatusCode == http.StatusNotFound {
-				time.Sleep(time.Duration(p.Config.PollingIntervalMS) * time.Millisecond)
+func (p *ExpressionPoller) setPollHeaders(req *http.Request) {
+	req.Header.Set(transporthttp.AgentIDHeader, p.Config.AgentID)
+	if len(p.Operators) > 0 {
+		req.Header.Set(transporthttp.OperatorsHeader, strings.Join(p.Operators, ","))
+	}
+}
+
+// wait is the time polls are held for.
+func (p *ExpressionPoller) wait() string {
+	return (time.Duration(p.Config.PollingWaitMS) * time.Millisecond).String()
+}
+
+// fetchTasks polls the orchestrator once for up to limit steps.
+func (p *ExpressionPoller) fetchTasks(ctx context.Context, limit int) ([]*agent.Task, error) {
+	query := url.Values{"max": {strconv.Itoa(limit)}}
+	if p.Config.PollingWaitMS > 0 {
+		query.Set("wait", p.wait())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.url("/internal/tasks")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setPollHeaders(req)
+
+	client, _ := p.clients()
+	resp, err := client.Do(req)
+	p.setConnectionErr(err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p.readWorkers(resp.Header)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{status: resp.Status, code: resp.StatusCode}
+	}
+
+	var tasksResponse TasksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tasksResponse); err != nil {
+		return nil, fmt.Errorf("error decoding tasks: %w", err)
+	}
+
+	tasks := make([]*agent.Task, len(tasksResponse.Tasks))
+	for i, task := range tasksResponse.Tasks {
+		tasks[i] = &agent.Task{
+			ID:              task.ID,
+			Arg1:            calculator.Token{Value: task.Arg1},
+			Arg2:            calculator.Token{Value: task.Arg2},
+			Operation:       calculator.Token{Value: task.Operation},
+			OperationTimeMS: task.OperationTimeMS,
+			Simulate:        task.Simulate,
+			RequestID:       task.RequestID,
+			StepID:          task.StepID,
+			TraceContext:    task.TraceContext,
+		}
+	}
+
+	return tasks, nil
+}
+
+// SolveTask submits the result, retrying with backoff as long as the
+// orchestrator is unreachable or fails to handle it. Resending a result
+// which has already been received is harmless, as the step id identifies
+// the step it's for.
+func (p *ExpressionPoller) SolveTask(ctx context.Context, id uuid.UUID, result calculator.Token) error {
+	resultFloat, err := strconv.ParseFloat(result.Value, 64)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":     id,
+		"result": resultFloat,
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.submit(ctx, id, payload)
+}
+
+// FailTask submits the failure of the step, retrying like SolveTask does.
+func (p *ExpressionPoller) FailTask(ctx context.Context, id uuid.UUID, reason string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":    id,
+		"error": reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.submit(ctx, id, payload)
+}
+
+// submit submits the result or the failure of a step, retrying with
+// backoff while the orchestrator is unreachable or fails to handle it.
+func (p *ExpressionPoller) submit(ctx context.Context, id uuid.UUID, payload []byte) error {
+	for attempt := 0; ; attempt++ {
+		err := p.submitResult(ctx, id, payload)
+
+		var statusErr *statusError
+		if err == nil || (errors.As(err, &statusErr) && !statusErr.transient()) {
+			return err
+		}
+
+		delay := retry.DefaultBackoff.Delay(attempt)
+		slog.WarnContext(ctx, "failed to submit result, retrying", "error", err, "retry_in", delay.String())
+
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *ExpressionPoller) submitResult(ctx context.Context, id uuid.UUID, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url("/internal/task"), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(transporthttp.ExpressionIDHeader, id.String())
+	req.Header.Set(transporthttp.AgentIDHeader, p.Config.AgentID)
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		req.Header.Set(transporthttp.RequestIDHeader, requestID)
+	}
+	if stepID := logging.StepID(ctx); stepID != "" {
+		req.Header.Set(transporthttp.StepIDHeader, stepID)
+	}
+
+	_, client := p.clients()
+	resp, err := client.Do(req)
+	p.setConnectionErr(err)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{status: resp.Status, code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// SubmitResults submits the results at once, resubmitting the ones which
+// failed transiently with backoff like SolveTask does.
+func (p *ExpressionPoller) SubmitResults(ctx context.Context, results []agent.Result) []error {
+	errs := make([]error, len(results))
+	requests := make([]ResultRequest, len(results))
+
+	// pending holds the indices of the results yet to be accepted.
+	var pending []int
+	for i, result := range results {
+		var value float64
+		if result.Error == "" {
+			var err error
+			if value, err = strconv.ParseFloat(result.Value.Value, 64); err != nil {
+				errs[i] = err
 				continue
 			}
+		}
+
+		requests[i] = ResultRequest{
+			ID:           result.Task.ID,
+			Result:       value,
+			Error:        result.Error,
+			StepID:       result.Task.StepID,
+			RequestID:    result.Task.RequestID,
+			TraceContext: result.TraceContext,
+		}
+		pending = append(pending, i)
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		batch := make([]ResultRequest, len(pending))
+		for n, i := range pending {
+			batch[n] = requests[i]
+		}
 
-			if resp.StatusCode != http.StatusOK {
-				fmt.Println("unexpected response status:", resp.Status)
-				return nil
+		responses, err := p.submitResults(ctx, batch)
+
+		var statusErr *statusError
+		switch {
+		case err == nil:
+			var retried []int
+			for n, response := range responses {
+				resultErr := &statusError{status: fmt.Sprintf("%d %s", response.Status, response.Error), code: response.Status}
+
+				switch {
+				case response.Status == http.StatusOK:
+				case resultErr.transient():
+					retried = append(retried, pending[n])
+				default:
+					errs[pending[n]] = resultErr
+				}
 			}
 
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				fmt.Println("error reading response:", err)
-				return nil
+			pending = retried
+			if len(pending) == 0 {
+				return errs
 			}
+			err = fmt.Errorf("%d of the results failed", len(pending))
 
-			var taskResponse TaskResponse
-			if err := json.Unmarshal(body, &taskResponse); err != nil {
-				fmt.Println("error decoding JSON:", err)
-				return nil
+		case errors.As(err, &statusErr) && !statusErr.transient():
+			for _, i := range pending {
+				errs[i] = err
 			}
+			return errs
+		}
 
-			return &agent.Task{
-				ID:              taskResponse.Task.ID,
-				Arg1:            calculator.Token{Value: taskResponse.Task.Arg1},
-				Arg2:            calculator.Token{Value: taskResponse.Task.Arg2},
-				Operation:       calculator.Token{Value: taskResponse.Task.Operation},
-				OperationTimeMS: taskResponse.Task.OperationTimeMS,
+		delay := retry.DefaultBackoff.Delay(attempt)
+		slog.WarnContext(ctx, "failed to submit results, retrying", "error", err, "retry_in", delay.String())
+
+		if err := retry.Sleep(ctx, delay); err != nil {
+			for _, i := range pending {
+				errs[i] = err
 			}
+			return errs
 		}
 	}
+
+	return errs
 }
 
-func (p *ExpressionPoller) SolveTask(id uuid.UUID, result calculator.Token) error {
-	url := fmt.Sprintf("http://%s:%d/internal/task", p.Config.OrchestratorHost, p.Config.OrchestratorPort)
-	resultFloat, _ := strconv.ParseFloat(result.Value, 64)
-	payload := map[string]interface{}{
-		"id":     id,
-		"result": resultFloat,
+func (p *ExpressionPoller) submitResults(ctx context.Context, results []ResultRequest) ([]ResultResponse, error) {
+	payload, err := json.Marshal(ResultsRequest{Results: results})
+	if err != nil {
+		return nil, err
 	}
-	jsonData, err := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url("/internal/results"), bytes.NewReader(payload))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(transporthttp.AgentIDHeader, p.Config.AgentID)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	client, _ := p.clients()
+	resp, err := client.Do(req)
+	p.setConnectionErr(err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to send result, status: %v", resp.Status)
+		io.Copy(io.Discard, resp.Body)
+		return nil, &statusError{status: resp.Status, code: resp.StatusCode}
 	}
 
-	return nil
+	var resultsResponse ResultsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&resultsResponse); err != nil {
+		return nil, fmt.Errorf("error decoding results: %w", err)
+	}
+
+	if len(resultsResponse.Results) != len(results) {
+		return nil, fmt.Errorf("got %d results acknowledged, want %d", len(resultsResponse.Results), len(results))
+	}
+
+	return resultsResponse.Results, nil
 }
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/config"
+	"github.com/gitgernit/go-calculator/internal/domain/agent"
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
+	"github.com/google/uuid"
+)
+
+func newTestPoller(t *testing.T, handler http.HandlerFunc) *ExpressionPoller {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to parse server address: %v", err)
+	}
+	portNumber, _ := strconv.Atoi(port)
+
+	return &ExpressionPoller{Config: config.Config{
+		OrchestratorHost:  host,
+		OrchestratorPort:  portNumber,
+		PollingIntervalMS: 10,
+		PollingWaitMS:     30000,
+		AgentID:           "agent-1",
+	}}
+}
+
+func TestExpressionPollerLongPolls(t *testing.T) {
+	id := uuid.New()
+	stepID := uuid.NewString()
+
+	var polls atomic.Int32
+	poller := newTestPoller(t, func(w http.ResponseWriter, r *http.Request) {
+		if wait := r.URL.Query().Get("wait"); wait != "30s" {
+			t.Errorf("got wait %q, want 30s", wait)
+		}
+
+		// The first poll is held without a step becoming ready.
+		if polls.Add(1) == 1 {
+			http.Error(w, "No task available", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set(transporthttp.StepIDHeader, stepID)
+		json.NewEncoder(w).Encode(TaskResponse{Task: &Task{
+			ID:        id,
+			Arg1:      "1",
+			Arg2:      "2",
+			Operation: "+",
+		}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	task := poller.GetNextTask(ctx)
+	if task == nil {
+		t.Fatal("expected a task")
+	}
+
+	if task.ID != id || task.StepID != stepID {
+		t.Errorf("got task %s step %s, want %s step %s", task.ID, task.StepID, id, stepID)
+	}
+
+	if polls := polls.Load(); polls != 2 {
+		t.Errorf("got %d polls, want 2", polls)
+	}
+
+	if err := poller.CheckConnection(ctx); err != nil {
+		t.Errorf("poller isn't connected: %v", err)
+	}
+}
+
+func TestExpressionPollerSubmitsResultsInBatches(t *testing.T) {
+	accepted := uuid.New()
+	stale := uuid.New()
+	retried := uuid.New()
+
+	var submissions atomic.Int32
+	poller := newTestPoller(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/internal/results" {
+			t.Errorf("got request to %s, want /internal/results", r.URL.Path)
+		}
+		submission := submissions.Add(1)
+
+		var req ResultsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode results: %v", err)
+		}
+
+		var resp ResultsResponse
+		for _, result := range req.Results {
+			status := http.StatusOK
+			switch {
+			case result.ID == stale:
+				status = http.StatusConflict
+			case result.ID == retried && submission == 1:
+				status = http.StatusServiceUnavailable
+			}
+
+			resp.Results = append(resp.Results, ResultResponse{ID: result.ID, StepID: result.StepID, Status: status})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	var results []agent.Result
+	for _, id := range []uuid.UUID{accepted, stale, retried} {
+		results = append(results, agent.Result{
+			Task:  &agent.Task{ID: id, StepID: uuid.NewString()},
+			Value: calculator.Token{Value: "1"},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errs := poller.SubmitResults(ctx, results)
+
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("got errors %v and %v, want the accepted and the retried result to succeed", errs[0], errs[2])
+	}
+
+	if errs[1] == nil {
+		t.Error("stale result was accepted")
+	}
+
+	if submissions := submissions.Load(); submissions != 2 {
+		t.Errorf("got %d submissions, want the failed result to be resubmitted once", submissions)
+	}
+}
+
+func TestExpressionPollerSubmitsFailures(t *testing.T) {
+	id := uuid.New()
+	stepID := uuid.NewString()
+
+	var failures atomic.Int32
+	poller := newTestPoller(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/internal/task" {
+			t.Errorf("got %s %s, want POST /internal/task", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get(transporthttp.StepIDHeader); got != stepID {
+			t.Errorf("got step id %q, want %q", got, stepID)
+		}
+
+		var req ResultRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode failure: %v", err)
+		}
+		if req.ID != id || req.Error != "zero division error" {
+			t.Errorf("got failure of %s with error %q, want %s with the reason", req.ID, req.Error, id)
+		}
+
+		// The first submission fails transiently and is retried.
+		if failures.Add(1) == 1 {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := poller.FailTask(logging.WithStepID(ctx, stepID), id, "zero division error"); err != nil {
+		t.Fatalf("failed to submit failure: %v", err)
+	}
+	if failures := failures.Load(); failures != 2 {
+		t.Errorf("got %d submissions, want the failed one to be resubmitted once", failures)
+	}
+}
+
+func TestExpressionPollerReadsWorkers(t *testing.T) {
+	var polls atomic.Int32
+	poller := newTestPoller(t, func(w http.ResponseWriter, r *http.Request) {
+		// Only the first poll asks for another amount of workers.
+		workers := "0"
+		if polls.Add(1) == 1 {
+			workers = "6"
+		}
+		w.Header().Set(transporthttp.AgentWorkersHeader, workers)
+
+		if r.URL.Query().Get("max") != "2" {
+			t.Errorf("got max %q, want 2", r.URL.Query().Get("max"))
+		}
+		json.NewEncoder(w).Encode(TasksResponse{Tasks: []BatchTask{{Task: Task{ID: uuid.New(), Operation: "+"}}}})
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for range 3 {
+		if tasks := poller.GetNextTasks(ctx, 2); len(tasks) != 1 {
+			t.Fatalf("got %d tasks, want 1", len(tasks))
+		}
+	}
+
+	// The latest change is kept, the unchanged amounts aren't sent again.
+	select {
+	case workers := <-poller.Workers():
+		if workers != 0 {
+			t.Errorf("got %d workers, want the 0 of the latest change", workers)
+		}
+	default:
+		t.Fatal("expected the amount of workers to be sent")
+	}
+
+	select {
+	case workers := <-poller.Workers():
+		t.Errorf("got %d workers again, want no more changes", workers)
+	default:
+	}
+}
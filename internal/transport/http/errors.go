@@ -0,0 +1,42 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponse is the body of every error response of the orchestrator.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Code names the status in snake case, such as "not_found".
+	Code string `json:"code"`
+}
+
+// WriteError responds with the status and an ErrorResponse carrying the
+// message.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error: message,
+		Code:  ErrorCode(status),
+	})
+}
+
+// ErrorCode names the status in snake case.
+func ErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
+
+// NotFoundHandler responds to requests which no route matches.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotFound, "Not Found")
+}
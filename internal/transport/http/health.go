@@ -0,0 +1,97 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gitgernit/go-calculator/internal/config"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	"github.com/gitgernit/go-calculator/internal/infra/metrics"
+)
+
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// LivenessHandler reports that the process is up and serving requests.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+}
+
+// ReadinessHandler runs the checks and responds with 503 Service
+// Unavailable unless all of them pass.
+func ReadinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		response := HealthResponse{
+			Status: "ok",
+			Checks: make(map[string]string, len(report.Results)),
+		}
+		status := http.StatusOK
+
+		for _, result := range report.Results {
+			if result.Error != nil {
+				response.Checks[result.Name] = result.Error.Error()
+				response.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+
+			response.Checks[result.Name] = "ok"
+		}
+
+		if status != http.StatusOK {
+			slog.WarnContext(r.Context(), "readiness check failed", "checks", response.Checks)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RegisterHealthHandlers mounts /healthz and /readyz on the mux.
+func RegisterHealthHandlers(mux *http.ServeMux, checker *health.Checker) {
+	mux.HandleFunc("GET /healthz", LivenessHandler)
+	mux.HandleFunc("GET /readyz", ReadinessHandler(checker))
+}
+
+// NewHealthServer creates a server exposing /healthz and /readyz, and the
+// default metrics registry at /metrics if withMetrics is set, for processes
+// which don't serve HTTP otherwise.
+func NewHealthServer(host string, port int, checker *health.Checker, withMetrics bool) *http.Server {
+	mux := http.NewServeMux()
+	RegisterHealthHandlers(mux, checker)
+	if withMetrics {
+		mux.Handle("/metrics", metrics.DefaultRegistry.Handler())
+	}
+
+	return &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", host, port),
+		Handler: mux,
+	}
+}
+
+// NewAgentServers creates the metrics and health servers enabled in the
+// agent config. A single server serves both if they share a port.
+func NewAgentServers(cfg config.Config, checker *health.Checker) []*http.Server {
+	var servers []*http.Server
+
+	switch {
+	case cfg.AgentHealthPort != 0 && cfg.AgentHealthPort == cfg.AgentMetricsPort:
+		return append(servers, NewHealthServer(cfg.AgentHealthHost, cfg.AgentHealthPort, checker, true))
+
+	case cfg.AgentHealthPort != 0:
+		servers = append(servers, NewHealthServer(cfg.AgentHealthHost, cfg.AgentHealthPort, checker, false))
+	}
+
+	if cfg.AgentMetricsPort != 0 {
+		servers = append(servers, NewMetricsServer(cfg.AgentMetricsHost, cfg.AgentMetricsPort))
+	}
+
+	return servers
+}
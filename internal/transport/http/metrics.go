@@ -0,0 +1,20 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gitgernit/go-calculator/internal/infra/metrics"
+)
+
+// NewMetricsServer creates a server exposing the default metrics registry
+// at /metrics, for processes which don't serve HTTP otherwise.
+func NewMetricsServer(host string, port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.DefaultRegistry.Handler())
+
+	return &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", host, port),
+		Handler: mux,
+	}
+}
@@ -1,24 +1,169 @@
 package http
 
 import (
-	"encoding/json"
+	"errors"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/metrics"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RequestIDHeader    = "X-Request-Id"
+	ExpressionIDHeader = "X-Expression-Id"
+	StepIDHeader       = "X-Step-Id"
+	AgentIDHeader      = "X-Agent-Id"
+	// OperatorsHeader lists the operators an agent polling for steps
+	// supports, separated by commas. Agents which don't send it are handed
+	// out steps of any operator.
+	OperatorsHeader = "X-Agent-Operators"
+	// AgentWorkersHeader carries the amount of workers the orchestrator
+	// asks agents to run in responses to polls, 0 meaning the amount they
+	// are configured with.
+	AgentWorkersHeader = "X-Agent-Workers"
 )
 
 type Middleware func(next http.Handler) http.Handler
 
+// RequestIDMiddleware stores the request id in the request context and
+// echoes it in the response. The id is taken from the X-Request-Id header
+// when present, so agents can pass along the id of the originating request.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = uuid.NewString()
+		}
+
+		ctx := logging.WithRequestID(r.Context(), id)
+		if expressionID := r.Header.Get(ExpressionIDHeader); expressionID != "" {
+			ctx = logging.WithExpressionID(ctx, expressionID)
+		}
+		if stepID := r.Header.Get(StepIDHeader); stepID != "" {
+			ctx = logging.WithStepID(ctx, stepID)
+		}
+		if agentID := r.Header.Get(AgentIDHeader); agentID != "" {
+			ctx = logging.WithAgentID(ctx, agentID)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+var httpRequests = metrics.NewCounter(
+	"http_requests_total",
+	"Handled HTTP requests.",
+	"method", "pattern", "status",
+)
+
+var httpRequestDuration = metrics.NewHistogram(
+	"http_request_duration_seconds",
+	"Time spent handling HTTP requests.",
+	metrics.DefaultBuckets,
+	"method", "pattern",
+)
+
+// MetricsMiddleware records request counts and durations labelled with the
+// matched ServeMux pattern. It must wrap the mux directly, as the pattern is
+// only known once the mux has routed the request.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		pattern := r.Pattern
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		httpRequests.Inc(r.Method, pattern, strconv.Itoa(recorder.status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, pattern)
+	})
+}
+
+// isPolled reports whether the request is one of the agents' polls of the
+// /internal/ endpoints or a health probe, which are issued constantly.
+func isPolled(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/internal/") || r.URL.Path == "/healthz" || r.URL.Path == "/readyz"
+}
+
+// TracingMiddleware starts a span for every request, continuing the trace
+// from the incoming W3C trace context headers. Agents' idle polls of the
+// /internal/ endpoints and health probes aren't traced, handed out steps
+// have spans of their own. It must wrap MetricsMiddleware or the mux directly to name spans
+// after the matched pattern.
+func TracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if id := logging.RequestID(r.Context()); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		next.ServeHTTP(w, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Method + " " + r.Pattern)
+		}
+	}), "http.request", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.Method != http.MethodGet || !isPolled(r)
+	}))
+}
+
+// LoggingMiddleware logs every handled request. Agent-facing /internal/
+// endpoints and health probes are polled constantly, so they are only
+// logged at debug level.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if isPolled(r) {
+			level = slog.LevelDebug
+		}
+
+		slog.Log(r.Context(), level, "request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
 func PanicMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-
-				response := map[string]string{"error": "Internal server error"}
-				err := json.NewEncoder(w).Encode(response)
-				if err != nil {
-					panic(err)
-				}
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
 			}
 		}()
 
@@ -35,3 +180,31 @@ func CreateStackedMiddleware(middlewares ...Middleware) Middleware {
 		return next
 	}
 }
+
+// RateLimitMiddleware rejects requests with 429 Too Many Requests once the
+// limiter bucket for the key returned by keyFunc is exhausted.
+func RateLimitMiddleware(limiter *quota.RateLimiter, keyFunc func(r *http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := limiter.Allow(keyFunc(r))
+
+			var limitErr *quota.LimitError
+			if errors.As(err, &limitErr) {
+				WriteRetryAfter(w, limitErr.RetryAfter)
+				WriteError(w, http.StatusTooManyRequests, limitErr.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func WriteRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
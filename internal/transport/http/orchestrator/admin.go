@@ -0,0 +1,188 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
+)
+
+// Bounds of the settings changes listed at once.
+const (
+	DefaultSettingsChangesLimit = 50
+	MaxSettingsChangesLimit     = 500
+)
+
+// SettingsResponse are the runtime settings of the orchestrator, times in
+// milliseconds.
+type SettingsResponse struct {
+	CostModel        string         `json:"cost_model"`
+	OperationTimesMS map[string]int `json:"operation_times_ms"`
+	TimePerDigitMS   int            `json:"time_per_digit_ms"`
+	AgentWorkers     int            `json:"agent_workers"`
+}
+
+// SettingsRequest changes the settings which are set, operation times
+// being changed per operator.
+type SettingsRequest struct {
+	CostModel        *string        `json:"cost_model,omitempty"`
+	OperationTimesMS map[string]int `json:"operation_times_ms,omitempty"`
+	TimePerDigitMS   *int           `json:"time_per_digit_ms,omitempty"`
+	AgentWorkers     *int           `json:"agent_workers,omitempty"`
+}
+
+type SettingsChangeResponse struct {
+	Actor     string           `json:"actor"`
+	Before    SettingsResponse `json:"before"`
+	After     SettingsResponse `json:"after"`
+	ChangedAt time.Time        `json:"changed_at"`
+}
+
+type SettingsChangesResponse struct {
+	Changes []SettingsChangeResponse `json:"changes"`
+}
+
+var errNotAdmin = errors.New("Admin access required")
+
+// authorizeAdmin responds with an error unless the request is made by an
+// admin, returning the login of the admin and whether it is one.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	login, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+
+	if !s.Users.IsAdmin(login) {
+		transporthttp.WriteError(w, http.StatusForbidden, errNotAdmin.Error())
+		return "", false
+	}
+
+	return login, true
+}
+
+func newSettingsResponse(settings orchestrator.Settings) SettingsResponse {
+	resp := SettingsResponse{
+		CostModel:        settings.CostModel,
+		OperationTimesMS: make(map[string]int, len(settings.OperationTimes)),
+		TimePerDigitMS:   int(settings.TimePerDigit.Milliseconds()),
+		AgentWorkers:     settings.AgentWorkers,
+	}
+	for operator, cost := range settings.OperationTimes {
+		resp.OperationTimesMS[operator] = int(cost.Milliseconds())
+	}
+
+	return resp
+}
+
+func (req SettingsRequest) update() orchestrator.SettingsUpdate {
+	update := orchestrator.SettingsUpdate{
+		CostModel:    req.CostModel,
+		AgentWorkers: req.AgentWorkers,
+	}
+
+	if req.TimePerDigitMS != nil {
+		perDigit := time.Duration(*req.TimePerDigitMS) * time.Millisecond
+		update.TimePerDigit = &perDigit
+	}
+
+	if len(req.OperationTimesMS) > 0 {
+		update.OperationTimes = make(orchestrator.OperatorCost, len(req.OperationTimesMS))
+		for operator, ms := range req.OperationTimesMS {
+			update.OperationTimes[operator] = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	return update
+}
+
+// SettingsHandler responds with the runtime settings, changing them first
+// on PATCH. Changes are recorded along with the admin making them.
+func (s *Server) SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	actor, ok := s.authorizeAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(newSettingsResponse(s.Interactor.Settings()))
+		return
+	}
+
+	var req SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid request body")
+		return
+	}
+
+	settings, err := s.Interactor.UpdateSettings(r.Context(), actor, req.update())
+	switch {
+	case errors.Is(err, orchestrator.ErrInvalidSettings):
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to update settings", "error", err)
+		transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to update settings")
+		return
+	}
+
+	json.NewEncoder(w).Encode(newSettingsResponse(settings))
+}
+
+// SettingsChangesHandler lists the latest changes of the runtime settings,
+// the latest first.
+func (s *Server) SettingsChangesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	if _, ok := s.authorizeAdmin(w, r); !ok {
+		return
+	}
+
+	limit := DefaultSettingsChangesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			transporthttp.WriteError(w, http.StatusBadRequest, "invalid limit, expected a positive integer")
+			return
+		}
+		limit = min(limit, MaxSettingsChangesLimit)
+	}
+
+	changes, err := s.Interactor.ListSettingsChanges(limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch settings changes", "error", err)
+		transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to fetch settings changes")
+		return
+	}
+
+	resp := SettingsChangesResponse{Changes: make([]SettingsChangeResponse, len(changes))}
+	for i, change := range changes {
+		resp.Changes[i] = SettingsChangeResponse{
+			Actor:     change.Actor,
+			Before:    newSettingsResponse(change.Before),
+			After:     newSettingsResponse(change.After),
+			ChangedAt: change.ChangedAt,
+		}
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
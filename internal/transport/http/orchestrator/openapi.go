@@ -0,0 +1,17 @@
+package orchestrator
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPISpec is the OpenAPI 3 document of every endpoint of the
+// orchestrator.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPISpec)
+}
@@ -0,0 +1,431 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// spec validates JSON documents against the schemas of the OpenAPI
+// document. It supports the subset of JSON Schema the document uses, and
+// rejects properties which aren't documented.
+type spec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+func (s *spec) validate(sch *schema, value any, path string) error {
+	if sch.Ref != "" {
+		resolved, ok := s.Components.Schemas[strings.TrimPrefix(sch.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %s", path, sch.Ref)
+		}
+		return s.validate(resolved, value, path)
+	}
+
+	if len(sch.Enum) > 0 && !slices.Contains(sch.Enum, value) {
+		return fmt.Errorf("%s: %v isn't one of %v", path, value, sch.Enum)
+	}
+
+	switch sch.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %T", path, value)
+		}
+
+		for _, name := range sch.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+
+		for name, property := range object {
+			propertySchema, ok := sch.Properties[name]
+			if !ok {
+				propertySchema = sch.AdditionalProperties
+			}
+			if propertySchema == nil {
+				if sch.Properties == nil {
+					continue
+				}
+				return fmt.Errorf("%s: undocumented property %s", path, name)
+			}
+
+			if err := s.validate(propertySchema, property, path+"."+name); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %T", path, value)
+		}
+		if sch.MaxItems != nil && len(array) > *sch.MaxItems {
+			return fmt.Errorf("%s: more than %d items", path, *sch.MaxItems)
+		}
+
+		for i, item := range array {
+			if err := s.validate(sch.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %T", path, value)
+		}
+
+		switch sch.Format {
+		case "uuid":
+			if _, err := uuid.Parse(str); err != nil {
+				return fmt.Errorf("%s: %q isn't a uuid", path, str)
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %q isn't a date-time", path, str)
+			}
+		}
+
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected a number, got %T", path, value)
+		}
+		if sch.Type == "integer" && number != math.Trunc(number) {
+			return fmt.Errorf("%s: expected an integer, got %v", path, number)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %T", path, value)
+		}
+	}
+
+	return nil
+}
+
+// specTester sends requests to the orchestrator, validating requests and
+// responses against the document and recording the responses covered.
+type specTester struct {
+	t       *testing.T
+	spec    *spec
+	server  *httptest.Server
+	covered map[string]bool
+}
+
+type request struct {
+	method   string
+	route    string
+	path     string
+	token    string
+	header   http.Header
+	body     any
+	want     int
+	response any
+}
+
+func (st *specTester) do(req request) *http.Response {
+	st.t.Helper()
+
+	op, ok := st.spec.Paths[req.route][strings.ToLower(req.method)]
+	if !ok {
+		st.t.Fatalf("%s %s isn't documented", req.method, req.route)
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		payload, err := json.Marshal(req.body)
+		if err != nil {
+			st.t.Fatalf("failed to encode request: %v", err)
+		}
+		body = bytes.NewReader(payload)
+
+		// Requests expected to fail may break the schema on purpose.
+		if req.want < http.StatusBadRequest {
+			var decoded any
+			json.Unmarshal(payload, &decoded)
+			if err := st.spec.validate(op.RequestBody.Content["application/json"].Schema, decoded, "request"); err != nil {
+				st.t.Errorf("%s %s: request doesn't match the document: %v", req.method, req.path, err)
+			}
+		}
+	}
+
+	httpReq, err := http.NewRequest(req.method, st.server.URL+req.path, body)
+	if err != nil {
+		st.t.Fatalf("failed to create request: %v", err)
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if req.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+req.token)
+	}
+
+	resp, err := st.server.Client().Do(httpReq)
+	if err != nil {
+		st.t.Fatalf("%s %s: %v", req.method, req.path, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != req.want {
+		st.t.Fatalf("%s %s: got status %d, want %d: %s", req.method, req.path, resp.StatusCode, req.want, data)
+	}
+
+	status := strconv.Itoa(resp.StatusCode)
+	documented, ok := op.Responses[status]
+	if !ok {
+		st.t.Fatalf("%s %s: status %s isn't documented", req.method, req.route, status)
+	}
+	st.covered[req.method+" "+req.route+" "+status] = true
+
+	content, ok := documented.Content["application/json"]
+	if !ok {
+		return resp
+	}
+
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		st.t.Errorf("%s %s: got content type %q, want application/json", req.method, req.path, got)
+	}
+
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		st.t.Fatalf("%s %s: response isn't JSON: %v: %s", req.method, req.path, err, data)
+	}
+	if err := st.spec.validate(content.Schema, decoded, "response"); err != nil {
+		st.t.Errorf("%s %s %s: response doesn't match the document: %v: %s", req.method, req.path, status, err, data)
+	}
+
+	if req.response != nil {
+		json.Unmarshal(data, req.response)
+	}
+
+	return resp
+}
+
+func TestHandlersMatchOpenAPISpec(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	var s spec
+	if err := json.Unmarshal(OpenAPISpec, &s); err != nil {
+		t.Fatalf("failed to parse document: %v", err)
+	}
+
+	interactor := orchestrator.NewOrchestratorInteractor(quota.Limits{MaxPending: 2}, orchestrator.NewFIFOScheduler(), orchestrator.ZeroCost{})
+	ready := health.NewFlag(errors.New("not ready"))
+	ready.Set(true)
+	checker := health.NewChecker()
+	checker.Register("test", ready.Check)
+
+	users := &auth.UserInteractor{JWTSecretKey: "test", Admins: []string{"root"}}
+	if err := users.CreateAdmins("secret"); err != nil {
+		t.Fatalf("failed to create admins: %v", err)
+	}
+
+	server := httptest.NewServer(NewHTTPServer(interactor, users, quota.NewRateLimiter(interactor.Limits), checker, "", "").Handler)
+	defer server.Close()
+
+	st := &specTester{t: t, spec: &s, server: server, covered: make(map[string]bool)}
+	alice := map[string]string{"login": "alice", "password": "secret"}
+
+	st.do(request{method: "POST", route: "/api/v1/register", path: "/api/v1/register", body: alice, want: 201})
+	st.do(request{method: "POST", route: "/api/v1/register", path: "/api/v1/register", body: alice, want: 409})
+	st.do(request{method: "POST", route: "/api/v1/register", path: "/api/v1/register", body: map[string]string{}, want: 400})
+
+	st.do(request{method: "POST", route: "/api/v1/login", path: "/api/v1/login", body: map[string]string{}, want: 400})
+	st.do(request{method: "POST", route: "/api/v1/login", path: "/api/v1/login", body: map[string]string{"login": "alice", "password": "wrong"}, want: 401})
+	st.do(request{method: "POST", route: "/api/v1/login", path: "/api/v1/login", body: map[string]string{"login": "bob", "password": "secret"}, want: 404})
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	st.do(request{method: "POST", route: "/api/v1/login", path: "/api/v1/login", body: alice, want: 200, response: &login})
+	token := login.Token
+
+	// Two expressions fill the pending limit.
+	var first, second ExpressionResponse
+	st.do(request{method: "POST", route: "/api/v1/calculate", path: "/api/v1/calculate", token: token, body: map[string]any{"expression": "1+2", "priority": "high"}, want: 201, response: &first})
+	st.do(request{method: "POST", route: "/api/v1/calculate", path: "/api/v1/calculate", token: token, body: map[string]any{"expression": "(2+3)*4", "simulate": false}, want: 201, response: &second})
+	st.do(request{method: "POST", route: "/api/v1/calculate", path: "/api/v1/calculate", token: token, body: map[string]any{"expression": "5*5"}, want: 429})
+	st.do(request{method: "POST", route: "/api/v1/calculate", path: "/api/v1/calculate", token: token, body: map[string]any{"expression": "1+"}, want: 422})
+	st.do(request{method: "POST", route: "/api/v1/calculate", path: "/api/v1/calculate", body: map[string]any{"expression": "1+2"}, want: 401})
+
+	st.do(request{method: "GET", route: "/api/v1/expressions", path: "/api/v1/expressions?limit=1", token: token, want: 200})
+	st.do(request{method: "GET", route: "/api/v1/expressions", path: "/api/v1/expressions?status=bogus", token: token, want: 400})
+	st.do(request{method: "GET", route: "/api/v1/expressions", path: "/api/v1/expressions", want: 401})
+
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}", path: "/api/v1/expressions/" + first.ID.String(), token: token, want: 200})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}", path: "/api/v1/expressions/bogus", token: token, want: 400})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}", path: "/api/v1/expressions/" + uuid.NewString(), token: token, want: 404})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}", path: "/api/v1/expressions/" + first.ID.String(), want: 401})
+
+	// The agent takes the step of the first expression, then the one of
+	// the second.
+	plus := http.Header{transporthttp.OperatorsHeader: {"+"}}
+	resp := st.do(request{method: "GET", route: "/internal/task", path: "/internal/task", header: plus, want: 200})
+	firstStep := resp.Header.Get(transporthttp.StepIDHeader)
+
+	var batch TasksResponse
+	st.do(request{method: "GET", route: "/internal/tasks", path: "/internal/tasks?max=5", want: 200, response: &batch})
+	if len(batch.Tasks) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(batch.Tasks))
+	}
+	st.do(request{method: "GET", route: "/internal/tasks", path: "/internal/tasks?max=0", want: 400})
+	st.do(request{method: "GET", route: "/internal/task", path: "/internal/task?wait=bogus", want: 400})
+	st.do(request{method: "GET", route: "/internal/task", path: "/internal/task", want: 404})
+
+	stepHeader := func(id string) http.Header {
+		return http.Header{transporthttp.StepIDHeader: {id}}
+	}
+	st.do(request{method: "POST", route: "/internal/task", path: "/internal/task", header: stepHeader(firstStep), body: TaskResultRequest{ID: first.ID, Result: 3}, want: 200})
+	st.do(request{method: "POST", route: "/internal/task", path: "/internal/task", header: stepHeader(uuid.NewString()), body: TaskResultRequest{ID: first.ID, Result: 3}, want: 404})
+	st.do(request{method: "POST", route: "/internal/task", path: "/internal/task", header: stepHeader(uuid.NewString()), body: TaskResultRequest{ID: second.ID, Result: 5}, want: 409})
+	st.do(request{method: "POST", route: "/internal/task", path: "/internal/task", body: "bogus", want: 422})
+
+	st.do(request{method: "POST", route: "/internal/results", path: "/internal/results", body: TaskResultsRequest{Results: []TaskResultRequest{
+		{ID: second.ID, Result: 5, StepID: batch.Tasks[0].StepID},
+	}}, want: 200})
+	st.do(request{method: "POST", route: "/internal/results", path: "/internal/results", body: TaskResultsRequest{Results: make([]TaskResultRequest, MaxBatchSize+1)}, want: 422})
+
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}/steps", path: "/api/v1/expressions/" + second.ID.String() + "/steps", token: token, want: 200})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}/steps", path: "/api/v1/expressions/bogus/steps", token: token, want: 400})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}/steps", path: "/api/v1/expressions/" + uuid.NewString() + "/steps", token: token, want: 404})
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}/steps", path: "/api/v1/expressions/" + second.ID.String() + "/steps", want: 401})
+
+	st.do(request{method: "POST", route: "/api/v1/expressions/{id}/cancel", path: "/api/v1/expressions/" + second.ID.String() + "/cancel", token: token, want: 200})
+	st.do(request{method: "POST", route: "/api/v1/expressions/{id}/cancel", path: "/api/v1/expressions/" + second.ID.String() + "/cancel", token: token, want: 409})
+	st.do(request{method: "POST", route: "/api/v1/expressions/{id}/cancel", path: "/api/v1/expressions/bogus/cancel", token: token, want: 400})
+	st.do(request{method: "POST", route: "/api/v1/expressions/{id}/cancel", path: "/api/v1/expressions/" + uuid.NewString() + "/cancel", token: token, want: 404})
+	st.do(request{method: "POST", route: "/api/v1/expressions/{id}/cancel", path: "/api/v1/expressions/" + second.ID.String() + "/cancel", want: 401})
+
+	st.do(request{method: "GET", route: "/api/v1/me/usage", path: "/api/v1/me/usage", token: token, want: 200})
+	st.do(request{method: "GET", route: "/api/v1/me/usage", path: "/api/v1/me/usage", want: 401})
+
+	root := map[string]string{"login": "root", "password": "secret"}
+	st.do(request{method: "POST", route: "/api/v1/register", path: "/api/v1/register", body: root, want: 409})
+	var rootLogin struct {
+		Token string `json:"token"`
+	}
+	st.do(request{method: "POST", route: "/api/v1/login", path: "/api/v1/login", body: root, want: 200, response: &rootLogin})
+	admin := rootLogin.Token
+
+	st.do(request{method: "GET", route: "/api/v1/expressions/{id}", path: "/api/v1/expressions/" + first.ID.String(), token: admin, want: 404})
+
+	settings := "/api/v1/admin/settings"
+	st.do(request{method: "GET", route: settings, path: settings, token: admin, want: 200})
+	st.do(request{method: "GET", route: settings, path: settings, token: token, want: 403})
+	st.do(request{method: "GET", route: settings, path: settings, want: 401})
+	st.do(request{method: "PATCH", route: settings, path: settings, token: admin, body: map[string]any{"operation_times_ms": map[string]int{"+": 50}, "agent_workers": 2}, want: 200})
+	st.do(request{method: "PATCH", route: settings, path: settings, token: admin, body: map[string]any{"cost_model": "random"}, want: 422})
+	st.do(request{method: "PATCH", route: settings, path: settings, token: token, body: map[string]any{"agent_workers": 2}, want: 403})
+	st.do(request{method: "PATCH", route: settings, path: settings, body: map[string]any{"agent_workers": 2}, want: 401})
+
+	// Agents are told the amount of workers on every poll.
+	resp = st.do(request{method: "GET", route: "/internal/tasks", path: "/internal/tasks", want: 200})
+	if got := resp.Header.Get(transporthttp.AgentWorkersHeader); got != "2" {
+		t.Errorf("got %q agent workers, want 2", got)
+	}
+
+	var changes SettingsChangesResponse
+	st.do(request{method: "GET", route: settings + "/changes", path: settings + "/changes?limit=10", token: admin, want: 200, response: &changes})
+	if len(changes.Changes) != 1 || changes.Changes[0].Actor != "root" || changes.Changes[0].After.OperationTimesMS["+"] != 50 {
+		t.Errorf("got changes %+v, want the one made by root", changes.Changes)
+	}
+	st.do(request{method: "GET", route: settings + "/changes", path: settings + "/changes?limit=0", token: admin, want: 400})
+	st.do(request{method: "GET", route: settings + "/changes", path: settings + "/changes", token: token, want: 403})
+	st.do(request{method: "GET", route: settings + "/changes", path: settings + "/changes", want: 401})
+
+	st.do(request{method: "GET", route: "/api/v1/openapi.json", path: "/api/v1/openapi.json", want: 200})
+	st.do(request{method: "GET", route: "/metrics", path: "/metrics", want: 200})
+	st.do(request{method: "GET", route: "/healthz", path: "/healthz", want: 200})
+	st.do(request{method: "GET", route: "/readyz", path: "/readyz", want: 200})
+	ready.Set(false)
+	st.do(request{method: "GET", route: "/readyz", path: "/readyz", want: 503})
+
+	// Routes which don't exist respond with the error envelope as well.
+	resp, err = server.Client().Get(server.URL + "/api/v1/bogus")
+	if err != nil {
+		t.Fatalf("failed to request unknown route: %v", err)
+	}
+	var notFound transporthttp.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&notFound)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || notFound.Code != "not_found" || notFound.Error == "" {
+		t.Errorf("unknown route: got %d %+v, want 404 with a not_found error", resp.StatusCode, notFound)
+	}
+
+	// Every documented response has been checked.
+	var missing []string
+	for route, operations := range s.Paths {
+		for method, op := range operations {
+			for status := range op.Responses {
+				if key := strings.ToUpper(method) + " " + route + " " + status; !st.covered[key] {
+					missing = append(missing, key)
+				}
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("responses not covered by the test:\n%s", strings.Join(missing, "\n"))
+	}
+}
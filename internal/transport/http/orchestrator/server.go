@@ -1,29 +1,43 @@
 package orchestrator
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gitgernit/go-calculator/internal/config"
 	"github.com/gitgernit/go-calculator/internal/domain/auth"
-	"github.com/gitgernit/go-calculator/internal/domain/calculator"
 	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/metrics"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	transporthttp "github.com/gitgernit/go-calculator/internal/transport/http"
 	"github.com/google/uuid"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-var CalculatorInteractor = calculator.NewCalculatorInteractor()
-var Config, _ = config.New()
-var AuthInteractor = auth.UserInteractor{JWTSecretKey: Config.JWTSecretKey}
-
 type Server struct {
 	Interactor *orchestrator.Interactor
+	Users      *auth.UserInteractor
+	Limiter    *quota.RateLimiter
 	Mutex      sync.Mutex
 }
 
 type ExpressionRequest struct {
-	Expression string `json:"expression"`
+	Expression string     `json:"expression"`
+	Priority   string     `json:"priority,omitempty"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	// Simulate defaults to true, steps taking the time the cost model
+	// assigns to them.
+	Simulate *bool `json:"simulate,omitempty"`
 }
 
 type ExpressionResponse struct {
@@ -31,13 +45,46 @@ type ExpressionResponse struct {
 }
 
 type ExpressionVerboseResponse struct {
-	ID     string  `json:"id"`
-	Status string  `json:"status"`
-	Result float64 `json:"result"`
+	ID         string     `json:"id"`
+	Expression string     `json:"expression"`
+	Status     string     `json:"status"`
+	Result     float64    `json:"result"`
+	Priority   string     `json:"priority"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Simulate   bool       `json:"simulate"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
 }
 
 type ExpressionsListResponse struct {
 	Expressions []ExpressionVerboseResponse `json:"expressions"`
+	NextCursor  string                      `json:"next_cursor,omitempty"`
+}
+
+type StepResponse struct {
+	Number     int       `json:"number"`
+	Arg1       string    `json:"arg1"`
+	Operation  string    `json:"operation"`
+	Arg2       string    `json:"arg2"`
+	Result     float64   `json:"result"`
+	AgentID    string    `json:"agent_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type StepsListResponse struct {
+	Steps []StepResponse `json:"steps"`
+}
+
+type UsageResponse struct {
+	Pending                int     `json:"pending"`
+	MaxPending             int     `json:"max_pending"`
+	RequestsPerSecond      float64 `json:"requests_per_second"`
+	Burst                  int     `json:"burst"`
+	TokensAvailable        float64 `json:"tokens_available"`
+	MaxExpressionLength    int     `json:"max_expression_length"`
+	MaxExpressionOperators int     `json:"max_expression_operators"`
 }
 
 type TaskResponse struct {
@@ -46,47 +93,188 @@ type TaskResponse struct {
 	Arg2          string    `json:"arg2"`
 	Operation     string    `json:"operation"`
 	OperationTime int       `json:"operation_time"`
+	// Simulate asks the agent to take OperationTime to solve the step.
+	Simulate bool `json:"simulate"`
+	// The ids and trace context of the step are sent in headers as well,
+	// except for batches of steps.
+	StepID       string            `json:"step_id,omitempty"`
+	RequestID    string            `json:"request_id,omitempty"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+type TasksResponse struct {
+	Tasks []TaskResponse `json:"tasks"`
 }
 
 type TaskResultRequest struct {
 	ID     uuid.UUID `json:"id"`
 	Result float64   `json:"result"`
+	// Error is why the agent couldn't solve the step, failing the
+	// expression. Result is ignored if it's set.
+	Error string `json:"error,omitempty"`
+	// StepID, RequestID and TraceContext are only read in batches of
+	// results, single results carry them in headers.
+	StepID       string            `json:"step_id,omitempty"`
+	RequestID    string            `json:"request_id,omitempty"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
 }
 
-func (s *Server) AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+type TaskResultsRequest struct {
+	Results []TaskResultRequest `json:"results"`
+}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// TaskResultResponse is the outcome of a result in a batch, its status
+// being the one a single result would have been responded with.
+type TaskResultResponse struct {
+	ID     uuid.UUID `json:"id"`
+	StepID string    `json:"step_id,omitempty"`
+	Status int       `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type TaskResultsResponse struct {
+	Results []TaskResultResponse `json:"results"`
+}
 
+var errMissingAuthorization = errors.New("Missing or invalid Authorization header")
+var errInvalidToken = errors.New("Invalid token")
+
+func (s *Server) authorize(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-		return
+		return "", errMissingAuthorization
 	}
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 
-	owner, err := AuthInteractor.CheckToken(token)
+	owner, err := s.Users.CheckToken(token)
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return "", errInvalidToken
+	}
+
+	return owner, nil
+}
+
+// rateLimitKey identifies the caller by login when the request carries a
+// valid token and falls back to the remote address otherwise.
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if owner, err := s.authorize(r); err == nil {
+		return owner
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func newExpressionVerboseResponse(expr *orchestrator.Expression) ExpressionVerboseResponse {
+	return ExpressionVerboseResponse{
+		ID:         expr.Id.String(),
+		Expression: expr.Text,
+		Status:     expr.Status.String(),
+		Result:     expr.Result,
+		Priority:   expr.Priority.String(),
+		Deadline:   expr.Deadline,
+		Simulate:   expr.Simulate,
+		CreatedAt:  expr.CreatedAt,
+		FinishedAt: expr.FinishedAt,
+		Error:      expr.Error,
+	}
+}
+
+// parseExpressionQuery reads the filters, sort and page of an expression
+// listing from the query string.
+func parseExpressionQuery(values url.Values) (orchestrator.ExpressionQuery, error) {
+	query := orchestrator.ExpressionQuery{
+		Search: values.Get("q"),
+		Sort:   values.Get("sort"),
+		Cursor: values.Get("cursor"),
+	}
+
+	if value := values.Get("status"); value != "" {
+		status, err := orchestrator.ParseStatus(value)
+		if err != nil {
+			return query, err
+		}
+		query.Status = &status
+	}
+
+	for name, field := range map[string]**time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	} {
+		if value := values.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s, expected an RFC 3339 timestamp", name)
+			}
+			*field = &t
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, errors.New("invalid limit, expected a positive integer")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+func (s *Server) AddExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
 	var req ExpressionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid request body")
 		return
 	}
 
-	tokens, err := CalculatorInteractor.TokenizeInfix(req.Expression)
+	priority, err := orchestrator.ParsePriority(req.Priority)
 	if err != nil {
-		http.Error(w, "Invalid expression", http.StatusUnprocessableEntity)
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid priority")
 		return
 	}
 
-	id := s.Interactor.AddExpression(owner, tokens)
+	id, err := s.Interactor.SubmitExpression(r.Context(), owner, req.Expression, orchestrator.ExpressionOptions{
+		Priority: priority,
+		Deadline: req.Deadline,
+		Simulate: req.Simulate == nil || *req.Simulate,
+	})
+	if err != nil {
+		var limitErr *quota.LimitError
+
+		switch {
+		case errors.Is(err, orchestrator.ErrInvalidExpression):
+			transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid expression")
+		case errors.Is(err, orchestrator.ErrDeadlinePassed):
+			transporthttp.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		case errors.As(err, &limitErr):
+			transporthttp.WriteRetryAfter(w, limitErr.RetryAfter)
+			transporthttp.WriteError(w, http.StatusTooManyRequests, err.Error())
+		case errors.Is(err, quota.ErrExpressionTooLong), errors.Is(err, quota.ErrTooManyOperators):
+			transporthttp.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			slog.ErrorContext(r.Context(), "failed to add expression", "error", err)
+			transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to add expression")
+		}
+		return
+	}
 
 	resp := ExpressionResponse{ID: id}
 	w.WriteHeader(http.StatusCreated)
@@ -97,150 +285,447 @@ func (s *Server) ListExpressionsHandler(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
-	authHeader := r.Header.Get("Authorization")
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	token := strings.TrimPrefix(authHeader, "Bearer ")
 
-	owner, err := AuthInteractor.CheckToken(token)
+	query, err := parseExpressionQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		transporthttp.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	expressions, err := s.Interactor.ListExpressions(owner)
-	if err != nil {
-		http.Error(w, "Failed to fetch expressions", http.StatusInternalServerError)
+	page, err := s.Interactor.ListExpressions(owner, query)
+	switch {
+	case errors.Is(err, orchestrator.ErrInvalidSort), errors.Is(err, orchestrator.ErrInvalidCursor):
+		transporthttp.WriteError(w, http.StatusBadRequest, err.Error())
 		return
-	}
 
-	resp := ExpressionsListResponse{Expressions: make([]ExpressionVerboseResponse, 0)}
-	for _, expr := range expressions {
-		var status string
-		if expr.Status == orchestrator.Accepted {
-			status = "accepted"
-		} else {
-			status = "done"
-		}
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to fetch expressions", "error", err)
+		transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to fetch expressions")
+		return
+	}
 
-		resp.Expressions = append(resp.Expressions, ExpressionVerboseResponse{
-			ID:     expr.Id.String(),
-			Status: status,
-			Result: expr.Result,
-		})
+	resp := ExpressionsListResponse{
+		Expressions: make([]ExpressionVerboseResponse, 0, len(page.Expressions)),
+		NextCursor:  page.NextCursor,
+	}
+	for _, expr := range page.Expressions {
+		resp.Expressions = append(resp.Expressions, newExpressionVerboseResponse(expr))
 	}
 
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (s *Server) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	usage := s.Interactor.Usage(owner)
+
+	json.NewEncoder(w).Encode(UsageResponse{
+		Pending:                usage.Pending,
+		MaxPending:             usage.Limits.MaxPending,
+		RequestsPerSecond:      s.Limiter.Limits.RequestsPerSecond,
+		Burst:                  s.Limiter.Limits.Burst,
+		TokensAvailable:        s.Limiter.Tokens(owner),
+		MaxExpressionLength:    usage.Limits.MaxLength,
+		MaxExpressionOperators: usage.Limits.MaxOperators,
+	})
+}
+
 func (s *Server) GetExpressionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
 	idStr := r.URL.Path[len("/api/v1/expressions/"):]
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		transporthttp.WriteError(w, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	expr := s.Interactor.GetExpression(id)
-	if expr == nil {
-		http.Error(w, "Expression not found", http.StatusNotFound)
+	if expr == nil || expr.Owner != owner {
+		transporthttp.WriteError(w, http.StatusNotFound, "Expression not found")
 		return
 	}
 
-	var status string
+	resp := newExpressionVerboseResponse(expr)
 
-	if expr.Status == orchestrator.Accepted {
-		status = "accepted"
-	} else {
-		status = "done"
+	json.NewEncoder(w).Encode(map[string]*ExpressionVerboseResponse{
+		"expression": &resp,
+	})
+}
+
+func (s *Server) ListStepsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
 	}
 
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	expr := s.Interactor.GetExpression(id)
+	if expr == nil || expr.Owner != owner {
+		transporthttp.WriteError(w, http.StatusNotFound, "Expression not found")
+		return
+	}
+
+	steps, err := s.Interactor.ListSteps(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to fetch steps", "error", err)
+		transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to fetch steps")
+		return
+	}
+
+	resp := StepsListResponse{Steps: make([]StepResponse, len(steps))}
+	for idx, step := range steps {
+		resp.Steps[idx] = StepResponse{
+			Number:     step.Number,
+			Arg1:       step.Arg1,
+			Operation:  step.Operation,
+			Arg2:       step.Arg2,
+			Result:     step.Result,
+			AgentID:    step.AgentId,
+			StartedAt:  step.StartedAt,
+			FinishedAt: step.FinishedAt,
+		}
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CancelExpressionHandler stops solving an expression, responding with it
+// once canceled.
+func (s *Server) CancelExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	owner, err := s.authorize(r)
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	err = s.Interactor.CancelExpression(r.Context(), owner, id)
+	switch {
+	case errors.Is(err, orchestrator.ErrExpressionNotFound):
+		transporthttp.WriteError(w, http.StatusNotFound, "Expression not found")
+		return
+
+	case errors.Is(err, orchestrator.ErrExpressionFinished):
+		transporthttp.WriteError(w, http.StatusConflict, err.Error())
+		return
+
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to cancel expression", "error", err)
+		transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to cancel expression")
+		return
+	}
+
+	expr := s.Interactor.GetExpression(id)
+	if expr == nil {
+		transporthttp.WriteError(w, http.StatusNotFound, "Expression not found")
+		return
+	}
+
+	resp := newExpressionVerboseResponse(expr)
+
 	json.NewEncoder(w).Encode(map[string]*ExpressionVerboseResponse{
-		"expression": &ExpressionVerboseResponse{
-			ID:     expr.Id.String(),
-			Status: status,
-			Result: expr.Result,
-		},
+		"expression": &resp,
 	})
 }
 
+// MaxTaskWait bounds how long a poll for a task is held.
+const MaxTaskWait = time.Minute
+
+// parseTaskWait parses the wait query parameter of a poll for a task, the
+// time to wait for a step to become ready if there's none.
+func parseTaskWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, errors.New("invalid wait, expected a non-negative duration")
+	}
+
+	return min(wait, MaxTaskWait), nil
+}
+
+// parseOperators parses the operators an agent advertises.
+func parseOperators(value string) orchestrator.Operators {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return orchestrator.NewOperators(names...)
+}
+
+// GetTaskHandler hands out the next ready step. With the wait query
+// parameter, the poll is held until a step becomes ready or the wait is
+// over, responding with 404 if none did.
 func (s *Server) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	task := s.Interactor.GetNextTask()
+	wait, err := parseTaskWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	operators := parseOperators(r.Header.Get(transporthttp.OperatorsHeader))
+	s.setAgentWorkersHeader(w)
+
+	var task *orchestrator.Task
+	if wait > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		task = s.Interactor.WaitNextTask(ctx, operators)
+		cancel()
+	} else {
+		task = s.Interactor.GetNextTask(operators)
+	}
+
 	if task == nil {
-		http.Error(w, "No task available", http.StatusNotFound)
+		transporthttp.WriteError(w, http.StatusNotFound, "No task available")
 		return
 	}
 
-	_, _, _, arg1, arg2, operation, _ := task.NextStep()
-	var executionTime int
+	// The agent may have given up on the poll just as the step was handed
+	// out, in which case it's handed out to another one.
+	if r.Context().Err() != nil {
+		s.Interactor.ReleaseTask(task, task.StepID)
+		return
+	}
 
-	switch operation {
-	case "+":
-		executionTime = Config.TimeAdditionMS
-	case "-":
-		executionTime = Config.TimeSubtractionMS
-	case "*":
-		executionTime = Config.TimeMultiplicationsMS
-	case "/":
-		executionTime = Config.TimeDivisionsMS
+	w.Header().Set(transporthttp.ExpressionIDHeader, task.Expression.Id.String())
+	w.Header().Set(transporthttp.StepIDHeader, task.StepID.String())
+	if task.RequestID != "" {
+		w.Header().Set(transporthttp.RequestIDHeader, task.RequestID)
 	}
+	tracing.InjectHeader(task.TraceContext(r.Context()), w.Header())
 
 	resp := struct {
 		Task TaskResponse `json:"task"`
 	}{
-		Task: TaskResponse{
-			ID:            task.Expression.Id,
-			Arg1:          arg1,
-			Arg2:          arg2,
-			Operation:     operation,
-			OperationTime: executionTime,
-		},
+		Task: s.newTaskResponse(r.Context(), task),
 	}
 
 	json.NewEncoder(w).Encode(resp)
 }
 
+// MaxBatchSize bounds the steps handed out by a single poll and the results
+// submitted at once.
+const MaxBatchSize = 100
+
+// GetTasksHandler hands out up to max ready steps, holding the poll for the
+// wait query parameter like GetTaskHandler does.
+func (s *Server) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	wait, err := parseTaskWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		transporthttp.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 1
+	if value := r.URL.Query().Get("max"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			transporthttp.WriteError(w, http.StatusBadRequest, "invalid max, expected a positive integer")
+			return
+		}
+		limit = min(limit, MaxBatchSize)
+	}
+	s.setAgentWorkersHeader(w)
+
+	// Ready steps are handed out right away even if the wait is already
+	// over.
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	tasks := s.Interactor.WaitNextTasks(ctx, limit, parseOperators(r.Header.Get(transporthttp.OperatorsHeader)))
+	cancel()
+
+	if r.Context().Err() != nil {
+		for _, task := range tasks {
+			s.Interactor.ReleaseTask(task, task.StepID)
+		}
+		return
+	}
+
+	resp := TasksResponse{Tasks: make([]TaskResponse, len(tasks))}
+	for i, task := range tasks {
+		resp.Tasks[i] = s.newTaskResponse(r.Context(), task)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setAgentWorkersHeader tells the polling agent how many workers to run.
+func (s *Server) setAgentWorkersHeader(w http.ResponseWriter) {
+	workers, _ := s.Interactor.AgentWorkers()
+	w.Header().Set(transporthttp.AgentWorkersHeader, strconv.Itoa(workers))
+}
+
+func (s *Server) newTaskResponse(ctx context.Context, task *orchestrator.Task) TaskResponse {
+	_, _, _, arg1, arg2, operation, _ := task.NextStep()
+
+	return TaskResponse{
+		ID:            task.Expression.Id,
+		Arg1:          arg1,
+		Arg2:          arg2,
+		Operation:     operation,
+		OperationTime: int(s.Interactor.StepCost(task).Milliseconds()),
+		Simulate:      task.Expression.Simulate,
+		StepID:        task.StepID.String(),
+		RequestID:     task.RequestID,
+		TraceContext:  tracing.Inject(task.TraceContext(ctx)),
+	}
+}
+
 func (s *Server) SolveTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
 	var req TaskResultRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusUnprocessableEntity)
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid request body")
 		return
 	}
 
-	if err := s.Interactor.SolveTask(req.ID, req.Result); err != nil {
-		if err.Error() == "no such task found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		}
+	if status, message := s.solveTask(r.Context(), req); status != http.StatusOK {
+		transporthttp.WriteError(w, status, message)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// SolveTasksHandler applies a batch of results, responding with the outcome
+// of each of them.
+func (s *Server) SolveTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	var req TaskResultsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, "Invalid request body")
+		return
+	}
+
+	if len(req.Results) > MaxBatchSize {
+		transporthttp.WriteError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Too many results, at most %d are accepted at once", MaxBatchSize))
+		return
+	}
+
+	resp := TaskResultsResponse{Results: make([]TaskResultResponse, len(req.Results))}
+	for i, result := range req.Results {
+		ctx := logging.WithExpressionID(r.Context(), result.ID.String())
+		if result.RequestID != "" {
+			ctx = logging.WithRequestID(ctx, result.RequestID)
+		}
+		if result.StepID != "" {
+			ctx = logging.WithStepID(ctx, result.StepID)
+		}
+		ctx = tracing.Extract(ctx, result.TraceContext)
+
+		resp.Results[i] = TaskResultResponse{ID: result.ID, StepID: result.StepID}
+		resp.Results[i].Status, resp.Results[i].Error = s.solveTask(ctx, result)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// solveTask applies the result, or the failure, returning the status to
+// respond with and the message of the error, if any.
+func (s *Server) solveTask(ctx context.Context, req TaskResultRequest) (int, string) {
+	var err error
+	if req.Error != "" {
+		err = s.Interactor.FailTask(ctx, req.ID, req.Error)
+	} else {
+		err = s.Interactor.SolveTask(ctx, req.ID, req.Result)
+	}
+
+	switch {
+	case err == nil:
+		return http.StatusOK, ""
+	case errors.Is(err, orchestrator.ErrTaskNotFound):
+		return http.StatusNotFound, err.Error()
+	case errors.Is(err, orchestrator.ErrStaleResult):
+		return http.StatusConflict, err.Error()
+	default:
+		slog.ErrorContext(ctx, "failed to solve task", "error", err)
+		return http.StatusInternalServerError, "Something went wrong"
+	}
+}
+
 func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
@@ -249,21 +734,22 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		transporthttp.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Login == "" || req.Password == "" {
-		http.Error(w, "Login and password are required", http.StatusBadRequest)
+		transporthttp.WriteError(w, http.StatusBadRequest, "Login and password are required")
 		return
 	}
 
-	err := AuthInteractor.Create(req.Login, req.Password)
+	err := s.Users.Create(req.Login, req.Password)
 	if err != nil {
-		if err.Error() == "user already exists" {
-			http.Error(w, err.Error(), http.StatusConflict)
+		if errors.Is(err, auth.ErrUserExists) {
+			transporthttp.WriteError(w, http.StatusConflict, err.Error())
 		} else {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "failed to create user", "error", err)
+			transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to create user")
 		}
 		return
 	}
@@ -276,7 +762,7 @@ func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
@@ -285,23 +771,24 @@ func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		transporthttp.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Login == "" || req.Password == "" {
-		http.Error(w, "Login and password are required", http.StatusBadRequest)
+		transporthttp.WriteError(w, http.StatusBadRequest, "Login and password are required")
 		return
 	}
 
-	token, err := AuthInteractor.Authorize(req.Login, req.Password)
+	token, err := s.Users.Authorize(req.Login, req.Password)
 	if err != nil {
-		if err.Error() == "user not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
-		} else if err.Error() == "invalid password" {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			transporthttp.WriteError(w, http.StatusNotFound, err.Error())
+		} else if errors.Is(err, auth.ErrInvalidPassword) {
+			transporthttp.WriteError(w, http.StatusUnauthorized, err.Error())
 		} else {
-			http.Error(w, "Failed to authorize", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "failed to authorize", "error", err)
+			transporthttp.WriteError(w, http.StatusInternalServerError, "Failed to authorize")
 		}
 		return
 	}
@@ -309,15 +796,30 @@ func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
 
-func NewHTTPServer(interactor *orchestrator.Interactor, host string, port string) *http.Server {
-	srv := &Server{Interactor: interactor}
+// NewHTTPServer serves the API on host and port. The limiter may be shared
+// with other transports, so clients are limited across all of them.
+func NewHTTPServer(interactor *orchestrator.Interactor, users *auth.UserInteractor, limiter *quota.RateLimiter, checker *health.Checker, host string, port string) *http.Server {
+	srv := &Server{
+		Interactor: interactor,
+		Users:      users,
+		Limiter:    limiter,
+	}
 	mux := http.NewServeMux()
+	rateLimited := transporthttp.RateLimitMiddleware(srv.Limiter, srv.rateLimitKey)
 
-	mux.HandleFunc("/api/v1/calculate", srv.AddExpressionHandler)
+	mux.Handle("/api/v1/calculate", rateLimited(http.HandlerFunc(srv.AddExpressionHandler)))
+	mux.HandleFunc("/api/v1/me/usage", srv.UsageHandler)
 	mux.HandleFunc("/api/v1/expressions", srv.ListExpressionsHandler)
 	mux.HandleFunc("/api/v1/expressions/", srv.GetExpressionHandler)
+	mux.HandleFunc("/api/v1/expressions/{id}/steps", srv.ListStepsHandler)
+	mux.HandleFunc("/api/v1/expressions/{id}/cancel", srv.CancelExpressionHandler)
 	mux.HandleFunc("/api/v1/register", srv.RegisterHandler)
 	mux.HandleFunc("/api/v1/login", srv.LoginHandler)
+	mux.HandleFunc("/api/v1/admin/settings", srv.SettingsHandler)
+	mux.HandleFunc("/api/v1/admin/settings/changes", srv.SettingsChangesHandler)
+	mux.HandleFunc("GET /api/v1/openapi.json", OpenAPIHandler)
+	mux.Handle("/metrics", metrics.DefaultRegistry.Handler())
+	transporthttp.RegisterHealthHandlers(mux, checker)
 	mux.HandleFunc("/internal/task", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -327,12 +829,22 @@ func NewHTTPServer(interactor *orchestrator.Interactor, host string, port string
 			srv.SolveTaskHandler(w, r)
 
 		default:
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			transporthttp.WriteError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
 		}
 	})
+	mux.HandleFunc("/internal/tasks", srv.GetTasksHandler)
+	mux.HandleFunc("/internal/results", srv.SolveTasksHandler)
+	mux.HandleFunc("/", transporthttp.NotFoundHandler)
+
+	stack := transporthttp.CreateStackedMiddleware(
+		transporthttp.RequestIDMiddleware,
+		transporthttp.LoggingMiddleware,
+		transporthttp.TracingMiddleware,
+		transporthttp.MetricsMiddleware,
+	)
 
 	return &http.Server{
 		Addr:    fmt.Sprintf("%s:%s", host, port),
-		Handler: mux,
+		Handler: stack(mux),
 	}
 }
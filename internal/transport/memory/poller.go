@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/gitgernit/go-calculator/internal/domain/agent"
+	"github.com/gitgernit/go-calculator/internal/domain/calculator"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	"github.com/gitgernit/go-calculator/internal/infra/tracing"
+	"github.com/google/uuid"
+)
+
+// Poller hands out the steps of an orchestrator running in the same process
+// to agent workers, calling the orchestrator directly instead of going over
+// the network.
+type Poller struct {
+	Interactor *orchestrator.Interactor
+	agentID    string
+	// operators are the operators the agent supports, it's handed out
+	// steps of any operator if there are none.
+	operators orchestrator.Operators
+
+	// workers receives the amount of workers the orchestrator asks for,
+	// only the latest one is kept.
+	workers     chan int
+	workersOnce sync.Once
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewPoller(interactor *orchestrator.Interactor, agentID string, operators []string) *Poller {
+	return &Poller{
+		Interactor: interactor,
+		agentID:    agentID,
+		operators:  orchestrator.NewOperators(operators...),
+		workers:    make(chan int, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// Close stops following the amount of workers the orchestrator asks for.
+func (p *Poller) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+// CheckConnection always succeeds, the orchestrator is in the same process.
+func (p *Poller) CheckConnection(ctx context.Context) error {
+	return nil
+}
+
+func (p *Poller) newTask(ctx context.Context, task *orchestrator.Task) *agent.Task {
+	_, _, _, arg1, arg2, operation, _ := task.NextStep()
+
+	return &agent.Task{
+		ID:              task.Expression.Id,
+		Arg1:            calculator.Token{Value: arg1},
+		Arg2:            calculator.Token{Value: arg2},
+		Operation:       calculator.Token{Value: operation},
+		OperationTimeMS: int(p.Interactor.StepCost(task).Milliseconds()),
+		Simulate:        task.Expression.Simulate,
+		RequestID:       task.RequestID,
+		StepID:          task.StepID.String(),
+		TraceContext:    tracing.Inject(task.TraceContext(ctx)),
+	}
+}
+
+// GetNextTask waits for the next step of the operators of the agent.
+func (p *Poller) GetNextTask(ctx context.Context) *agent.Task {
+	task := p.Interactor.WaitNextTask(ctx, p.operators)
+	if task == nil {
+		return nil
+	}
+
+	return p.newTask(ctx, task)
+}
+
+// GetNextTasks waits for up to limit steps of the operators of the agent.
+func (p *Poller) GetNextTasks(ctx context.Context, limit int) []*agent.Task {
+	tasks := p.Interactor.WaitNextTasks(ctx, limit, p.operators)
+	if tasks == nil {
+		return nil
+	}
+
+	agentTasks := make([]*agent.Task, len(tasks))
+	for i, task := range tasks {
+		agentTasks[i] = p.newTask(ctx, task)
+	}
+
+	return agentTasks
+}
+
+// SolveTask solves the step on the orchestrator, ctx carrying the id of the
+// step.
+func (p *Poller) SolveTask(ctx context.Context, id uuid.UUID, result calculator.Token) error {
+	resultFloat, err := strconv.ParseFloat(result.Value, 64)
+	if err != nil {
+		return err
+	}
+
+	return p.Interactor.SolveTask(logging.WithAgentID(ctx, p.agentID), id, resultFloat)
+}
+
+// FailTask fails the step on the orchestrator, ctx carrying the id of the
+// step.
+func (p *Poller) FailTask(ctx context.Context, id uuid.UUID, reason string) error {
+	return p.Interactor.FailTask(logging.WithAgentID(ctx, p.agentID), id, reason)
+}
+
+// SubmitResults solves or fails each of the steps on the orchestrator, in
+// the trace context they were solved in.
+func (p *Poller) SubmitResults(ctx context.Context, results []agent.Result) []error {
+	errs := make([]error, len(results))
+
+	for i, result := range results {
+		resultCtx := result.Task.Context(ctx)
+		if result.TraceContext != nil {
+			resultCtx = tracing.Extract(resultCtx, result.TraceContext)
+		}
+
+		if result.Error != "" {
+			errs[i] = p.FailTask(resultCtx, result.Task.ID, result.Error)
+			continue
+		}
+
+		errs[i] = p.SolveTask(resultCtx, result.Task.ID, result.Value)
+	}
+
+	return errs
+}
+
+// Workers receives the amount of workers the orchestrator asks for, until
+// the poller is closed.
+func (p *Poller) Workers() <-chan int {
+	p.workersOnce.Do(func() { go p.followSettings() })
+	return p.workers
+}
+
+// SetWorkers does nothing, the orchestrator doesn't keep track of the
+// capacity of in-process agents.
+func (p *Poller) SetWorkers(workers int) {}
+
+func (p *Poller) followSettings() {
+	for {
+		workers, changed := p.Interactor.AgentWorkers()
+
+		select {
+		case <-p.workers:
+		default:
+		}
+		p.workers <- workers
+
+		select {
+		case <-p.done:
+			return
+		case <-changed:
+		}
+	}
+}
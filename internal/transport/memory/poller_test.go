@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/agent"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestInteractor(t *testing.T) *orchestrator.Interactor {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	return orchestrator.NewOrchestratorInteractor(quota.Limits{}, orchestrator.NewFairScheduler(), orchestrator.ZeroCost{})
+}
+
+// waitDone waits for the expression to be finished.
+func waitDone(t *testing.T, interactor *orchestrator.Interactor, text string) *orchestrator.Expression {
+	t.Helper()
+
+	id, err := interactor.SubmitExpression(context.Background(), "user", text, orchestrator.ExpressionOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit expression: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		changed := interactor.WatchExpression(id)
+		if expression := interactor.GetExpression(id); expression.Status != orchestrator.Accepted {
+			return expression
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("expected %s to be solved", text)
+		}
+	}
+}
+
+func TestPollerSolvesExpressionsInProcess(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	poller := NewPoller(interactor, "embedded", nil)
+	defer poller.Close()
+
+	workers := agent.Interactor{Poller: poller}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	polling := make(chan error)
+	go func() { polling <- workers.StartPolling(ctx, 2) }()
+
+	for text, want := range map[string]float64{
+		"2+2*2":       6,
+		"(1+2)*(3+4)": 21,
+		"10/4-1":      1.5,
+	} {
+		expression := waitDone(t, interactor, text)
+		if expression.Status != orchestrator.Done || expression.Result != want {
+			t.Errorf("expected %s to be done with %v, got %s with %v", text, want, expression.Status, expression.Result)
+		}
+	}
+
+	if expression := waitDone(t, interactor, "1+2/0"); expression.Status != orchestrator.Failed || expression.Error == "" {
+		t.Errorf("expected 1+2/0 to fail with an error, got %s with %q", expression.Status, expression.Error)
+	}
+
+	cancel()
+	if err := <-polling; err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+}
+
+func TestPollerFollowsAgentWorkers(t *testing.T) {
+	interactor := newTestInteractor(t)
+
+	poller := NewPoller(interactor, "embedded", nil)
+	defer poller.Close()
+
+	receive := func() int {
+		t.Helper()
+
+		select {
+		case workers := <-poller.Workers():
+			return workers
+		case <-time.After(time.Second):
+			t.Fatal("expected the amount of workers to be received")
+			return 0
+		}
+	}
+
+	if workers := receive(); workers != 0 {
+		t.Errorf("expected the default amount of workers to be asked for, got %d", workers)
+	}
+
+	workers := 3
+	_, err := interactor.UpdateSettings(context.Background(), "admin", orchestrator.SettingsUpdate{AgentWorkers: &workers})
+	if err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+
+	if workers := receive(); workers != 3 {
+		t.Errorf("expected 3 workers to be asked for, got %d", workers)
+	}
+}
@@ -0,0 +1,475 @@
+// Package client is a typed client of the public HTTP API of the
+// orchestrator.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusAccepted = "accepted"
+	StatusDone     = "done"
+	StatusExpired  = "expired"
+	StatusCanceled = "canceled"
+	StatusFailed   = "failed"
+)
+
+type Expression struct {
+	ID         uuid.UUID  `json:"id"`
+	Expression string     `json:"expression"`
+	Status     string     `json:"status"`
+	Result     float64    `json:"result"`
+	Priority   string     `json:"priority"`
+	Deadline   *time.Time `json:"deadline,omitempty"`
+	Simulate   bool       `json:"simulate"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Error is why the expression has ended without a result.
+	Error string `json:"error,omitempty"`
+}
+
+// Finished reports whether the expression won't change anymore.
+func (e *Expression) Finished() bool {
+	return e.Status != StatusAccepted
+}
+
+type Step struct {
+	Number     int       `json:"number"`
+	Arg1       string    `json:"arg1"`
+	Operation  string    `json:"operation"`
+	Arg2       string    `json:"arg2"`
+	Result     float64   `json:"result"`
+	AgentID    string    `json:"agent_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type ExpressionsPage struct {
+	Expressions []Expression `json:"expressions"`
+	NextCursor  string       `json:"next_cursor,omitempty"`
+}
+
+type Usage struct {
+	Pending                int     `json:"pending"`
+	MaxPending             int     `json:"max_pending"`
+	RequestsPerSecond      float64 `json:"requests_per_second"`
+	Burst                  int     `json:"burst"`
+	TokensAvailable        float64 `json:"tokens_available"`
+	MaxExpressionLength    int     `json:"max_expression_length"`
+	MaxExpressionOperators int     `json:"max_expression_operators"`
+}
+
+// SubmitOptions are the optional parameters of a submitted expression.
+type SubmitOptions struct {
+	Priority string
+	Deadline *time.Time
+	// NoSimulate asks for the steps to be solved right away, without the
+	// latency of the cost model.
+	NoSimulate bool
+}
+
+// ListOptions filter and page an expression listing. Zero values are left
+// to the defaults of the orchestrator.
+type ListOptions struct {
+	Status        string
+	Search        string
+	Sort          string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+	Cursor        string
+}
+
+func (o ListOptions) values() url.Values {
+	values := url.Values{}
+
+	for name, value := range map[string]string{
+		"status": o.Status,
+		"q":      o.Search,
+		"sort":   o.Sort,
+		"cursor": o.Cursor,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+
+	if o.CreatedAfter != nil {
+		values.Set("created_after", o.CreatedAfter.Format(time.RFC3339))
+	}
+	if o.CreatedBefore != nil {
+		values.Set("created_before", o.CreatedBefore.Format(time.RFC3339))
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+
+	return values
+}
+
+// DefaultPollInterval is how often Wait checks on an expression unless
+// the client says otherwise.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// refreshMargin is how long before it expires a token is refreshed.
+const refreshMargin = time.Minute
+
+// Client calls the orchestrator at BaseURL. Once logged in, it keeps the
+// credentials to log in again when the token expires or is rejected. It's
+// safe for concurrent use.
+type Client struct {
+	BaseURL      string
+	HTTPClient   *http.Client
+	PollInterval time.Duration
+
+	token    string
+	login    string
+	password string
+	mutex    sync.Mutex
+
+	// refreshMutex makes concurrent requests refresh the token once.
+	refreshMutex sync.Mutex
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		HTTPClient:   http.DefaultClient,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Token returns the token requests are authorized with.
+func (c *Client) Token() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.token
+}
+
+// SetToken authorizes requests with a token obtained elsewhere. Without
+// credentials, it isn't refreshed.
+func (c *Client) SetToken(token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.token = token
+}
+
+// Register creates a user.
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	payload, err := json.Marshal(credentials{login, password})
+	if err != nil {
+		return err
+	}
+
+	return c.send(ctx, http.MethodPost, c.BaseURL+"/api/v1/register", payload, "", nil)
+}
+
+// Login authorizes as the user, storing the token and the credentials in
+// the client and returning the token.
+func (c *Client) Login(ctx context.Context, login, password string) (string, error) {
+	payload, err := json.Marshal(credentials{login, password})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.send(ctx, http.MethodPost, c.BaseURL+"/api/v1/login", payload, "", &resp); err != nil {
+		return "", err
+	}
+
+	c.mutex.Lock()
+	c.token = resp.Token
+	c.login = login
+	c.password = password
+	c.mutex.Unlock()
+
+	return resp.Token, nil
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// Submit submits an expression to be solved, returning its id.
+func (c *Client) Submit(ctx context.Context, expression string, options SubmitOptions) (uuid.UUID, error) {
+	req := struct {
+		Expression string     `json:"expression"`
+		Priority   string     `json:"priority,omitempty"`
+		Deadline   *time.Time `json:"deadline,omitempty"`
+		Simulate   *bool      `json:"simulate,omitempty"`
+	}{
+		Expression: expression,
+		Priority:   options.Priority,
+		Deadline:   options.Deadline,
+	}
+	if options.NoSimulate {
+		simulate := false
+		req.Simulate = &simulate
+	}
+
+	var resp struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/calculate", nil, req, &resp); err != nil {
+		return uuid.Nil, err
+	}
+
+	return resp.ID, nil
+}
+
+func (c *Client) Get(ctx context.Context, id uuid.UUID) (*Expression, error) {
+	var resp struct {
+		Expression Expression `json:"expression"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions/"+id.String(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Expression, nil
+}
+
+// Wait checks on the expression every PollInterval until it finishes,
+// returning it. Expressions which expired, have been canceled or failed are
+// returned along with ErrExpressionExpired, ErrExpressionCanceled or
+// ErrExpressionFailed.
+func (c *Client) Wait(ctx context.Context, id uuid.UUID) (*Expression, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		delay := interval
+
+		expr, err := c.Get(ctx, id)
+		var apiErr *APIError
+		switch {
+		case errors.As(err, &apiErr) && errors.Is(err, ErrRateLimited):
+			delay = max(delay, apiErr.RetryAfter)
+
+		case err != nil:
+			return nil, err
+
+		case expr.Status == StatusExpired:
+			return expr, ErrExpressionExpired
+
+		case expr.Status == StatusCanceled:
+			return expr, ErrExpressionCanceled
+
+		case expr.Status == StatusFailed:
+			return expr, fmt.Errorf("%w: %s", ErrExpressionFailed, expr.Error)
+
+		case expr.Finished():
+			return expr, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Steps lists the steps solved of an expression, in the order they were
+// solved.
+func (c *Client) Steps(ctx context.Context, id uuid.UUID) ([]Step, error) {
+	var resp struct {
+		Steps []Step `json:"steps"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions/"+id.String()+"/steps", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Steps, nil
+}
+
+// List returns a page of the expressions of the user.
+func (c *Client) List(ctx context.Context, options ListOptions) (*ExpressionsPage, error) {
+	var page ExpressionsPage
+	if err := c.do(ctx, http.MethodGet, "/api/v1/expressions", options.values(), nil, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// Cancel stops solving an expression, returning it once canceled.
+func (c *Client) Cancel(ctx context.Context, id uuid.UUID) (*Expression, error) {
+	var resp struct {
+		Expression Expression `json:"expression"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/expressions/"+id.String()+"/cancel", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Expression, nil
+}
+
+func (c *Client) Usage(ctx context.Context) (*Usage, error) {
+	var usage Usage
+	if err := c.do(ctx, http.MethodGet, "/api/v1/me/usage", nil, nil, &usage); err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// do sends a request with body encoded as JSON, decoding the response into
+// resp unless it's nil. The token is refreshed if it's about to expire or
+// gets rejected, provided the client has logged in.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, resp any) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	token := c.Token()
+	if expiresAt, ok := tokenExpiry(token); ok && time.Until(expiresAt) < refreshMargin {
+		if refreshed, err := c.refresh(ctx, token); err == nil {
+			token = refreshed
+		}
+	}
+
+	err := c.send(ctx, method, u, payload, token, resp)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+
+	refreshed, refreshErr := c.refresh(ctx, token)
+	if refreshErr != nil {
+		return err
+	}
+
+	return c.send(ctx, method, u, payload, refreshed, resp)
+}
+
+var errNoCredentials = errors.New("no credentials to refresh the token with")
+
+// refresh logs in again unless the stale token has already been replaced,
+// returning the current token.
+func (c *Client) refresh(ctx context.Context, stale string) (string, error) {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	c.mutex.Lock()
+	token, login, password := c.token, c.login, c.password
+	c.mutex.Unlock()
+
+	if token != stale {
+		return token, nil
+	}
+	if login == "" {
+		return "", errNoCredentials
+	}
+
+	return c.Login(ctx, login, password)
+}
+
+// tokenExpiry reads the expiry of a JWT without verifying it, which is up
+// to the orchestrator.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Exp, 0), true
+}
+
+// send sends a single request, authorized with token unless it's empty.
+func (c *Client) send(ctx context.Context, method, u string, payload []byte, token string, resp any) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+
+		// Errors carry their message in a JSON envelope, anything else
+		// is reported as is.
+		var envelope struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &envelope) == nil && envelope.Error != "" {
+			message = envelope.Error
+		}
+
+		return newAPIError(response, message)
+	}
+
+	if resp == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gitgernit/go-calculator/internal/domain/auth"
+	"github.com/gitgernit/go-calculator/internal/domain/orchestrator"
+	"github.com/gitgernit/go-calculator/internal/domain/quota"
+	db "github.com/gitgernit/go-calculator/internal/infra/gorm"
+	"github.com/gitgernit/go-calculator/internal/infra/health"
+	"github.com/gitgernit/go-calculator/internal/infra/logging"
+	httporchestrator "github.com/gitgernit/go-calculator/internal/transport/http/orchestrator"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testSecret = "test-secret"
+
+// testOrchestrator is an orchestrator served by httptest, counting the
+// logins it handles.
+type testOrchestrator struct {
+	*httptest.Server
+	interactor *orchestrator.Interactor
+	logins     atomic.Int32
+}
+
+func newTestOrchestrator(t *testing.T) *testOrchestrator {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	db.Db = conn
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	o := &testOrchestrator{
+		interactor: orchestrator.NewOrchestratorInteractor(quota.Limits{}, orchestrator.NewFIFOScheduler(), orchestrator.ZeroCost{}),
+	}
+
+	server := httporchestrator.NewHTTPServer(o.interactor, &auth.UserInteractor{JWTSecretKey: testSecret}, quota.NewRateLimiter(o.interactor.Limits), health.NewChecker(), "", "")
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/login" {
+			o.logins.Add(1)
+		}
+		server.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(o.Close)
+
+	return o
+}
+
+// solve plays the role of an agent until ctx is done.
+func (o *testOrchestrator) solve(ctx context.Context) {
+	for task := o.interactor.WaitNextTask(ctx, nil); task != nil; task = o.interactor.WaitNextTask(ctx, nil) {
+		_, _, _, arg1, arg2, operation, _ := task.NextStep()
+		a, _ := strconv.ParseFloat(arg1, 64)
+		b, _ := strconv.ParseFloat(arg2, 64)
+
+		var result float64
+		switch operation {
+		case "+":
+			result = a + b
+		case "-":
+			result = a - b
+		case "*":
+			result = a * b
+		case "/":
+			result = a / b
+		}
+
+		o.interactor.SolveTask(logging.WithStepID(ctx, task.StepID.String()), task.Expression.Id, result)
+	}
+}
+
+func newTestClient(t *testing.T, o *testOrchestrator) *Client {
+	t.Helper()
+
+	c := New(o.URL)
+	c.PollInterval = 10 * time.Millisecond
+
+	if err := c.Register(context.Background(), "alice", "secret"); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	if _, err := c.Login(context.Background(), "alice", "secret"); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+
+	return c
+}
+
+func TestClientSubmitsAndWaits(t *testing.T) {
+	o := newTestOrchestrator(t)
+	c := newTestClient(t, o)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go o.solve(ctx)
+
+	id, err := c.Submit(ctx, "(1+2)*3", SubmitOptions{Priority: "high", NoSimulate: true})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+
+	expr, err := c.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+	if expr.Status != StatusDone || expr.Result != 9 || expr.Priority != "high" || expr.Simulate {
+		t.Errorf("got %+v, want a done high priority expression with result 9", expr)
+	}
+
+	steps, err := c.Steps(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to list steps: %v", err)
+	}
+	if len(steps) != 2 || steps[1].Operation != "*" || steps[1].Result != 9 {
+		t.Errorf("got steps %+v, want 1+2 and 3*3", steps)
+	}
+
+	page, err := c.List(ctx, ListOptions{Status: StatusDone, Limit: 10})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(page.Expressions) != 1 || page.Expressions[0].ID != id {
+		t.Errorf("got %+v, want the submitted expression", page.Expressions)
+	}
+}
+
+func TestClientMapsErrors(t *testing.T) {
+	o := newTestOrchestrator(t)
+	c := newTestClient(t, o)
+	ctx := context.Background()
+
+	assertError := func(name string, err, want error) {
+		t.Helper()
+
+		var apiErr *APIError
+		if !errors.Is(err, want) || !errors.As(err, &apiErr) {
+			t.Errorf("%s: got %v, want an *APIError of %v", name, err, want)
+		}
+	}
+
+	assertError("register twice", c.Register(ctx, "alice", "secret"), ErrConflict)
+
+	_, err := New(o.URL).Login(ctx, "alice", "wrong")
+	assertError("wrong password", err, ErrUnauthorized)
+
+	_, err = New(o.URL).List(ctx, ListOptions{})
+	assertError("no token", err, ErrUnauthorized)
+
+	_, err = c.Submit(ctx, "1+", SubmitOptions{})
+	assertError("invalid expression", err, ErrInvalid)
+
+	_, err = c.List(ctx, ListOptions{Sort: "result"})
+	assertError("invalid sort", err, ErrBadRequest)
+
+	_, err = c.Get(ctx, uuid.New())
+	assertError("unknown expression", err, ErrNotFound)
+
+	id, err := c.Submit(ctx, "1+2", SubmitOptions{})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+
+	expr, err := c.Cancel(ctx, id)
+	if err != nil || expr.Status != StatusCanceled {
+		t.Fatalf("failed to cancel: %v, %+v", err, expr)
+	}
+
+	_, err = c.Cancel(ctx, id)
+	assertError("cancel twice", err, ErrConflict)
+
+	expr, err = c.Wait(ctx, id)
+	if !errors.Is(err, ErrExpressionCanceled) || expr == nil || expr.ID != id {
+		t.Errorf("wait for canceled: got %+v, %v, want the expression and %v", expr, err, ErrExpressionCanceled)
+	}
+}
+
+func TestClientRefreshesToken(t *testing.T) {
+	o := newTestOrchestrator(t)
+	c := newTestClient(t, o)
+	ctx := context.Background()
+
+	// A rejected token is refreshed and the request retried.
+	c.SetToken("invalid")
+	if _, err := c.List(ctx, ListOptions{}); err != nil {
+		t.Fatalf("list with a rejected token: %v", err)
+	}
+	if got := o.logins.Load(); got != 2 {
+		t.Errorf("got %d logins, want 2", got)
+	}
+
+	// A token about to expire is refreshed before it's used.
+	expiring, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"login": "alice",
+		"exp":   time.Now().Add(time.Second * 10).Unix(),
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	c.SetToken(expiring)
+	if _, err := c.List(ctx, ListOptions{}); err != nil {
+		t.Fatalf("list with an expiring token: %v", err)
+	}
+	if got := o.logins.Load(); got != 3 {
+		t.Errorf("got %d logins, want 3", got)
+	}
+	if c.Token() == expiring {
+		t.Error("expected expiring token to be replaced")
+	}
+
+	// Without credentials, the rejection is returned as is.
+	anonymous := New(o.URL)
+	anonymous.SetToken("invalid")
+	if _, err := anonymous.List(ctx, ListOptions{}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("list without credentials: got %v, want %v", err, ErrUnauthorized)
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors of responses with the matching statuses, which every APIError
+// wraps.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrInvalid      = errors.New("invalid request")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// Errors returned by Wait along with expressions which finished without a
+// result.
+var (
+	ErrExpressionExpired  = errors.New("expression has expired")
+	ErrExpressionCanceled = errors.New("expression has been canceled")
+	ErrExpressionFailed   = errors.New("expression has failed")
+)
+
+// APIError is a response of the orchestrator with an error status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the time to wait before retrying a rate limited
+	// request, zero if the orchestrator didn't say.
+	RetryAfter time.Duration
+}
+
+func newAPIError(resp *http.Response, message string) *APIError {
+	err := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+	}
+
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return err
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+
+	return e.Message
+}
+
+// Unwrap returns the error of the status, so APIErrors can be told apart
+// with errors.Is.
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrInvalid
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	default:
+		return nil
+	}
+}